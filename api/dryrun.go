@@ -0,0 +1,42 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package api
+
+import "gerrit.opencord.org/abstract-olt/models/physical"
+
+/*
+newRecorder - returns a recorder to dry run a request with when dryRun is set, nil otherwise
+*/
+func newRecorder(dryRun bool) *physical.Recorder {
+	if !dryRun {
+		return nil
+	}
+	return &physical.Recorder{}
+}
+
+/*
+toSouthbound - converts what a dry run recorded to the messages returned to the caller
+*/
+func toSouthbound(recorder *physical.Recorder) []*SouthboundMessage {
+	if recorder == nil {
+		return nil
+	}
+	southbound := []*SouthboundMessage{}
+	for _, message := range recorder.Messages {
+		southbound = append(southbound, &SouthboundMessage{Transport: message.Transport, Operation: message.Operation, Body: message.Body})
+	}
+	return southbound
+}
@@ -0,0 +1,213 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/abstract"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	context "golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+codeFor - picks the gRPC status code that best describes err
+*/
+func codeFor(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if err == impl.ErrBatchSkipped {
+		return codes.Aborted
+	}
+	if err == impl.ErrJobsNotStarted {
+		return codes.FailedPrecondition
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case context.Canceled:
+		return codes.Canceled
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+	switch err.(type) {
+	case *models.ChassisNotFoundError, *physical.OLTNotFoundError, *impl.JobNotFoundError, *impl.SnapshotNotFoundError,
+		*impl.OntNotFoundError:
+		return codes.NotFound
+	case *models.ChassisExistsError, *physical.OLTExistsError, *physical.AllReadyActiveError, *physical.VlanInUseError,
+		*physical.SerialInUseError, *physical.OntIDInUseError:
+		return codes.AlreadyExists
+	case *abstract.OutOfRangeError:
+		return codes.InvalidArgument
+	case *physical.AllReadyDeactivatedError, *physical.UnprovisionedSlotError, *abstract.UnprovisonedPortError, *physical.ActiveOntsError,
+		*physical.OntNotActiveError, *physical.AllReadySuspendedError, *physical.OntNotSuspendedError,
+		*physical.OntStateError:
+		return codes.FailedPrecondition
+	case *physical.XOSError:
+		if err.(*physical.XOSError).TimedOut() {
+			return codes.DeadlineExceeded
+		}
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+/*
+toStatus - converts a model error into a gRPC status error carrying errdetails about the offending field or entity,
+the gateway turns the code into the matching HTTP status
+*/
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	st := status.New(codeFor(err), err.Error())
+	var detail proto.Message
+	switch e := err.(type) {
+	case *models.ChassisNotFoundError:
+		detail = &errdetails.ResourceInfo{ResourceType: "chassis", ResourceName: e.CLLI, Description: err.Error()}
+	case *models.ChassisExistsError:
+		detail = &errdetails.ResourceInfo{ResourceType: "chassis", ResourceName: e.CLLI, Description: err.Error()}
+	case *impl.JobNotFoundError:
+		detail = &errdetails.ResourceInfo{ResourceType: "job", ResourceName: e.ID, Description: err.Error()}
+	case *impl.OntNotFoundError:
+		detail = &errdetails.ResourceInfo{ResourceType: "ont", ResourceName: e.Value, Description: err.Error()}
+	case *impl.SnapshotNotFoundError:
+		detail = &errdetails.ResourceInfo{ResourceType: "backup", ResourceName: e.ID, Owner: e.CLLI, Description: err.Error()}
+	case *physical.OLTNotFoundError:
+		detail = &errdetails.ResourceInfo{ResourceType: "olt", ResourceName: e.Hostname, Owner: e.CLLI, Description: err.Error()}
+	case *physical.OLTExistsError:
+		detail = &errdetails.ResourceInfo{ResourceType: "olt", ResourceName: e.Hostname, Owner: e.CLLI, Description: err.Error()}
+	case *physical.AllReadyActiveError:
+		detail = &errdetails.ResourceInfo{ResourceType: "ont", Description: err.Error()}
+	case *abstract.OutOfRangeError:
+		detail = &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: numberField(e.Field), Description: err.Error()},
+		}}
+	case *physical.UnprovisionedSlotError:
+		detail = preconditionFailure("UNPROVISIONED_SLOT", fmt.Sprintf("%s/%d", e.CLLI, e.SlotNumber), err)
+	case *abstract.UnprovisonedPortError:
+		detail = preconditionFailure("UNPROVISIONED_PORT", "port", err)
+	case *physical.AllReadyDeactivatedError, *physical.OntNotActiveError:
+		detail = preconditionFailure("ONT_NOT_ACTIVE", "ont", err)
+	case *physical.AllReadySuspendedError:
+		detail = preconditionFailure("ONT_SUSPENDED", "ont", err)
+	case *physical.OntNotSuspendedError:
+		detail = preconditionFailure("ONT_NOT_SUSPENDED", "ont", err)
+	case *physical.OntStateError:
+		detail = preconditionFailure("ONT_STATE", "ont", err)
+	case *physical.VlanInUseError:
+		detail = &errdetails.ResourceInfo{ResourceType: "ont", ResourceName: fmt.Sprintf("%s/%d/%d", e.Hostname, e.PortNumber, e.OntNumber),
+			Owner: e.CLLI, Description: err.Error()}
+	case *physical.SerialInUseError:
+		detail = &errdetails.ResourceInfo{ResourceType: "ont", ResourceName: ontName(e.Hostname, e.PortNumber, e.OntNumber),
+			Owner: e.CLLI, Description: err.Error()}
+	case *physical.OntIDInUseError:
+		detail = &errdetails.ResourceInfo{ResourceType: "ont", ResourceName: ontName(e.Hostname, e.PortNumber, e.OntNumber),
+			Owner: e.CLLI, Description: err.Error()}
+	case *physical.ActiveOntsError:
+		subject := e.CLLI
+		if e.Hostname != "" {
+			subject = fmt.Sprintf("%s/%s", e.CLLI, e.Hostname)
+		}
+		detail = preconditionFailure("ACTIVE_ONTS", subject, err)
+	case *physical.XOSError:
+		description := fmt.Sprintf("%s failed, the change was kept and can be pushed again with Reflow", e.Operation)
+		if e.RolledBack {
+			description = fmt.Sprintf("%s failed, the change was rolled back", e.Operation)
+		}
+		detail = &errdetails.ResourceInfo{ResourceType: "xos", ResourceName: e.CLLI, Description: description}
+	}
+	if detail != nil {
+		if withDetails, detailErr := st.WithDetails(detail); detailErr == nil {
+			st = withDetails
+		}
+	}
+	if safeToRetry(err) {
+		retry := &errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(settings.GetJobRetryDelay())}
+		if withDetails, detailErr := st.WithDetails(retry); detailErr == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+/*
+safeToRetry - true when err left nothing changed, or nothing that stops the same request being made again
+*/
+func safeToRetry(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	if xosErr, ok := err.(*physical.XOSError); ok {
+		return xosErr.Retryable()
+	}
+	return false
+}
+
+/*
+invalidArgument - InvalidArgument status error naming the request field that was wrong
+*/
+func invalidArgument(field string, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: field, Description: description},
+	}})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func preconditionFailure(violationType string, subject string, err error) proto.Message {
+	return &errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{
+		{Type: violationType, Subject: subject, Description: err.Error()},
+	}}
+}
+
+// an ont on another chassis than the one changed is only known by its chassis
+func ontName(hostname string, portNumber int, ontNumber int) string {
+	if hostname == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d/%d", hostname, portNumber, ontNumber)
+}
+
+// maps the abstract model field name onto the request message field
+func numberField(field string) string {
+	switch field {
+	case "slot":
+		return "SlotNumber"
+	case "port":
+		return "PortNumber"
+	case "ont":
+		return "OntNumber"
+	}
+	return field
+}
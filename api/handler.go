@@ -17,14 +17,16 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"net"
 	"sync"
 
 	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
 	"gerrit.opencord.org/abstract-olt/models/inventory"
+	"gerrit.opencord.org/abstract-olt/models/physical"
 	context "golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 /*
@@ -33,30 +35,23 @@ Server instance of the grpc server
 type Server struct {
 }
 
-var syncChan chan bool
-var isDirty bool
+// closed by Shutdown, WatchEvents streams never end on their own and would hold up a graceful stop
+var shuttingDown = make(chan struct{})
+var shutdownOnce sync.Once
 
-var runOnce sync.Once
-
-func getSyncChannel() chan bool {
-	runOnce.Do(func() {
-		syncChan = make(chan bool, 1)
-		syncChan <- true
+/*
+Shutdown - ends every WatchEvents stream and any opened later so the grpc server can stop gracefully
+*/
+func Shutdown() {
+	shutdownOnce.Do(func() {
+		close(shuttingDown)
 	})
-
-	return syncChan
-}
-func done(myChan chan bool, done bool) {
-	myChan <- done
 }
 
 /*
 Echo - Tester function which just returns same string sent to it
 */
 func (s *Server) Echo(ctx context.Context, in *EchoMessage) (*EchoReplyMessage, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
 	ping := in.GetPing()
 	pong := EchoReplyMessage{Pong: ping}
 	return &pong, nil
@@ -72,21 +67,39 @@ func (s *Server) CreateChassis(ctx context.Context, in *AddChassisMessage) (*Add
 	xosPort := int(in.GetXOSPort())
 	if xosIP == nil {
 		errStr := fmt.Sprintf("Invalid IP %s supplied for XOSIP", in.GetXOSIP())
-		return nil, errors.New(errStr)
+		return nil, invalidArgument("XOSIP", errStr)
 	}
 	xosAddress := net.TCPAddr{IP: xosIP, Port: xosPort}
 	xosUser := in.GetXOSUser()
 	xosPassword := in.GetXOSPassword()
 	if xosUser == "" || xosPassword == "" {
-		return nil, errors.New("Either XOSUser or XOSPassword supplied were empty")
+		return nil, invalidArgument("XOSUser", "Either XOSUser or XOSPassword supplied were empty")
 	}
 	shelf := int(in.GetShelf())
 	rack := int(in.GetRack())
-	deviceID, err := impl.CreateChassis(clli, xosAddress, xosUser, xosPassword, shelf, rack)
+	if jobID, ok, err := submitAsync(ctx, "CreateChassis", clli, in); ok {
+		return &AddChassisReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	deviceID, err := impl.CreateChassis(ctx, clli, xosAddress, xosUser, xosPassword, shelf, rack, recorder)
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
+	}
+	return &AddChassisReturn{DeviceID: deviceID, Southbound: toSouthbound(recorder)}, nil
+}
+
+/*
+DeleteChassis - removes an abstract chassis, and with Force everything provisioned under it
+*/
+func (s *Server) DeleteChassis(ctx context.Context, in *DeleteChassisMessage) (*DeleteChassisReturn, error) {
+	clli := in.GetCLLI()
+	force := in.GetForce()
+	if jobID, ok, err := submitAsync(ctx, "DeleteChassis", clli, in); ok {
+		return &DeleteChassisReturn{JobID: jobID}, err
 	}
-	return &AddChassisReturn{DeviceID: deviceID}, nil
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.DeleteChassis(ctx, clli, force, recorder)
+	return &DeleteChassisReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -97,10 +110,14 @@ func (s *Server) ChangeXOSUserPassword(ctx context.Context, in *ChangeXOSUserPas
 	xosUser := in.GetXOSUser()
 	xosPassword := in.GetXOSPassword()
 	if xosUser == "" || xosPassword == "" {
-		return nil, errors.New("Either XOSUser or XOSPassword supplied were empty")
+		return nil, invalidArgument("XOSUser", "Either XOSUser or XOSPassword supplied were empty")
 	}
-	success, err := impl.ChangeXOSUserPassword(clli, xosUser, xosPassword)
-	return &ChangeXOSUserPasswordReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "ChangeXOSUserPassword", clli, in); ok {
+		return &ChangeXOSUserPasswordReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.ChangeXOSUserPassword(ctx, clli, xosUser, xosPassword, recorder)
+	return &ChangeXOSUserPasswordReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 
 }
 
@@ -111,10 +128,59 @@ func (s *Server) CreateOLTChassis(ctx context.Context, in *AddOLTChassisMessage)
 	clli := in.GetCLLI()
 	oltType := in.GetType().String()
 	driver := in.GetDriver().String()
-	address := net.TCPAddr{IP: net.ParseIP(in.GetSlotIP()), Port: int(in.GetSlotPort())}
+	slotIP := net.ParseIP(in.GetSlotIP())
+	if slotIP == nil {
+		errStr := fmt.Sprintf("Invalid IP %s supplied for SlotIP", in.GetSlotIP())
+		return nil, invalidArgument("SlotIP", errStr)
+	}
+	address := net.TCPAddr{IP: slotIP, Port: int(in.GetSlotPort())}
+	hostname := in.GetHostname()
+	if hostname == "" {
+		return nil, invalidArgument("Hostname", "Hostname of the OLT is required")
+	}
+	if jobID, ok, err := submitAsync(ctx, "CreateOLTChassis", clli, in); ok {
+		return &AddOLTChassisReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	clli, err := impl.CreateOLTChassis(ctx, clli, oltType, driver, address, hostname, recorder)
+	return &AddOLTChassisReturn{DeviceID: hostname, ChassisDeviceID: clli, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+RemoveOLTChassis removes an OLT chassis/line card from the Physical chassis
+*/
+func (s *Server) RemoveOLTChassis(ctx context.Context, in *RemoveOLTChassisMessage) (*RemoveOLTChassisReturn, error) {
+	clli := in.GetCLLI()
 	hostname := in.GetHostname()
-	clli, err := impl.CreateOLTChassis(clli, oltType, driver, address, hostname)
-	return &AddOLTChassisReturn{DeviceID: hostname, ChassisDeviceID: clli}, err
+	force := in.GetForce()
+	if jobID, ok, err := submitAsync(ctx, "RemoveOLTChassis", clli, in); ok {
+		return &RemoveOLTChassisReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.RemoveOLTChassis(ctx, clli, hostname, force, recorder)
+	return &RemoveOLTChassisReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+ReplaceOLTChassis swaps an OLT chassis/line card for new hardware in the same abstract slot
+*/
+func (s *Server) ReplaceOLTChassis(ctx context.Context, in *ReplaceOLTChassisMessage) (*ReplaceOLTChassisReturn, error) {
+	clli := in.GetCLLI()
+	hostname := in.GetHostname()
+	slotIP := net.ParseIP(in.GetSlotIP())
+	if slotIP == nil {
+		errStr := fmt.Sprintf("Invalid IP %s supplied for SlotIP", in.GetSlotIP())
+		return nil, invalidArgument("SlotIP", errStr)
+	}
+	address := net.TCPAddr{IP: slotIP, Port: int(in.GetSlotPort())}
+	driver := in.GetDriver().String()
+	newHostname := in.GetNewHostname()
+	if jobID, ok, err := submitAsync(ctx, "ReplaceOLTChassis", clli, in); ok {
+		return &ReplaceOLTChassisReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	deviceID, err := impl.ReplaceOLTChassis(ctx, clli, hostname, driver, address, newHostname, recorder)
+	return &ReplaceOLTChassisReturn{DeviceID: deviceID, ChassisDeviceID: clli, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -126,8 +192,12 @@ func (s *Server) ProvisionOnt(ctx context.Context, in *AddOntMessage) (*AddOntRe
 	portNumber := int(in.GetPortNumber())
 	ontNumber := int(in.GetOntNumber())
 	serialNumber := in.GetSerialNumber()
-	success, err := impl.ProvisionOnt(clli, slotNumber, portNumber, ontNumber, serialNumber)
-	return &AddOntReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "ProvisionOnt", clli, in); ok {
+		return &AddOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.ProvisionOnt(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, recorder)
+	return &AddOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -143,8 +213,12 @@ func (s *Server) ProvisionOntFull(ctx context.Context, in *AddOntFullMessage) (*
 	sTag := in.GetSTag()
 	nasPortID := in.GetNasPortID()
 	circuitID := in.GetCircuitID()
-	success, err := impl.ProvisionOntFull(clli, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
-	return &AddOntReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "ProvisionOntFull", clli, in); ok {
+		return &AddOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.ProvisionOntFull(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID, recorder)
+	return &AddOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -161,8 +235,12 @@ func (s *Server) PreProvisionOnt(ctx context.Context, in *PreProvisionOntMessage
 	circuitID := in.GetCircuitID()
 	techProfile := in.GetTechProfile()
 	speedProfile := in.GetSpeedProfile()
-	success, err := impl.PreProvisionOnt(clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
-	return &AddOntReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "PreProvisionOnt", clli, in); ok {
+		return &AddOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.PreProvisionOnt(ctx, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile, recorder)
+	return &AddOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -174,8 +252,12 @@ func (s *Server) ActivateSerial(ctx context.Context, in *AddOntMessage) (*AddOnt
 	portNumber := int(in.GetPortNumber())
 	ontNumber := int(in.GetOntNumber())
 	serialNumber := in.GetSerialNumber()
-	success, err := impl.ActivateSerial(clli, slotNumber, portNumber, ontNumber, serialNumber)
-	return &AddOntReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "ActivateSerial", clli, in); ok {
+		return &AddOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.ActivateSerial(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, recorder)
+	return &AddOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
 }
 
 /*
@@ -187,16 +269,231 @@ func (s *Server) DeleteOnt(ctx context.Context, in *DeleteOntMessage) (*DeleteOn
 	portNumber := int(in.GetPortNumber())
 	ontNumber := int(in.GetOntNumber())
 	serialNumber := in.GetSerialNumber()
-	success, err := impl.DeleteOnt(clli, slotNumber, portNumber, ontNumber, serialNumber)
-	return &DeleteOntReturn{Success: success}, err
+	if jobID, ok, err := submitAsync(ctx, "DeleteOnt", clli, in); ok {
+		return &DeleteOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.DeleteOnt(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, recorder)
+	return &DeleteOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+ModifyOnt - changes the vlans, NasPortID, CircuitID or profiles of an active ont, fields left empty are unchanged
+*/
+func (s *Server) ModifyOnt(ctx context.Context, in *ModifyOntMessage) (*ModifyOntReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	cTag := in.GetCTag()
+	sTag := in.GetSTag()
+	nasPortID := in.GetNasPortID()
+	circuitID := in.GetCircuitID()
+	techProfile := in.GetTechProfile()
+	speedProfile := in.GetSpeedProfile()
+	if jobID, ok, err := submitAsync(ctx, "ModifyOnt", clli, in); ok {
+		return &ModifyOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	changed, err := impl.ModifyOnt(ctx, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile, recorder)
+	if err != nil {
+		// nothing is changed when the ont is rejected or XOS fails to take the change
+		changed = nil
+	}
+	return &ModifyOntReturn{Success: err == nil, ChangedFields: changed, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+PutOnt - provisions the ont at a slot/port/ont or brings an already provisioned one in line with the request
+*/
+func (s *Server) PutOnt(ctx context.Context, in *PutOntMessage) (*PutOntReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	serialNumber := in.GetSerialNumber()
+	cTag := in.GetCTag()
+	sTag := in.GetSTag()
+	nasPortID := in.GetNasPortID()
+	circuitID := in.GetCircuitID()
+	techProfile := in.GetTechProfile()
+	speedProfile := in.GetSpeedProfile()
+	if serialNumber == "" && sTag == 0 && cTag == 0 && nasPortID == "" && circuitID == "" && techProfile == "" && speedProfile == "" {
+		return nil, invalidArgument("SerialNumber", "Either a SerialNumber or the values to provision the ont with are required")
+	}
+	if jobID, ok, err := submitAsync(ctx, "PutOnt", clli, in); ok {
+		return &PutOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	created, changed, err := impl.PutOnt(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile, recorder)
+	return &PutOntReturn{Success: err == nil, Created: created, ChangedFields: changed, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+SuspendOnt - cuts service to an active ont without losing its vlans, ids or profiles
+*/
+func (s *Server) SuspendOnt(ctx context.Context, in *SuspendOntMessage) (*SuspendOntReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	if jobID, ok, err := submitAsync(ctx, "SuspendOnt", clli, in); ok {
+		return &SuspendOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.SuspendOnt(ctx, clli, slotNumber, portNumber, ontNumber, recorder)
+	return &SuspendOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+ResumeOnt - restores service to a suspended ont
+*/
+func (s *Server) ResumeOnt(ctx context.Context, in *ResumeOntMessage) (*ResumeOntReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	if jobID, ok, err := submitAsync(ctx, "ResumeOnt", clli, in); ok {
+		return &ResumeOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.ResumeOnt(ctx, clli, slotNumber, portNumber, ontNumber, recorder)
+	return &ResumeOntReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+ReplaceOntSerial - gives an active ont the serial number of the hardware it was swapped for, keeping its vlans and ids
+*/
+func (s *Server) ReplaceOntSerial(ctx context.Context, in *ReplaceOntSerialMessage) (*ReplaceOntSerialReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	serialNumber := in.GetSerialNumber()
+	if serialNumber == "" {
+		return nil, invalidArgument("SerialNumber", "SerialNumber of the replacement ont is required")
+	}
+	if jobID, ok, err := submitAsync(ctx, "ReplaceOntSerial", clli, in); ok {
+		return &ReplaceOntSerialReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	previous, err := impl.ReplaceOntSerial(ctx, clli, slotNumber, portNumber, ontNumber, serialNumber, recorder)
+	return &ReplaceOntSerialReturn{Success: err == nil, PreviousSerialNumber: previous, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+MoveOnt - moves an active ont to another slot/port/ont, on the same chassis unless DestinationCLLI is set
+*/
+func (s *Server) MoveOnt(ctx context.Context, in *MoveOntMessage) (*MoveOntReturn, error) {
+	clli := in.GetCLLI()
+	slotNumber := int(in.GetSlotNumber())
+	portNumber := int(in.GetPortNumber())
+	ontNumber := int(in.GetOntNumber())
+	toCLLI := in.GetDestinationCLLI()
+	if toCLLI == "" {
+		toCLLI = clli
+	}
+	toSlot := int(in.GetDestinationSlotNumber())
+	toPort := int(in.GetDestinationPortNumber())
+	toOnt := int(in.GetDestinationOntNumber())
+	keepIdentity := in.GetSubscriberIdentity() == MoveOntMessage_keep
+	if jobID, ok, err := submitAsync(ctx, "MoveOnt", clli, in); ok {
+		return &MoveOntReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	ont, err := impl.MoveOnt(ctx, clli, slotNumber, portNumber, ontNumber, toCLLI, toSlot, toPort, toOnt, keepIdentity, recorder)
+	return &MoveOntReturn{Success: err == nil, STag: ont.Svlan, CTag: ont.Cvlan, NasPortID: ont.NasPortID, CircuitID: ont.CircuitID,
+		Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+FindOnt - finds where an ont lives by serial number, circuit id or nas port id
+*/
+func (s *Server) FindOnt(ctx context.Context, in *FindOntMessage) (*FindOntReturn, error) {
+	location, err := impl.FindOnt(physical.OntLookup(in.GetSearchBy()), in.GetValue())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toFindOntReturn(location), nil
+}
+
+/*
+GetOnt - returns the ont at a slot/port/ont of an abstract chassis
+*/
+func (s *Server) GetOnt(ctx context.Context, in *GetOntMessage) (*FindOntReturn, error) {
+	location, err := impl.GetOnt(in.GetCLLI(), int(in.GetSlotNumber()), int(in.GetPortNumber()), int(in.GetOntNumber()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toFindOntReturn(location), nil
+}
+
+func toFindOntReturn(location impl.OntLocation) *FindOntReturn {
+	return &FindOntReturn{
+		CLLI:               location.CLLI,
+		SlotNumber:         int32(location.SlotNumber),
+		PortNumber:         int32(location.PortNumber),
+		OntNumber:          int32(location.OntNumber),
+		Hostname:           location.Hostname,
+		PhysicalPortNumber: int32(location.PhysicalPortNumber),
+		State:              location.State,
+		SerialNumber:       location.SerialNumber,
+		NasPortID:          location.NasPortID,
+		CircuitID:          location.CircuitID,
+		STag:               location.STag,
+		CTag:               location.CTag,
+	}
+}
+
+/*
+BatchProvision - applies a list of ont operations to one chassis in a single call reporting a result per operation
+*/
+func (s *Server) BatchProvision(ctx context.Context, in *BatchProvisionMessage) (*BatchProvisionReturn, error) {
+	clli := in.GetCLLI()
+	stopOnFailure := in.GetBatchMode() == BatchProvisionMessage_stopOnFailure
+	operations := []impl.BatchOperation{}
+	for _, op := range in.GetOperations() {
+		operations = append(operations, impl.BatchOperation{
+			Type:         impl.BatchOperationType(op.GetType()),
+			SlotNumber:   int(op.GetSlotNumber()),
+			PortNumber:   int(op.GetPortNumber()),
+			OntNumber:    int(op.GetOntNumber()),
+			SerialNumber: op.GetSerialNumber(),
+			CTag:         op.GetCTag(),
+			STag:         op.GetSTag(),
+			NasPortID:    op.GetNasPortID(),
+			CircuitID:    op.GetCircuitID(),
+			TechProfile:  op.GetTechProfile(),
+			SpeedProfile: op.GetSpeedProfile(),
+		})
+	}
+	if jobID, ok, err := submitAsync(ctx, "BatchProvision", clli, in); ok {
+		return &BatchProvisionReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	errs, err := impl.BatchProvision(ctx, clli, operations, stopOnFailure, recorder)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	success := true
+	results := []*BatchResult{}
+	for i, opErr := range errs {
+		result := &BatchResult{Index: int32(i), Success: opErr == nil, Code: int32(codeFor(opErr))}
+		if opErr != nil {
+			result.Error = opErr.Error()
+			success = false
+		}
+		results = append(results, result)
+	}
+	return &BatchProvisionReturn{Success: success, Results: results, Southbound: toSouthbound(recorder)}, nil
 }
 
 /*
 Reflow - iterates through provisioning to rebuild Seba-Pod
 */
 func (s *Server) Reflow(ctx context.Context, in *ReflowMessage) (*ReflowReturn, error) {
-	success, err := impl.Reflow()
-	return &ReflowReturn{Success: success}, err
+	success, err := impl.Reflow(ctx)
+	return &ReflowReturn{Success: success}, toStatus(err)
 
 }
 
@@ -205,7 +502,7 @@ Output - causes an immediate backup to be created
 */
 func (s *Server) Output(ctx context.Context, in *OutputMessage) (*OutputReturn, error) {
 	success, err := impl.DoOutput()
-	return &OutputReturn{Success: success}, err
+	return &OutputReturn{Success: success}, toStatus(err)
 
 }
 
@@ -221,6 +518,142 @@ func (s *Server) GetFullInventory(ctx context.Context, in *FullInventoryMessage)
 GetInventory - returns a json dump of a particular seba-pod
 */
 func (s *Server) GetInventory(ctx context.Context, in *InventoryMessage) (*InventoryReturn, error) {
+	if in.GetClli() == "" {
+		return nil, invalidArgument("Clli", "You must provide a CLLI")
+	}
 	json, err := inventory.GatherInventory(in.GetClli())
-	return &InventoryReturn{JsonDump: json}, err
+	return &InventoryReturn{JsonDump: json}, toStatus(err)
+}
+
+/*
+GetFullChassisInventory - returns the currently provisioned equipment of every seba-pod as protobuf messages
+*/
+func (s *Server) GetFullChassisInventory(ctx context.Context, in *FullInventoryMessage) (*FullChassisInventoryReturn, error) {
+	chassis_s := inventory.GetAllChassis()
+	inventoryChassis := make([]*InventoryChassis, 0, len(chassis_s))
+	for _, chassis := range chassis_s {
+		inventoryChassis = append(inventoryChassis, toInventoryChassis(chassis))
+	}
+	return &FullChassisInventoryReturn{Chassis: inventoryChassis}, nil
+}
+
+/*
+GetChassisInventory - returns the currently provisioned equipment of a particular seba-pod as protobuf messages
+*/
+func (s *Server) GetChassisInventory(ctx context.Context, in *InventoryMessage) (*ChassisInventoryReturn, error) {
+	if in.GetClli() == "" {
+		return nil, invalidArgument("Clli", "You must provide a CLLI")
+	}
+	chassis, err := inventory.GetChassis(in.GetClli())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ChassisInventoryReturn{Chassis: toInventoryChassis(chassis)}, nil
+}
+
+/*
+GetJob - reports the progress of a call made in async mode
+*/
+func (s *Server) GetJob(ctx context.Context, in *GetJobMessage) (*Job, error) {
+	job, err := impl.GetJob(in.GetID())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toJob(job), nil
+}
+
+/*
+ListJobs - reports every job still known, optionally only those on one CLLI, oldest first
+*/
+func (s *Server) ListJobs(ctx context.Context, in *ListJobsMessage) (*ListJobsReturn, error) {
+	jobs := []*Job{}
+	for _, job := range impl.ListJobs(in.GetCLLI()) {
+		jobs = append(jobs, toJob(job))
+	}
+	return &ListJobsReturn{Jobs: jobs}, nil
+}
+
+/*
+ListBackups - returns the snapshots of a chassis, or of every chassis when CLLI is empty, oldest first
+*/
+func (s *Server) ListBackups(ctx context.Context, in *ListBackupsMessage) (*ListBackupsReturn, error) {
+	list, err := impl.ListBackups(in.GetCLLI())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	backups := []*Backup{}
+	for _, backup := range list {
+		backups = append(backups, &Backup{ID: backup.ID, CLLI: backup.CLLI, Created: backup.Created.Unix()})
+	}
+	return &ListBackupsReturn{Backups: backups}, nil
+}
+
+/*
+DiffBackup - returns what differs between a snapshot of a chassis and its live state
+*/
+func (s *Server) DiffBackup(ctx context.Context, in *DiffBackupMessage) (*DiffBackupReturn, error) {
+	if in.GetID() == "" {
+		return nil, invalidArgument("ID", "ID of the backup is required")
+	}
+	list, err := impl.DiffBackup(in.GetCLLI(), in.GetID())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	differences := []*BackupDifference{}
+	for _, difference := range list {
+		differences = append(differences, &BackupDifference{Path: difference.Path, Backup: difference.Backup, Live: difference.Live})
+	}
+	return &DiffBackupReturn{Differences: differences}, nil
+}
+
+/*
+RestoreBackup - puts a chassis back to a snapshot, recreating it if it was deleted, and sends it to XOS when Reflow is set
+*/
+func (s *Server) RestoreBackup(ctx context.Context, in *RestoreBackupMessage) (*RestoreBackupReturn, error) {
+	clli := in.GetCLLI()
+	if in.GetID() == "" {
+		return nil, invalidArgument("ID", "ID of the backup is required")
+	}
+	if jobID, ok, err := submitAsync(ctx, "RestoreBackup", clli, in); ok {
+		return &RestoreBackupReturn{JobID: jobID}, err
+	}
+	recorder := newRecorder(in.GetDryRun())
+	success, err := impl.RestoreBackup(ctx, clli, in.GetID(), in.GetReflow(), recorder)
+	return &RestoreBackupReturn{Success: success, Southbound: toSouthbound(recorder)}, toStatus(err)
+}
+
+/*
+WatchEvents - streams chassis, olt and ont changes optionally filtered by CLLI and event type until the client goes away
+*/
+func (s *Server) WatchEvents(in *WatchEventsMessage, stream AbstractOLT_WatchEventsServer) error {
+	types := []impl.EventType{}
+	for _, eventType := range in.GetTypes() {
+		types = append(types, impl.EventType(eventType))
+	}
+	id, events := impl.Subscribe(in.GetCLLI(), types)
+	defer impl.Unsubscribe(id)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-shuttingDown:
+			return status.Error(codes.Unavailable, "The server is shutting down")
+		case event := <-events:
+			err := stream.Send(&Event{
+				Type:         Event_EventType(event.Type),
+				EventKind:    Event_Kind(event.Kind),
+				CLLI:         event.CLLI,
+				SlotNumber:   int32(event.Slot),
+				PortNumber:   int32(event.Port),
+				OntNumber:    int32(event.Ont),
+				Hostname:     event.Hostname,
+				SerialNumber: event.SerialNumber,
+				Message:      event.Message,
+				Timestamp:    event.Time.Unix(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
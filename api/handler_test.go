@@ -0,0 +1,184 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package api_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/api"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/inventory"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+setupChassis - backs up to a temporary directory and creates the chassis clli in dummy mode with an edgecore olt,
+the returned func removes the chassis and the backups
+*/
+func setupChassis(t *testing.T, clli string) func() {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v", err)
+	}
+	impl.SetStorage(models.NewFileStorage(dir))
+	settings.SetDummy(true)
+	settings.SetGrpc(false)
+	ctx := context.Background()
+	_, err = impl.CreateChassis(ctx, clli, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}, "user", "password", 1, 1, nil)
+	if err != nil {
+		t.Fatalf("CreateChassis failed with %v", err)
+	}
+	_, err = impl.CreateOLTChassis(ctx, clli, "edgecore", "openolt", net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, clli+"_olt1", nil)
+	if err != nil {
+		t.Fatalf("CreateOLTChassis failed with %v", err)
+	}
+	return func() {
+		if chassisHolder := models.LockChassis(clli); chassisHolder != nil {
+			chassisHolder.PhysicalChassis.UnindexOnts()
+			models.RemoveChassis(clli)
+			chassisHolder.Unlock()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHandler_BatchProvisionCodes(t *testing.T) {
+	clli := "batch_codes_clli"
+	defer setupChassis(t, clli)()
+	ctx := context.Background()
+
+	request := &api.BatchProvisionMessage{CLLI: clli, BatchMode: api.BatchProvisionMessage_stopOnFailure, Operations: []*api.BatchOperation{
+		{Type: api.BatchOperation_provision, SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: "BATCHCODES1"},
+		{Type: api.BatchOperation_provision, SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: "BATCHCODES2"},
+		{Type: api.BatchOperation_provision, SlotNumber: 1, PortNumber: 1, OntNumber: 2, SerialNumber: "BATCHCODES3"},
+	}}
+	server := api.Server{}
+	response, err := server.BatchProvision(ctx, request)
+	if err != nil || response.GetSuccess() || len(response.GetResults()) != 3 {
+		t.Fatalf("Expected a failed batch with a result per operation got %v %v", response, err)
+	}
+	expected := []codes.Code{codes.OK, codes.AlreadyExists, codes.Aborted}
+	for i, result := range response.GetResults() {
+		if int(result.GetIndex()) != i || codes.Code(result.GetCode()) != expected[i] || result.GetSuccess() != (expected[i] == codes.OK) {
+			t.Fatalf("Expected operation %d to end with %s got %v", i, expected[i], result)
+		}
+		if !result.GetSuccess() && result.GetError() == "" {
+			t.Fatalf("Expected failed operation %d to say why", i)
+		}
+	}
+
+	request.BatchMode = api.BatchProvisionMessage_bestEffort
+	request.Operations[0].SlotNumber = 99
+	response, err = server.BatchProvision(ctx, request)
+	if err != nil || len(response.GetResults()) != 3 {
+		t.Fatalf("Expected a result per operation got %v %v", response, err)
+	}
+	expected = []codes.Code{codes.InvalidArgument, codes.AlreadyExists, codes.OK}
+	for i, result := range response.GetResults() {
+		if codes.Code(result.GetCode()) != expected[i] {
+			t.Fatalf("Expected operation %d to end with %s in best effort mode got %v", i, expected[i], result)
+		}
+	}
+}
+
+func TestHandler_GetChassisInventory(t *testing.T) {
+	clli := "inventory_clli"
+	defer setupChassis(t, clli)()
+	ctx := context.Background()
+	_, err := impl.ProvisionOnt(ctx, clli, 1, 1, 1, "INVENTORY1", nil)
+	if err != nil {
+		t.Fatalf("ProvisionOnt failed with %v", err)
+	}
+	_, err = impl.PreProvisionOnt(ctx, clli, 1, 2, 3, 10, 20, "NAS3", "CIRCUIT3", "", "", nil)
+	if err != nil {
+		t.Fatalf("PreProvisionOnt failed with %v", err)
+	}
+
+	server := api.Server{}
+	typed, err := server.GetChassisInventory(ctx, &api.InventoryMessage{Clli: clli})
+	if err != nil {
+		t.Fatalf("GetChassisInventory failed with %v", err)
+	}
+	dump, err := server.GetInventory(ctx, &api.InventoryMessage{Clli: clli})
+	if err != nil {
+		t.Fatalf("GetInventory failed with %v", err)
+	}
+	// the typed inventory carries everything the json one does
+	expected := inventory.Chassis{}
+	err = json.Unmarshal([]byte(dump.GetJsonDump()), &expected)
+	if err != nil {
+		t.Fatalf("Unable to read the json inventory %v", err)
+	}
+	chassis := typed.GetChassis()
+	if chassis.GetClli() != clli || int(chassis.GetRack()) != expected.Rack || int(chassis.GetShelf()) != expected.Shelf ||
+		chassis.GetXOSIP() != expected.XOSAddr.IP.String() || int(chassis.GetXOSPort()) != expected.XOSAddr.Port {
+		t.Fatalf("Expected the chassis of %+v got %v", expected, chassis)
+	}
+	if len(chassis.GetLineCards()) != len(expected.LineCards) || len(expected.LineCards) == 0 {
+		t.Fatalf("Expected %d line cards got %v", len(expected.LineCards), chassis.GetLineCards())
+	}
+	onts := 0
+	for i, lineCard := range expected.LineCards {
+		typedLineCard := chassis.GetLineCards()[i]
+		if int(typedLineCard.GetNumber()) != lineCard.Number || len(typedLineCard.GetOlts()) != len(lineCard.Olts) {
+			t.Fatalf("Expected line card %+v got %v", lineCard, typedLineCard)
+		}
+		for j, olt := range lineCard.Olts {
+			typedOlt := typedLineCard.GetOlts()[j]
+			if typedOlt.GetHostname() != olt.Hostname || typedOlt.GetSlotIP() != olt.Address.IP.String() ||
+				int(typedOlt.GetSlotPort()) != olt.Address.Port || len(typedOlt.GetPorts()) != len(olt.Ports) {
+				t.Fatalf("Expected olt %+v got %v", olt, typedOlt)
+			}
+			for k, port := range olt.Ports {
+				typedPort := typedOlt.GetPorts()[k]
+				if int(typedPort.GetAbstractNumber()) != port.AbstractNumber || int(typedPort.GetPhysicalNumber()) != port.PhysicalNumber ||
+					len(typedPort.GetOnts()) != len(port.Onts) {
+					t.Fatalf("Expected port %+v got %v", port, typedPort)
+				}
+				for l, ont := range port.Onts {
+					typedOnt := typedPort.GetOnts()[l]
+					if int(typedOnt.GetNumber()) != ont.Number || typedOnt.GetActive() != ont.Active || typedOnt.GetSuspended() != ont.Suspended ||
+						typedOnt.GetState() != ont.State || typedOnt.GetSVlan() != ont.SVlan || typedOnt.GetCVlan() != ont.CVlan ||
+						typedOnt.GetSerialNumber() != ont.SerialNumber || typedOnt.GetNasPortID() != ont.NasPortID || typedOnt.GetCircuitID() != ont.CircuitID {
+						t.Fatalf("Expected ont %+v got %v", ont, typedOnt)
+					}
+					onts++
+				}
+			}
+		}
+	}
+	if onts != 2 {
+		t.Fatalf("Expected the active and the pre-provisioned ont in the inventory got %d onts", onts)
+	}
+
+	_, err = server.GetChassisInventory(ctx, &api.InventoryMessage{Clli: "no_such_clli"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for a chassis that does not exist got %v", err)
+	}
+	_, err = server.GetChassisInventory(ctx, &api.InventoryMessage{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument without a clli got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2017 the original author or authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"github.com/golang/protobuf/proto"
+	context "golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// metadata a client can send the idempotency key in instead of setting IdempotencyKey on the request
+const idempotencyMetadata = "idempotency-key"
+
+// every mutating request has an IdempotencyKey field
+type idempotentRequest interface {
+	proto.Message
+	GetIdempotencyKey() string
+}
+
+type dryRunRequest interface {
+	GetDryRun() bool
+}
+
+/*
+IdempotencyInterceptor - records the response of a mutating rpc made with an idempotency key and replays it,
+error included, when the same rpc is repeated with that key instead of applying the change twice,
+reusing a key with a different request is rejected. Failures the client is expected to retry are not recorded
+*/
+func IdempotencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	request, ok := req.(idempotentRequest)
+	if !ok {
+		return handler(ctx, req)
+	}
+	if dryRun, ok := req.(dryRunRequest); ok && dryRun.GetDryRun() {
+		return handler(ctx, req)
+	}
+	key := request.GetIdempotencyKey()
+	if key == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[idempotencyMetadata]) > 0 {
+			key = md[idempotencyMetadata][0]
+		}
+	}
+	if key == "" {
+		return handler(ctx, req)
+	}
+	hash, err := requestHash(request)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	key = info.FullMethod + " " + key
+	result, err := impl.BeginIdempotent(ctx, key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if result != nil {
+		if result.RequestHash != hash {
+			return nil, invalidArgument("IdempotencyKey", "IdempotencyKey was already used for a different request")
+		}
+		return replay(result)
+	}
+	// deferred so the key is released even when the handler panics, duplicates waiting on it would hang otherwise
+	defer func() {
+		impl.FinishIdempotent(key, result)
+	}()
+	response, err := handler(ctx, req)
+	result = record(hash, response, err)
+	return response, err
+}
+
+func requestHash(request proto.Message) (string, error) {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// returns nil when the outcome cannot be recorded or may change when the call is retried, leaving the key free for
+// the retry
+func record(hash string, response interface{}, err error) *impl.IdempotentResult {
+	result := &impl.IdempotentResult{RequestHash: hash}
+	if err != nil {
+		st := status.Convert(err)
+		if transient(st) {
+			return nil
+		}
+		data, marshalErr := proto.Marshal(st.Proto())
+		if marshalErr != nil {
+			return nil
+		}
+		result.Status = data
+		return result
+	}
+	message, ok := response.(proto.Message)
+	if !ok {
+		return nil
+	}
+	data, marshalErr := proto.Marshal(message)
+	if marshalErr != nil {
+		return nil
+	}
+	result.ResponseType = proto.MessageName(message)
+	result.Response = data
+	return result
+}
+
+/*
+transient - true when st is a failure the client is expected to retry, because XOS could not be reached in time, the
+call was cancelled or it carries a RetryInfo
+*/
+func transient(st *status.Status) bool {
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	for _, detail := range st.Details() {
+		if _, ok := detail.(*errdetails.RetryInfo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func replay(result *impl.IdempotentResult) (interface{}, error) {
+	if result.Status != nil {
+		st := &spb.Status{}
+		err := proto.Unmarshal(result.Status, st)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return nil, status.ErrorProto(st)
+	}
+	messageType := proto.MessageType(result.ResponseType)
+	if messageType == nil {
+		return nil, status.Errorf(codes.Internal, "Unknown recorded response type %s", result.ResponseType)
+	}
+	response := reflect.New(messageType.Elem()).Interface().(proto.Message)
+	err := proto.Unmarshal(result.Response, response)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return response, nil
+}
@@ -0,0 +1,126 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package api_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/api"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+countingHandler - answers with each of the errors in turn, then with success, counting the calls it gets
+*/
+func countingHandler(calls *int, errs ...error) grpc.UnaryHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		*calls++
+		if *calls <= len(errs) && errs[*calls-1] != nil {
+			return nil, errs[*calls-1]
+		}
+		return &api.AddOntReturn{Success: true}, nil
+	}
+}
+
+var provisionOnt = &grpc.UnaryServerInfo{FullMethod: "/api.AbstractOLT/ProvisionOnt"}
+
+/*
+uniqueKey - an idempotency key no earlier run of the tests recorded, keys are kept for the whole process
+*/
+func uniqueKey(name string) string {
+	return fmt.Sprintf("%s %d", name, time.Now().UnixNano())
+}
+
+func TestIdempotencyInterceptor_Replay(t *testing.T) {
+	calls := 0
+	handler := countingHandler(&calls)
+	request := &api.AddOntMessage{CLLI: "idempotent_clli", SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: "SERIAL1", IdempotencyKey: uniqueKey("replay")}
+	for i := 0; i < 2; i++ {
+		response, err := api.IdempotencyInterceptor(context.Background(), request, provisionOnt, handler)
+		if err != nil || !response.(*api.AddOntReturn).GetSuccess() {
+			t.Fatalf("Expected the recorded success got %v %v", response, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected the change to be applied once got %d calls", calls)
+	}
+
+	changed := *request
+	changed.SerialNumber = "SERIAL2"
+	_, err := api.IdempotencyInterceptor(context.Background(), &changed, provisionOnt, handler)
+	if status.Code(err) != codes.InvalidArgument || calls != 1 {
+		t.Fatalf("Expected InvalidArgument reusing the key for another request got %v", err)
+	}
+}
+
+func TestIdempotencyInterceptor_Errors(t *testing.T) {
+	calls := 0
+	handler := countingHandler(&calls, status.Error(codes.FailedPrecondition, "ont is not active"))
+	request := &api.AddOntMessage{CLLI: "idempotent_clli", IdempotencyKey: uniqueKey("failed")}
+	for i := 0; i < 2; i++ {
+		_, err := api.IdempotencyInterceptor(context.Background(), request, provisionOnt, handler)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected the recorded FailedPrecondition got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected a failure that is not transient to be replayed got %d calls", calls)
+	}
+
+	// a call that timed out is run again when it is retried with the same key
+	for _, code := range []codes.Code{codes.DeadlineExceeded, codes.Unavailable, codes.Canceled} {
+		calls = 0
+		handler = countingHandler(&calls, status.Error(code, "XOS did not answer"))
+		request = &api.AddOntMessage{CLLI: "idempotent_clli", IdempotencyKey: uniqueKey("transient " + code.String())}
+		_, err := api.IdempotencyInterceptor(context.Background(), request, provisionOnt, handler)
+		if status.Code(err) != code {
+			t.Fatalf("Expected %s got %v", code, err)
+		}
+		response, err := api.IdempotencyInterceptor(context.Background(), request, provisionOnt, handler)
+		if err != nil || calls != 2 || !response.(*api.AddOntReturn).GetSuccess() {
+			t.Fatalf("Expected the retry after %s to run got %v %v after %d calls", code, response, err, calls)
+		}
+	}
+}
+
+func TestIdempotencyInterceptor_Panic(t *testing.T) {
+	request := &api.AddOntMessage{CLLI: "idempotent_clli", IdempotencyKey: uniqueKey("panic")}
+	panicking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("handler failed")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected the handler panic to reach the caller")
+			}
+		}()
+		api.IdempotencyInterceptor(context.Background(), request, provisionOnt, panicking)
+	}()
+
+	// the key was released so the retry runs instead of waiting for a result that never comes
+	calls := 0
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := api.IdempotencyInterceptor(ctx, request, provisionOnt, countingHandler(&calls))
+	if err != nil || calls != 1 || !response.(*api.AddOntReturn).GetSuccess() {
+		t.Fatalf("Expected the retry after a panic to run got %v %v after %d calls", response, err, calls)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package api
+
+import "gerrit.opencord.org/abstract-olt/models/inventory"
+
+/*
+toInventoryChassis - converts the inventory model of a chassis into its protobuf representation
+*/
+func toInventoryChassis(chassis inventory.Chassis) *InventoryChassis {
+	lineCards := make([]*InventoryLineCard, 0, len(chassis.LineCards))
+	for _, lineCard := range chassis.LineCards {
+		olts := make([]*InventoryOlt, 0, len(lineCard.Olts))
+		for _, olt := range lineCard.Olts {
+			olts = append(olts, toInventoryOlt(olt))
+		}
+		lineCards = append(lineCards, &InventoryLineCard{Number: int32(lineCard.Number), Olts: olts})
+	}
+	return &InventoryChassis{
+		Clli:      chassis.Clli,
+		Rack:      int32(chassis.Rack),
+		Shelf:     int32(chassis.Shelf),
+		XOSIP:     chassis.XOSAddr.IP.String(),
+		XOSPort:   int32(chassis.XOSAddr.Port),
+		LineCards: lineCards,
+	}
+}
+
+func toInventoryOlt(olt inventory.PhysicalOlt) *InventoryOlt {
+	ports := make([]*InventoryPort, 0, len(olt.Ports))
+	for _, port := range olt.Ports {
+		onts := make([]*InventoryOnt, 0, len(port.Onts))
+		for _, ont := range port.Onts {
+			onts = append(onts, &InventoryOnt{
+				Number:       int32(ont.Number),
+				Active:       ont.Active,
+				Suspended:    ont.Suspended,
+				State:        ont.State,
+				SVlan:        ont.SVlan,
+				CVlan:        ont.CVlan,
+				SerialNumber: ont.SerialNumber,
+				NasPortID:    ont.NasPortID,
+				CircuitID:    ont.CircuitID,
+			})
+		}
+		ports = append(ports, &InventoryPort{AbstractNumber: int32(port.AbstractNumber), PhysicalNumber: int32(port.PhysicalNumber), Onts: onts})
+	}
+	return &InventoryOlt{SlotIP: olt.Address.IP.String(), SlotPort: int32(olt.Address.Port), Hostname: olt.Hostname, Ports: ports}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2017 the original author or authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package api
+
+import (
+	"reflect"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	context "golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// set on the context of calls made by the job workers so they are handled rather than queued again
+type jobContextKey struct{}
+
+// every mutating request has DryRun and Async fields
+type asyncRequest interface {
+	proto.Message
+	GetDryRun() bool
+	GetAsync() bool
+}
+
+type jobMethod func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error)
+
+// the rpcs that can be run as jobs, keyed by the method name submitAsync records
+var jobMethods = map[string]jobMethod{
+	"CreateChassis": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.CreateChassis(ctx, in.(*AddChassisMessage))
+	},
+	"DeleteChassis": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.DeleteChassis(ctx, in.(*DeleteChassisMessage))
+	},
+	"ChangeXOSUserPassword": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ChangeXOSUserPassword(ctx, in.(*ChangeXOSUserPasswordMessage))
+	},
+	"CreateOLTChassis": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.CreateOLTChassis(ctx, in.(*AddOLTChassisMessage))
+	},
+	"RemoveOLTChassis": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.RemoveOLTChassis(ctx, in.(*RemoveOLTChassisMessage))
+	},
+	"ReplaceOLTChassis": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ReplaceOLTChassis(ctx, in.(*ReplaceOLTChassisMessage))
+	},
+	"ProvisionOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ProvisionOnt(ctx, in.(*AddOntMessage))
+	},
+	"ProvisionOntFull": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ProvisionOntFull(ctx, in.(*AddOntFullMessage))
+	},
+	"PreProvisionOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.PreProvisionOnt(ctx, in.(*PreProvisionOntMessage))
+	},
+	"ActivateSerial": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ActivateSerial(ctx, in.(*AddOntMessage))
+	},
+	"DeleteOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.DeleteOnt(ctx, in.(*DeleteOntMessage))
+	},
+	"ModifyOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ModifyOnt(ctx, in.(*ModifyOntMessage))
+	},
+	"PutOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.PutOnt(ctx, in.(*PutOntMessage))
+	},
+	"SuspendOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.SuspendOnt(ctx, in.(*SuspendOntMessage))
+	},
+	"ResumeOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ResumeOnt(ctx, in.(*ResumeOntMessage))
+	},
+	"ReplaceOntSerial": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.ReplaceOntSerial(ctx, in.(*ReplaceOntSerialMessage))
+	},
+	"MoveOnt": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.MoveOnt(ctx, in.(*MoveOntMessage))
+	},
+	"BatchProvision": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.BatchProvision(ctx, in.(*BatchProvisionMessage))
+	},
+	"RestoreBackup": func(s *Server, ctx context.Context, in proto.Message) (proto.Message, error) {
+		return s.RestoreBackup(ctx, in.(*RestoreBackupMessage))
+	},
+}
+
+/*
+submitAsync - queues in as a job on the chassis clli when it asked for async mode, ok is false when the call should be
+handled now, which dry runs and the calls made by the job workers always are
+*/
+func submitAsync(ctx context.Context, method string, clli string, in asyncRequest) (string, bool, error) {
+	if !in.GetAsync() || in.GetDryRun() || ctx.Value(jobContextKey{}) != nil {
+		return "", false, nil
+	}
+	data, err := proto.Marshal(in)
+	if err != nil {
+		return "", true, toStatus(err)
+	}
+	jobID, err := impl.SubmitJob(method, clli, proto.MessageName(in), data)
+	return jobID, true, toStatus(err)
+}
+
+/*
+RunJob - the impl.JobRunner that replays the request of job against s, it is retried when it failed with an error
+carrying RetryInfo
+*/
+func (s *Server) RunJob(ctx context.Context, job impl.Job) (impl.JobResult, bool) {
+	method, ok := jobMethods[job.Method]
+	if !ok {
+		return jobResult(nil, status.Errorf(codes.Internal, "Unknown job method %s", job.Method)), false
+	}
+	messageType := proto.MessageType(job.RequestType)
+	if messageType == nil {
+		return jobResult(nil, status.Errorf(codes.Internal, "Unknown job request type %s", job.RequestType)), false
+	}
+	in := reflect.New(messageType.Elem()).Interface().(proto.Message)
+	err := proto.Unmarshal(job.Request, in)
+	if err != nil {
+		return jobResult(nil, toStatus(err)), false
+	}
+	response, err := method(s, context.WithValue(ctx, jobContextKey{}, job.ID), in)
+	return jobResult(response, err), err != nil && retryable(err)
+}
+
+func jobResult(response interface{}, err error) impl.JobResult {
+	result := record("", response, err)
+	if result == nil {
+		result = record("", nil, status.Error(codes.Internal, "Unable to record the result of the job"))
+	}
+	return impl.JobResult{ResponseType: result.ResponseType, Response: result.Response, Status: result.Status}
+}
+
+// toStatus adds RetryInfo to errors that leave the request safe to repeat
+func retryable(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if _, ok := detail.(*errdetails.RetryInfo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+toJob - converts an impl.Job to the api Job, Result is the response of a succeeded job as json
+*/
+func toJob(job impl.Job) *Job {
+	out := &Job{
+		ID:       job.ID,
+		Method:   job.Method,
+		CLLI:     job.CLLI,
+		State:    Job_JobState(job.State),
+		Attempts: int32(job.Attempts),
+		Created:  job.Created.Unix(),
+		Updated:  job.Updated.Unix(),
+	}
+	if job.State == impl.JobRetrying {
+		out.NextAttempt = job.NextAttempt.Unix()
+	}
+	if job.Status == nil && job.Response == nil {
+		return out
+	}
+	response, err := replay(&impl.IdempotentResult{ResponseType: job.ResponseType, Response: job.Response, Status: job.Status})
+	if err != nil {
+		st := status.Convert(err)
+		out.Code = int32(st.Code())
+		out.Error = st.Message()
+		return out
+	}
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	out.Result, _ = marshaler.MarshalToString(response.(proto.Message))
+	return out
+}
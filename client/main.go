@@ -21,12 +21,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"runtime/debug"
 	"strings"
 
 	"gerrit.opencord.org/abstract-olt/api"
+	"github.com/golang/protobuf/jsonpb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -34,16 +37,31 @@ func main() {
 	echo := flag.Bool("e", false, "echo")
 	create := flag.Bool("c", false, "create?")
 	update := flag.Bool("u", false, "update?")
+	deleteChassis := flag.Bool("delete_chassis", false, "deleteChassis?")
 	addOlt := flag.Bool("s", false, "addOlt?")
+	removeOlt := flag.Bool("remove_olt", false, "removeOlt?")
+	replaceOlt := flag.Bool("replace_olt", false, "replaceOlt?")
 	provOnt := flag.Bool("o", false, "provisionOnt?")
 	provOntFull := flag.Bool("f", false, "provsionOntFull?")
 	preProvOnt := flag.Bool("p", false, "preProvisionOnt?")
 	activateSerial := flag.Bool("a", false, "activateSerial?")
 	deleteOnt := flag.Bool("d", false, "deleteOnt")
+	modifyOnt := flag.Bool("modify_ont", false, "change vlans, NasPortID, CircuitID or profiles of an active ont")
+	moveOnt := flag.Bool("move_ont", false, "move an active ont to another slot/port/ont")
+	suspendOnt := flag.Bool("suspend_ont", false, "cut service to an active ont keeping its provisioning")
+	resumeOnt := flag.Bool("resume_ont", false, "restore service to a suspended ont")
+	replaceSerial := flag.Bool("replace_serial", false, "give an active ont the serial number of its replacement hardware")
 	output := flag.Bool("output", false, "dump output")
 	reflow := flag.Bool("reflow", false, "reflow provisioning tosca")
 	fullInventory := flag.Bool("full_inventory", false, "pull full inventory json")
 	inventory := flag.Bool("inventory", false, "pull json inventory for a specific clli")
+	fullChassisInventory := flag.Bool("full_chassis_inventory", false, "pull full inventory as protobuf messages")
+	chassisInventory := flag.Bool("chassis_inventory", false, "pull inventory as protobuf messages for a specific clli")
+	watch := flag.Bool("watch", false, "stream provisioning events")
+	batch := flag.Bool("batch", false, "apply a batch of ont operations from a json file")
+	findOnt := flag.Bool("find_ont", false, "find an ont by serial number, circuit id or nas port id")
+	getOnt := flag.Bool("get_ont", false, "show the ont at a slot/port/ont")
+	putOnt := flag.Bool("put_ont", false, "provision the ont at a slot/port/ont or bring an existing one in line")
 	/* END COMMAND FLAGS */
 
 	/* CREATE CHASSIS FLAGS */
@@ -55,6 +73,10 @@ func main() {
 	shelf := flag.Uint("shelf", 1, "shelf number for chassis")
 	/* END CREATE CHASSIS FLAGS */
 
+	/* DELETE CHASSIS FLAGS */
+	force := flag.Bool("force", false, "delete chassis or remove olt even if it still has active onts")
+	/* END DELETE CHASSIS FLAGS */
+
 	/* ADD OLT FLAGS */
 	oltAddress := flag.String("olt_address", "", "ip address for olt chassis")
 	oltPort := flag.Uint("olt_port", 0, "listen port for olt chassis")
@@ -63,6 +85,32 @@ func main() {
 	oltType := flag.String("type", "", "olt chassis type")
 	/* END ADD OLT FLAGS */
 
+	/* FIND ONT FLAGS */
+	searchBy := flag.String("search_by", "serialNumber", "ont field to search on")
+	value := flag.String("value", "", "value to search for")
+	/* END FIND ONT FLAGS */
+
+	/* BATCH FLAGS */
+	batchFile := flag.String("batch_file", "", "json file holding the operations of a BatchProvisionMessage")
+	bestEffort := flag.Bool("best_effort", false, "keep going after a failed operation in a batch")
+	/* END BATCH FLAGS */
+
+	/* WATCH FLAGS */
+	eventTypes := flag.String("event_types", "", "comma separated list of event types to watch")
+	/* END WATCH FLAGS */
+
+	/* MOVE ONT FLAGS */
+	destCLLI := flag.String("dest_clli", "", "clli to move ont to, defaults to -clli")
+	destSlot := flag.Uint("dest_slot", 1, "slot number 1-16 to move ont to")
+	destPort := flag.Uint("dest_port", 1, "port number 1-16 to move ont to")
+	destOnt := flag.Uint("dest_ont", 1, "ont number 1-64 to move ont to")
+	recompute := flag.Bool("recompute", false, "recompute vlans, NasPortID and CircuitID for the new position instead of keeping them")
+	/* END MOVE ONT FLAGS */
+
+	/* REPLACE OLT FLAGS */
+	newName := flag.String("new_name", "", "friendly name for replacement olt chassis")
+	/* END REPLACE OLT FLAGS */
+
 	/* PROVISION / DELETE ONT FLAGS */
 	slot := flag.Uint("slot", 1, "slot number 1-16 to provision ont to")
 	port := flag.Uint("port", 1, "port number 1-16 to provision ont to")
@@ -88,6 +136,8 @@ func main() {
 
 	/*GENERIC FLAGS */
 	clli := flag.String("clli", "", "clli of abstract chassis")
+	dryRun := flag.Bool("dry_run", false, "validate the change and print what would be sent to XOS without applying it")
+	idempotencyKey := flag.String("idempotency_key", "", "key that makes retrying a change replay the first result instead of applying it twice")
 	useSsl := flag.Bool("ssl", false, "use ssl")
 	useAuth := flag.Bool("auth", false, "use auth")
 	crtFile := flag.String("cert", "cert/server.crt", "Public cert for server to establish tls session")
@@ -104,7 +154,7 @@ func main() {
 		}
 	}
 
-	cmdFlags := []*bool{echo, addOlt, update, create, provOnt, preProvOnt, activateSerial, provOntFull, deleteOnt, output, reflow, fullInventory, inventory}
+	cmdFlags := []*bool{echo, addOlt, update, create, deleteChassis, removeOlt, replaceOlt, provOnt, preProvOnt, activateSerial, provOntFull, deleteOnt, modifyOnt, moveOnt, replaceSerial, suspendOnt, resumeOnt, output, reflow, fullInventory, inventory, fullChassisInventory, chassisInventory, watch, batch, findOnt, getOnt, putOnt}
 	cmdCount := 0
 	for _, flag := range cmdFlags {
 		if *flag {
@@ -124,6 +174,10 @@ func main() {
 
 	var conn *grpc.ClientConn
 	var err error
+	var dialOptions []grpc.DialOption
+	if *idempotencyKey != "" {
+		dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(withIdempotencyKey(*idempotencyKey)))
+	}
 
 	// Setup the login/pass
 	auth := Authentication{
@@ -133,20 +187,20 @@ func main() {
 	if *useSsl && *useAuth {
 
 		creds, err := credentials.NewClientTLSFromFile(*crtFile, *fqdn)
-		conn, err = grpc.Dial(*serverAddressPort, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(&auth))
+		conn, err = grpc.Dial(*serverAddressPort, append(dialOptions, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(&auth))...)
 		if err != nil {
 			log.Fatalf("could not load tls cert: %s", err)
 		}
 	} else if *useSsl {
 		creds, err := credentials.NewClientTLSFromFile("cert/server.crt", *fqdn)
-		conn, err = grpc.Dial(*serverAddressPort, grpc.WithTransportCredentials(creds))
+		conn, err = grpc.Dial(*serverAddressPort, append(dialOptions, grpc.WithTransportCredentials(creds))...)
 		if err != nil {
 			log.Fatalf("could not load tls cert: %s", err)
 		}
 	} else if *useAuth {
-		conn, err = grpc.Dial(*serverAddressPort, grpc.WithInsecure(), grpc.WithPerRPCCredentials(&auth))
+		conn, err = grpc.Dial(*serverAddressPort, append(dialOptions, grpc.WithInsecure(), grpc.WithPerRPCCredentials(&auth))...)
 	} else {
-		conn, err = grpc.Dial(*serverAddressPort, grpc.WithInsecure())
+		conn, err = grpc.Dial(*serverAddressPort, append(dialOptions, grpc.WithInsecure())...)
 	}
 	if err != nil {
 		log.Fatalf("did not connect: %s", err)
@@ -155,35 +209,73 @@ func main() {
 
 	c := api.NewAbstractOLTClient(conn)
 	if *create {
-		createChassis(c, clli, xosUser, xosPassword, xosAddress, xosPort, rack, shelf)
+		createChassis(c, clli, xosUser, xosPassword, xosAddress, xosPort, rack, shelf, dryRun)
 	} else if *update {
-		updateXOSUserPassword(c, clli, xosUser, xosPassword)
+		updateXOSUserPassword(c, clli, xosUser, xosPassword, dryRun)
+	} else if *deleteChassis {
+		deleteAbstractChassis(c, clli, force, dryRun)
 	} else if *addOlt {
-		addOltChassis(c, clli, oltAddress, oltPort, name, driver, oltType)
+		addOltChassis(c, clli, oltAddress, oltPort, name, driver, oltType, dryRun)
+	} else if *removeOlt {
+		removeOltChassis(c, clli, name, force, dryRun)
+	} else if *replaceOlt {
+		replaceOltChassis(c, clli, name, oltAddress, oltPort, driver, newName, dryRun)
 	} else if *provOnt {
-		provisionONT(c, clli, slot, port, ont, serial)
+		provisionONT(c, clli, slot, port, ont, serial, dryRun)
 	} else if *provOntFull {
-		provisionONTFull(c, clli, slot, port, ont, serial, stag, ctag, nasPort, circuitID)
+		provisionONTFull(c, clli, slot, port, ont, serial, stag, ctag, nasPort, circuitID, dryRun)
 	} else if *preProvOnt {
-		preProvisionOnt(c, clli, slot, port, ont, stag, ctag, nasPort, circuitID, techProfile, speedProfile)
+		preProvisionOnt(c, clli, slot, port, ont, stag, ctag, nasPort, circuitID, techProfile, speedProfile, dryRun)
 	} else if *activateSerial {
-		activateSerialNumber(c, clli, slot, port, ont, serial)
+		activateSerialNumber(c, clli, slot, port, ont, serial, dryRun)
 	} else if *echo {
 		ping(c, *message)
 	} else if *output {
 		doOutput(c)
 	} else if *deleteOnt {
-		deleteONT(c, clli, slot, port, ont, serial)
+		deleteONT(c, clli, slot, port, ont, serial, dryRun)
+	} else if *modifyOnt {
+		modifyONT(c, clli, slot, port, ont, stag, ctag, nasPort, circuitID, techProfile, speedProfile, dryRun)
+	} else if *suspendOnt {
+		suspendONT(c, clli, slot, port, ont, dryRun)
+	} else if *resumeOnt {
+		resumeONT(c, clli, slot, port, ont, dryRun)
+	} else if *replaceSerial {
+		replaceSerialNumber(c, clli, slot, port, ont, serial, dryRun)
+	} else if *moveOnt {
+		moveONT(c, clli, slot, port, ont, destCLLI, destSlot, destPort, destOnt, recompute, dryRun)
 	} else if *reflow {
 		reflowTosca(c)
 	} else if *fullInventory {
 		getFullInventory(c)
 	} else if *inventory {
 		getInventory(c, clli)
+	} else if *fullChassisInventory {
+		getFullChassisInventory(c)
+	} else if *chassisInventory {
+		getChassisInventory(c, clli)
+	} else if *findOnt {
+		findONT(c, searchBy, value)
+	} else if *getOnt {
+		getONT(c, clli, slot, port, ont)
+	} else if *putOnt {
+		putONT(c, clli, slot, port, ont, serial, stag, ctag, nasPort, circuitID, techProfile, speedProfile, dryRun)
+	} else if *batch {
+		batchProvision(c, clli, batchFile, bestEffort, dryRun)
+	} else if *watch {
+		watchEvents(c, clli, eventTypes)
 	}
 
 }
 
+// withIdempotencyKey sends key as metadata on every call so the server can recognise a retried change
+func withIdempotencyKey(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", key)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
 // Authentication holds the login/password
 type Authentication struct {
 	Login    string
@@ -223,7 +315,7 @@ func ping(c api.AbstractOLTClient, message string) error {
 	return nil
 }
 
-func createChassis(c api.AbstractOLTClient, clli *string, xosUser *string, xosPassword *string, xosAddress *string, xosPort *uint, rack *uint, shelf *uint) error {
+func createChassis(c api.AbstractOLTClient, clli *string, xosUser *string, xosPassword *string, xosAddress *string, xosPort *uint, rack *uint, shelf *uint, dryRun *bool) error {
 	fmt.Println("Calling Create Chassis")
 	fmt.Println("clli", *clli)
 	fmt.Println("xos_user", *xosUser)
@@ -233,29 +325,45 @@ func createChassis(c api.AbstractOLTClient, clli *string, xosUser *string, xosPa
 	fmt.Println("rack", *rack)
 	fmt.Println("shelf", *shelf)
 	response, err := c.CreateChassis(context.Background(), &api.AddChassisMessage{CLLI: *clli, XOSUser: *xosUser, XOSPassword: *xosPassword,
-		XOSIP: *xosAddress, XOSPort: int32(*xosPort), Rack: int32(*rack), Shelf: int32(*shelf)})
+		XOSIP: *xosAddress, XOSPort: int32(*xosPort), Rack: int32(*rack), Shelf: int32(*shelf), DryRun: *dryRun})
 	if err != nil {
 		fmt.Printf("Error when calling CreateChassis: %s", err)
 		return err
 	}
 	log.Printf("Response from server: %s", response.GetDeviceID())
+	printSouthbound(response.GetSouthbound())
 	return nil
 }
-func updateXOSUserPassword(c api.AbstractOLTClient, clli *string, xosUser *string, xosPassword *string) error {
+func updateXOSUserPassword(c api.AbstractOLTClient, clli *string, xosUser *string, xosPassword *string, dryRun *bool) error {
 	fmt.Println("Calling Update XOS USER/PASSWORD")
 	fmt.Println("clli", *clli)
 	fmt.Println("xos_user", *xosUser)
 	fmt.Println("xos_password", *xosPassword)
-	response, err := c.ChangeXOSUserPassword(context.Background(), &api.ChangeXOSUserPasswordMessage{CLLI: *clli, XOSUser: *xosUser, XOSPassword: *xosPassword})
+	response, err := c.ChangeXOSUserPassword(context.Background(), &api.ChangeXOSUserPasswordMessage{CLLI: *clli, XOSUser: *xosUser, XOSPassword: *xosPassword, DryRun: *dryRun})
 	if err != nil {
 		fmt.Printf("Error when calling UpdateXOSUserPassword: %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", response.GetSuccess())
+	printSouthbound(response.GetSouthbound())
+	return nil
+}
+
+func deleteAbstractChassis(c api.AbstractOLTClient, clli *string, force *bool, dryRun *bool) error {
+	fmt.Println("Calling Delete Chassis")
+	fmt.Println("clli", *clli)
+	fmt.Println("force", *force)
+	response, err := c.DeleteChassis(context.Background(), &api.DeleteChassisMessage{CLLI: *clli, Force: *force, DryRun: *dryRun})
+	if err != nil {
+		fmt.Printf("Error when calling DeleteChassis: %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t", response.GetSuccess())
+	printSouthbound(response.GetSouthbound())
 	return nil
 }
 
-func addOltChassis(c api.AbstractOLTClient, clli *string, oltAddress *string, oltPort *uint, name *string, driver *string, oltType *string) error {
+func addOltChassis(c api.AbstractOLTClient, clli *string, oltAddress *string, oltPort *uint, name *string, driver *string, oltType *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("olt_address", *oltAddress)
 	fmt.Println("olt_port", *oltPort)
@@ -274,31 +382,66 @@ func addOltChassis(c api.AbstractOLTClient, clli *string, oltAddress *string, ol
 
 	}
 
-	res, err := c.CreateOLTChassis(context.Background(), &api.AddOLTChassisMessage{CLLI: *clli, SlotIP: *oltAddress, SlotPort: uint32(*oltPort), Hostname: *name, Type: chassisType, Driver: driverType})
+	res, err := c.CreateOLTChassis(context.Background(), &api.AddOLTChassisMessage{CLLI: *clli, SlotIP: *oltAddress, SlotPort: uint32(*oltPort), Hostname: *name, Type: chassisType, Driver: driverType, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling CreateOLTChassis: %s", err)
 		return err
 	}
 	log.Printf("Response from server: %s", res.GetDeviceID())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
-func provisionONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string) error {
+func removeOltChassis(c api.AbstractOLTClient, clli *string, name *string, force *bool, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("name", *name)
+	fmt.Println("force", *force)
+	res, err := c.RemoveOLTChassis(context.Background(), &api.RemoveOLTChassisMessage{CLLI: *clli, Hostname: *name, Force: *force, DryRun: *dryRun})
+	if err != nil {
+		fmt.Printf("Error when calling RemoveOLTChassis: %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+
+func replaceOltChassis(c api.AbstractOLTClient, clli *string, name *string, oltAddress *string, oltPort *uint, driver *string, newName *string, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("name", *name)
+	fmt.Println("olt_address", *oltAddress)
+	fmt.Println("olt_port", *oltPort)
+	fmt.Println("driver", *driver)
+	fmt.Println("new_name", *newName)
+	driverType := api.AddOLTChassisMessage_OltDriver(api.AddOLTChassisMessage_OltDriver_value[*driver])
+	res, err := c.ReplaceOLTChassis(context.Background(), &api.ReplaceOLTChassisMessage{CLLI: *clli, Hostname: *name, SlotIP: *oltAddress, SlotPort: uint32(*oltPort),
+		Driver: driverType, NewHostname: *newName, DryRun: *dryRun})
+	if err != nil {
+		fmt.Printf("Error when calling ReplaceOLTChassis: %s", err)
+		return err
+	}
+	log.Printf("Response from server: %s", res.GetDeviceID())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+
+func provisionONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("slot", *slot)
 	fmt.Println("port", *port)
 	fmt.Println("ont", *ont)
 	fmt.Println("serial", *serial)
-	res, err := c.ProvisionOnt(context.Background(), &api.AddOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial})
+	res, err := c.ProvisionOnt(context.Background(), &api.AddOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling ProvsionOnt %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
-func preProvisionOnt(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, stag *uint, ctag *uint, nasPort *string, circuitID *string, techProfile *string, speedProfile *string) error {
+func preProvisionOnt(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, stag *uint, ctag *uint, nasPort *string, circuitID *string, techProfile *string, speedProfile *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("slot", *slot)
 	fmt.Println("port", *port)
@@ -310,31 +453,33 @@ func preProvisionOnt(c api.AbstractOLTClient, clli *string, slot *uint, port *ui
 	fmt.Println("tech_profile", *techProfile)
 	fmt.Println("speed_profile", *speedProfile)
 	res, err := c.PreProvisionOnt(context.Background(), &api.PreProvisionOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port),
-		OntNumber: int32(*ont), STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID, TechProfile: *techProfile, SpeedProfile: *speedProfile})
+		OntNumber: int32(*ont), STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID, TechProfile: *techProfile, SpeedProfile: *speedProfile, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling ProvsionOnt %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
-func activateSerialNumber(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string) error {
+func activateSerialNumber(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("slot", *slot)
 	fmt.Println("port", *port)
 	fmt.Println("ont", *ont)
 	fmt.Println("serial", *serial)
-	res, err := c.ActivateSerial(context.Background(), &api.AddOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial})
+	res, err := c.ActivateSerial(context.Background(), &api.AddOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling ActivateSerial %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
-func provisionONTFull(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, stag *uint, ctag *uint, nasPort *string, circuitID *string) error {
+func provisionONTFull(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, stag *uint, ctag *uint, nasPort *string, circuitID *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("slot", *slot)
 	fmt.Println("port", *port)
@@ -344,28 +489,125 @@ func provisionONTFull(c api.AbstractOLTClient, clli *string, slot *uint, port *u
 	fmt.Println("ctag", *ctag)
 	fmt.Println("nasPort", *nasPort)
 	fmt.Println("circuitID", *circuitID)
-	res, err := c.ProvisionOntFull(context.Background(), &api.AddOntFullMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial, STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID})
+	res, err := c.ProvisionOntFull(context.Background(), &api.AddOntFullMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial, STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling ProvsionOnt %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
-func deleteONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string) error {
+func deleteONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, dryRun *bool) error {
 	fmt.Println("clli", *clli)
 	fmt.Println("slot", *slot)
 	fmt.Println("port", *port)
 	fmt.Println("ont", *ont)
 	fmt.Println("serial", *serial)
-	res, err := c.DeleteOnt(context.Background(), &api.DeleteOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial})
+	res, err := c.DeleteOnt(context.Background(), &api.DeleteOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), SerialNumber: *serial, DryRun: *dryRun})
 	if err != nil {
 		debug.PrintStack()
 		fmt.Printf("Error when calling ProvsionOnt %s", err)
 		return err
 	}
 	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+func modifyONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, stag *uint, ctag *uint, nasPort *string, circuitID *string, techProfile *string, speedProfile *string, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	fmt.Println("stag", *stag)
+	fmt.Println("ctag", *ctag)
+	fmt.Println("nasPort", *nasPort)
+	fmt.Println("circuitID", *circuitID)
+	fmt.Println("tech_profile", *techProfile)
+	fmt.Println("speed_profile", *speedProfile)
+	res, err := c.ModifyOnt(context.Background(), &api.ModifyOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont),
+		STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID, TechProfile: *techProfile, SpeedProfile: *speedProfile, DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling ModifyOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t changed %s", res.GetSuccess(), strings.Join(res.GetChangedFields(), ","))
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+func suspendONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	res, err := c.SuspendOnt(context.Background(), &api.SuspendOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling SuspendOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+func resumeONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	res, err := c.ResumeOnt(context.Background(), &api.ResumeOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont), DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling ResumeOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+func replaceSerialNumber(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	fmt.Println("serial", *serial)
+	res, err := c.ReplaceOntSerial(context.Background(), &api.ReplaceOntSerialMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port),
+		OntNumber: int32(*ont), SerialNumber: *serial, DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling ReplaceOntSerial %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t replaced %s", res.GetSuccess(), res.GetPreviousSerialNumber())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+func moveONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, destCLLI *string, destSlot *uint, destPort *uint, destOnt *uint, recompute *bool, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	fmt.Println("dest_clli", *destCLLI)
+	fmt.Println("dest_slot", *destSlot)
+	fmt.Println("dest_port", *destPort)
+	fmt.Println("dest_ont", *destOnt)
+	fmt.Println("recompute", *recompute)
+	identity := api.MoveOntMessage_keep
+	if *recompute {
+		identity = api.MoveOntMessage_recompute
+	}
+	res, err := c.MoveOnt(context.Background(), &api.MoveOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont),
+		DestinationCLLI: *destCLLI, DestinationSlotNumber: int32(*destSlot), DestinationPortNumber: int32(*destPort), DestinationOntNumber: int32(*destOnt),
+		SubscriberIdentity: identity, DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling MoveOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t stag %d ctag %d NasPortID %s CircuitID %s", res.GetSuccess(), res.GetSTag(), res.GetCTag(), res.GetNasPortID(), res.GetCircuitID())
+	printSouthbound(res.GetSouthbound())
 	return nil
 }
 func reflowTosca(c api.AbstractOLTClient) error {
@@ -398,12 +640,153 @@ func getInventory(c api.AbstractOLTClient, clli *string) error {
 	log.Println(res.GetJsonDump())
 	return nil
 }
+func getFullChassisInventory(c api.AbstractOLTClient) error {
+	res, err := c.GetFullChassisInventory(context.Background(), &api.FullInventoryMessage{})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling GetFullChassisInventory %s", err)
+		return err
+	}
+	for _, chassis := range res.GetChassis() {
+		log.Printf("%v\n", chassis)
+	}
+	return nil
+}
+func getChassisInventory(c api.AbstractOLTClient, clli *string) error {
+	res, err := c.GetChassisInventory(context.Background(), &api.InventoryMessage{Clli: *clli})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling GetChassisInventory %s", err)
+		return err
+	}
+	log.Printf("%v\n", res.GetChassis())
+	return nil
+}
+func findONT(c api.AbstractOLTClient, searchBy *string, value *string) error {
+	fmt.Println("search_by", *searchBy)
+	fmt.Println("value", *value)
+	field, ok := api.FindOntMessage_Field_value[*searchBy]
+	if !ok {
+		fmt.Printf("Unknown search_by %s\n", *searchBy)
+		return fmt.Errorf("unknown search_by %s", *searchBy)
+	}
+	res, err := c.FindOnt(context.Background(), &api.FindOntMessage{SearchBy: api.FindOntMessage_Field(field), Value: *value})
+	if err != nil {
+		fmt.Printf("Error when calling FindOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %v", res)
+	return nil
+}
+func getONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	res, err := c.GetOnt(context.Background(), &api.GetOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont)})
+	if err != nil {
+		fmt.Printf("Error when calling GetOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %v", res)
+	return nil
+}
+func putONT(c api.AbstractOLTClient, clli *string, slot *uint, port *uint, ont *uint, serial *string, stag *uint, ctag *uint, nasPort *string, circuitID *string, techProfile *string, speedProfile *string, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("slot", *slot)
+	fmt.Println("port", *port)
+	fmt.Println("ont", *ont)
+	fmt.Println("serial", *serial)
+	fmt.Println("stag", *stag)
+	fmt.Println("ctag", *ctag)
+	fmt.Println("nasPort", *nasPort)
+	fmt.Println("circuitID", *circuitID)
+	fmt.Println("tech_profile", *techProfile)
+	fmt.Println("speed_profile", *speedProfile)
+	res, err := c.PutOnt(context.Background(), &api.PutOntMessage{CLLI: *clli, SlotNumber: int32(*slot), PortNumber: int32(*port), OntNumber: int32(*ont),
+		SerialNumber: *serial, STag: uint32(*stag), CTag: uint32(*ctag), NasPortID: *nasPort, CircuitID: *circuitID, TechProfile: *techProfile,
+		SpeedProfile: *speedProfile, DryRun: *dryRun})
+	if err != nil {
+		debug.PrintStack()
+		fmt.Printf("Error when calling PutOnt %s", err)
+		return err
+	}
+	log.Printf("Response from server: %t created %t changed %s", res.GetSuccess(), res.GetCreated(), strings.Join(res.GetChangedFields(), ","))
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+
+func batchProvision(c api.AbstractOLTClient, clli *string, batchFile *string, bestEffort *bool, dryRun *bool) error {
+	fmt.Println("clli", *clli)
+	fmt.Println("batch_file", *batchFile)
+	fmt.Println("best_effort", *bestEffort)
+	f, err := os.Open(*batchFile)
+	if err != nil {
+		fmt.Printf("Unable to open batch file %s", err)
+		return err
+	}
+	defer f.Close()
+	message := api.BatchProvisionMessage{}
+	err = jsonpb.Unmarshal(f, &message)
+	if err != nil {
+		fmt.Printf("Unable to parse batch file %s", err)
+		return err
+	}
+	message.CLLI = *clli
+	if *bestEffort {
+		message.BatchMode = api.BatchProvisionMessage_bestEffort
+	} else {
+		message.BatchMode = api.BatchProvisionMessage_stopOnFailure
+	}
+	message.DryRun = *dryRun
+	res, err := c.BatchProvision(context.Background(), &message)
+	if err != nil {
+		fmt.Printf("Error when calling BatchProvision %s", err)
+		return err
+	}
+	for _, result := range res.GetResults() {
+		log.Printf("operation %d success %t code %d %s\n", result.GetIndex(), result.GetSuccess(), result.GetCode(), result.GetError())
+	}
+	log.Printf("Response from server: %t", res.GetSuccess())
+	printSouthbound(res.GetSouthbound())
+	return nil
+}
+
+func watchEvents(c api.AbstractOLTClient, clli *string, eventTypes *string) error {
+	types := []api.Event_EventType{}
+	for _, eventType := range strings.Split(*eventTypes, ",") {
+		if eventType == "" {
+			continue
+		}
+		value, ok := api.Event_EventType_value[eventType]
+		if !ok {
+			fmt.Printf("Unknown event type %s\n", eventType)
+			return fmt.Errorf("unknown event type %s", eventType)
+		}
+		types = append(types, api.Event_EventType(value))
+	}
+	stream, err := c.WatchEvents(context.Background(), &api.WatchEventsMessage{CLLI: *clli, Types: types})
+	if err != nil {
+		fmt.Printf("Error when calling WatchEvents %s", err)
+		return err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			fmt.Printf("Error when receiving event %s", err)
+			return err
+		}
+		log.Printf("%v\n", event)
+	}
+}
 
 func usage() {
 	var output = `
 	Usage ./client -server=[serverAddress:port] -[methodFlag] params
 	./client -ssl -fqdn=FQDN_OF_ABSTRACT_OLT_SERVER.CRT -cert PATH_TO_SERVER.CRT -server=[serverAddress:port] -[methodFlag] params : use ssl
 	./client -auth -server=[serverAddress:port] -[methodFlag] params : Authenticate session
+	./client -idempotency_key=KEY -server=[serverAddress:port] -[methodFlag] params : retrying a change with the same KEY returns the first result instead of applying it again
+	./client -dry_run -server=[serverAddress:port] -[methodFlag] params : validate a change and print the tosca/grpc messages it would send to XOS without applying it
 
    methodFlags:
    -e echo # used to test connectivity to server NOOP
@@ -428,6 +811,12 @@ func usage() {
 	 -xos_password XOS_PASSWORD
 	 e.g. ./client -server=localhost:7777 -u -clli MY_CLLI -xos_user NEW_USER -xos_password NEW_PASSWORD
 
+   -delete_chassis delete chassis
+      params:
+         -clli CLLI_NAME
+	 -force [optional default false] tear down active onts in XOS and delete anyway
+	 e.g. ./client -server=localhost:7777 -delete_chassis -clli MY_CLLI -force
+
    -s add physical olt chassis to chassis
       params:
          -clli CLLI_NAME - identifies abstract chassis to assign olt chassis to
@@ -438,6 +827,23 @@ func usage() {
 	 -type [edgecore,adtran,tibit] - used to tell AbstractOLT how many ports are available on olt chassis
 	 e.g. ./client -server abstractOltHost:7777 -s -clli MY_CLLI -olt_address 192.168.1.100 -olt_port=9191 -name=slot1 -driver=openolt -type=adtran
 
+   -remove_olt remove physical olt chassis from chassis - frees its abstract ports for a later olt chassis
+      params:
+         -clli CLLI_NAME
+	 -name - OLT_NAME of the olt chassis to remove
+	 -force [optional default false] tear down active onts in XOS and remove anyway
+	 e.g. ./client -server abstractOltHost:7777 -remove_olt -clli MY_CLLI -name=slot1
+
+   -replace_olt replace physical olt chassis - new olt chassis takes over the abstract slot/ports and onts of the old one
+      params:
+         -clli CLLI_NAME
+	 -name - OLT_NAME of the olt chassis being replaced
+	 -olt_address - NEW_OLT_CHASSIS_IP_ADDRESS
+	 -olt_port - NEW_OLT_CHASSIS_LISTEN_PORT
+	 -driver [openolt,asfvolt16,adtran,tibits] - driver XOS should use for the new olt chassis
+	 -new_name [optional defaults to -name] OLT_NAME for the new olt chassis
+	 e.g. ./client -server abstractOltHost:7777 -replace_olt -clli MY_CLLI -name=slot1 -olt_address 192.168.1.101 -olt_port=9191 -driver=openolt -new_name=slot1b
+
    -o provision ont - adds ont to whitelist in XOS  on a specific port on a specific olt chassis based on abstract -> phyisical mapping
       params:
 	 -clli CLLI_NAME
@@ -491,6 +897,58 @@ func usage() {
 	 -serial ONT_SERIAL_NUM
 	 e.g. ./client -server=localhost:7777 -d -clli=MY_CLLI -slot=1 -port=1 -ont=22 -serial=aer900jasdf
 
+   -modify_ont modify ont - changes s/c vlans, NasPortID, CircuitID or profiles of an active ont without taking it out of service
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 -stag [optional] S_TAG
+	 -ctag [optional] C_TAG
+	 -nas_port [optional] NAS_PORT_ID
+	 -circuit_id [optional] CIRCUIT_ID
+	 -tech_profile [optional] TECH_PROFILE
+	 -speed_profile [optional] SPEED_PROFILE
+	 e.g. ./client -server=localhost:7777 -modify_ont -clli=MY_CLLI -slot=1 -port=1 -ont=22 -stag=33 -ctag=104
+
+   -suspend_ont suspend ont - cuts service to an active ont by removing it from the XOS whitelist, its vlans, ids and profiles are kept
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 e.g. ./client -server=localhost:7777 -suspend_ont -clli=MY_CLLI -slot=1 -port=1 -ont=22
+
+   -resume_ont resume ont - restores service to a suspended ont
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 e.g. ./client -server=localhost:7777 -resume_ont -clli=MY_CLLI -slot=1 -port=1 -ont=22
+
+   -replace_serial replace ont serial - swaps the hardware of an active ont keeping its vlans, NasPortID and CircuitID
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 -serial SERIAL_NUM of the replacement ont
+	 e.g. ./client -server=localhost:7777 -replace_serial -clli=MY_CLLI -slot=1 -port=1 -ont=22 -serial=aer900jasdg
+
+   -move_ont move ont - moves an active ont to another slot/port/ont, removing it from its old PON port and adding it to the new one
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 -dest_clli [optional] CLLI_NAME to move to, defaults to -clli
+	 -dest_slot SLOT_NUMBER [1-16]
+	 -dest_port OLT_PORT_NUMBER [1-16]
+	 -dest_ont ONT_NUMBER [1-64]
+	 -recompute [optional] give the ont the vlans, NasPortID and CircuitID of its new position instead of keeping its own
+	 e.g. ./client -server=localhost:7777 -move_ont -clli=MY_CLLI -slot=1 -port=1 -ont=22 -dest_slot=1 -dest_port=2 -dest_ont=5
+
     -output (TEMPORARY) causes AbstractOLT to serialize all chassis to JSON file in $WorkingDirectory/backups
          e.g. ./client -server=localhost:7777 -output
 
@@ -505,7 +963,59 @@ func usage() {
     -full_inventory - returns a json document that describes all currently provisioned pods
          e.g. ./client -full_inventory
 
+    -chassis_inventory - same as -inventory but returned as typed protobuf messages instead of a json document
+      params:
+         -clli CLLI_NAME
+	 e.g. ./client -chassis_inventory -clli=ATLEDGEVOLT1
+
+    -full_chassis_inventory - same as -full_inventory but returned as typed protobuf messages instead of a json document
+         e.g. ./client -full_chassis_inventory
+
+    -find_ont - shows the abstract and physical location and the state of an ont
+      params:
+         -search_by [serialNumber,circuitID,nasPortID] default serialNumber
+	 -value VALUE_TO_FIND
+	 e.g. ./client -find_ont -search_by=circuitID -value="ATLEDGEVOLT1 1/1/1/1:1.1.1"
+
+    -get_ont - shows the ont at a slot/port/ont whatever state it is in
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 e.g. ./client -get_ont -clli=ATLEDGEVOLT1 -slot=1 -port=1 -ont=22
+
+    -put_ont - provisions the ont at a slot/port/ont, or replaces the serial and modifies an ont that is already provisioned
+      params:
+	 -clli CLLI_NAME
+	 -slot SLOT_NUMBER [1-16]
+	 -port OLT_PORT_NUMBER [1-16]
+	 -ont ONT_NUMBER [1-64]
+	 -serial [optional] ONT_SERIAL_NUM, with nothing else the ont is given the generated vlans and ids
+	 -stag, -ctag, -nas_port, -circuit_id, -tech_profile, -speed_profile [optional] values to provision or change
+	 e.g. ./client -put_ont -clli=ATLEDGEVOLT1 -slot=1 -port=1 -ont=22 -serial=aer900jasdf
+
+    -batch - applies a list of ont operations to one chassis in a single call and prints a result per operation
+      params:
+         -clli CLLI_NAME
+	 -batch_file FILE - json with an Operations list, each with a Type of [preProvision,activateSerial,provisionFull,provision,delete]
+	                    and the SlotNumber, PortNumber, OntNumber, SerialNumber, STag, CTag, NasPortID, CircuitID, TechProfile, SpeedProfile it needs
+	 -best_effort [optional default false] keep going after a failed operation instead of stopping
+	 e.g. ./client -batch -clli=ATLEDGEVOLT1 -batch_file=cutover.json -best_effort
+
+    -watch - streams chassis, olt and ont changes until interrupted
+      params:
+         -clli [optional] CLLI_NAME only show events for this chassis
+	 -event_types [optional] comma separated list of [created,preProvisioned,activated,deleted,xosPushFailed,replaced,modified,moved,suspended,resumed]
+	 e.g. ./client -watch -clli=ATLEDGEVOLT1 -event_types=activated,xosPushFailed
+
 	 `
 
 	fmt.Println(output)
 }
+
+func printSouthbound(southbound []*api.SouthboundMessage) {
+	for _, message := range southbound {
+		fmt.Printf("%s %s\n%s\n", message.GetTransport(), message.GetOperation(), message.GetBody())
+	}
+}
@@ -0,0 +1,217 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	specPath     = "/swagger.json"
+	explorerPath = "/docs/"
+)
+
+/*
+loadSpec - reads the swagger spec generated by make swagger and rewrites it to describe how this server was started,
+the REST gateway itself always listens on plain http and forwards the Login and Password headers to the grpc server
+when running with authentication
+*/
+func loadSpec(fileName string, authenticate bool) ([]byte, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	spec := make(map[string]interface{})
+	err = json.Unmarshal(raw, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid swagger spec: %v", fileName, err)
+	}
+	// leave host unset so clients call back to whichever address they fetched the spec from
+	delete(spec, "host")
+	spec["schemes"] = []string{"http"}
+	if authenticate {
+		spec["securityDefinitions"] = map[string]interface{}{
+			"Login":    map[string]string{"type": "apiKey", "in": "header", "name": "Login"},
+			"Password": map[string]string{"type": "apiKey", "in": "header", "name": "Password"},
+		}
+		spec["security"] = []map[string][]string{{"Login": {}, "Password": {}}}
+	} else {
+		delete(spec, "securityDefinitions")
+		delete(spec, "security")
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+/*
+newDocsMux - serves the spec and the explorer next to the grpc-gateway, which gets every other path
+*/
+func newDocsMux(gateway http.Handler, specFile string, authenticate bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	spec, err := loadSpec(specFile, authenticate)
+	if err != nil {
+		log.Printf("Unable to load swagger spec, %s will not be served %v\n", specPath, err)
+	}
+	mux.HandleFunc(specPath, func(w http.ResponseWriter, r *http.Request) {
+		if spec == nil {
+			http.Error(w, "swagger spec was not loaded, see the server log", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	page := strings.Replace(explorerPage, "{{AUTHENTICATE}}", fmt.Sprintf("%t", authenticate), 1)
+	mux.HandleFunc(explorerPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != explorerPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	})
+	mux.Handle("/", gateway)
+	return mux
+}
+
+// a dependency free page that lists the operations in the spec and lets them be tried against this server
+const explorerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AbstractOLT API Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.op { border: 1px solid #ccc; margin: 0.5em 0; padding: 0.5em; }
+.op summary { cursor: pointer; }
+.method { display: inline-block; width: 5em; font-weight: bold; }
+label { display: block; margin: 0.3em 0; }
+textarea { width: 100%; height: 8em; font-family: monospace; }
+pre { background: #f4f4f4; padding: 0.5em; overflow: auto; }
+#credentials { display: none; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>AbstractOLT API Explorer</h1>
+<p>Spec: <a href="/swagger.json">/swagger.json</a></p>
+<div id="credentials">
+<label>Login <input id="login"></label>
+<label>Password <input id="password" type="password"></label>
+</div>
+<div id="operations">Loading...</div>
+<script>
+var authenticate = {{AUTHENTICATE}};
+if (authenticate) {
+  document.getElementById("credentials").style.display = "block";
+}
+
+function call(method, template, form, out) {
+  var path = template.replace(/{([^}]+)}/g, function (match, name) {
+    return encodeURIComponent(form.elements["path." + name].value);
+  });
+  var query = [];
+  for (var i = 0; i < form.elements.length; i++) {
+    var el = form.elements[i];
+    if (el.name.indexOf("query.") === 0 && el.value !== "") {
+      query.push(encodeURIComponent(el.name.substring(6)) + "=" + encodeURIComponent(el.value));
+    }
+  }
+  if (query.length > 0) {
+    path += "?" + query.join("&");
+  }
+  var req = new XMLHttpRequest();
+  req.open(method.toUpperCase(), path);
+  req.setRequestHeader("Content-Type", "application/json");
+  if (authenticate) {
+    req.setRequestHeader("Login", document.getElementById("login").value);
+    req.setRequestHeader("Password", document.getElementById("password").value);
+  }
+  req.onload = function () {
+    out.textContent = req.status + " " + req.statusText + "\n" + req.responseText;
+  };
+  req.onerror = function () {
+    out.textContent = "request failed";
+  };
+  out.textContent = "...";
+  req.send(form.elements.body ? form.elements.body.value : null);
+}
+
+function render(spec) {
+  var list = document.getElementById("operations");
+  list.innerHTML = "";
+  Object.keys(spec.paths).sort().forEach(function (template) {
+    var item = spec.paths[template];
+    Object.keys(item).forEach(function (method) {
+      var op = item[method];
+      var box = document.createElement("details");
+      box.className = "op";
+      var summary = document.createElement("summary");
+      summary.innerHTML = '<span class="method"></span><code></code> ';
+      summary.children[0].textContent = method.toUpperCase();
+      summary.children[1].textContent = template;
+      summary.appendChild(document.createTextNode(op.operationId || ""));
+      box.appendChild(summary);
+      var form = document.createElement("form");
+      (op.parameters || []).forEach(function (param) {
+        var label = document.createElement("label");
+        if (param["in"] === "body") {
+          label.textContent = "body";
+          var body = document.createElement("textarea");
+          body.name = "body";
+          body.value = "{}";
+          label.appendChild(body);
+        } else {
+          label.textContent = param.name + " (" + param["in"] + ") ";
+          var input = document.createElement("input");
+          input.name = param["in"] + "." + param.name;
+          label.appendChild(input);
+        }
+        form.appendChild(label);
+      });
+      var send = document.createElement("button");
+      send.type = "submit";
+      send.textContent = "Send";
+      form.appendChild(send);
+      var out = document.createElement("pre");
+      form.onsubmit = function (e) {
+        e.preventDefault();
+        call(method, template, form, out);
+      };
+      box.appendChild(form);
+      box.appendChild(out);
+      list.appendChild(box);
+    });
+  });
+}
+
+var specReq = new XMLHttpRequest();
+specReq.open("GET", "/swagger.json");
+specReq.onload = function () {
+  if (specReq.status !== 200) {
+    document.getElementById("operations").textContent = specReq.responseText;
+    return;
+  }
+  render(JSON.parse(specReq.responseText));
+};
+specReq.send();
+</script>
+</body>
+</html>
+`
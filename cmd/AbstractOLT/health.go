@@ -0,0 +1,99 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	abstractOLTService = "api.AbstractOLT"
+	healthServicePath  = "/grpc.health.v1.Health/"
+	dependencyTimeout  = 5 * time.Second
+)
+
+// grpc.health.v1 starts out NOT_SERVING and follows the readiness checks, probes are never asked for credentials
+var healthServer = newHealthServer()
+
+func newHealthServer() *health.Server {
+	server := health.NewServer()
+	server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	server.SetServingStatus(abstractOLTService, healthpb.HealthCheckResponse_NOT_SERVING)
+	return server
+}
+
+func isHealthCheck(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, healthServicePath)
+}
+
+/*
+updateHealth - publishes the last readiness check on grpc.health.v1
+*/
+func updateHealth() {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if impl.GetReadiness().Ready {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(abstractOLTService, status)
+}
+
+/*
+watchDependencies - checks XOS and mongo every interval for as long as the server runs
+*/
+func watchDependencies(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		impl.CheckDependencies(dependencyTimeout)
+		updateHealth()
+		<-ticker.C
+	}
+}
+
+/*
+addHealthHandlers - /healthz answers as long as the process can serve http, /readyz returns the last readiness check
+and 503 until the server is ready
+*/
+func addHealthHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness := impl.GetReadiness()
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(readiness)
+	})
+}
+
+/*
+registerHealth - adds grpc.health.v1 to the grpc server
+*/
+func registerHealth(grpcServer *grpc.Server) {
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/api"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// the servers started by startGRPCServer and startRESTServer, nil until they are listening
+var serversLock sync.Mutex
+var runningGRPC *grpc.Server
+var runningREST *http.Server
+
+func trackGRPCServer(server *grpc.Server) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	runningGRPC = server
+}
+
+func trackRESTServer(server *http.Server) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	runningREST = server
+}
+
+/*
+shutdown - stops taking new rpcs and gives the ones in flight and the running async jobs up to timeout to finish,
+whatever is still waiting on XOS after that is cancelled, then every chassis is backed up
+*/
+func shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	healthServer.Shutdown()
+	api.Shutdown()
+
+	serversLock.Lock()
+	restServer := runningREST
+	grpcServer := runningGRPC
+	serversLock.Unlock()
+
+	// the gateway forwards to the grpc server so it is drained first
+	if restServer != nil {
+		err := restServer.Shutdown(ctx)
+		if err != nil {
+			log.Printf("REST requests still running after %v, closing them %v\n", timeout, err)
+			restServer.Close()
+		}
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			log.Printf("gRPC calls still running after %v, cancelling them\n", timeout)
+			grpcServer.Stop()
+		}
+	}
+	impl.StopJobs(ctx)
+
+	_, err := impl.FlushOutput()
+	if err != nil {
+		log.Printf("Final backup failed %v\n", err)
+	}
+	log.Println("Shutdown complete")
+}
@@ -0,0 +1,91 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/models"
+	"golang.org/x/net/context"
+)
+
+// jobs stopped by shutdown can not be started again in the same process
+var shutDown bool
+
+func TestShutdown_BacksUpAfterJobsFinish(t *testing.T) {
+	if shutDown {
+		t.Skip("shutdown has already stopped the jobs in this process")
+	}
+	shutDown = true
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	storage := models.NewFileStorage(dir)
+	impl.SetStorage(storage)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	impl.StartJobs(1, func(ctx context.Context, job impl.Job) (impl.JobResult, bool) {
+		close(started)
+		<-release
+		return impl.JobResult{ResponseType: "api.AddOntReturn"}, false
+	})
+	id, err := impl.SubmitJob("ProvisionOnt", "shutdown_clli", "api.AddOntMessage", nil)
+	if err != nil {
+		t.Fatalf("SubmitJob failed with %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The job was not started")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		shutdown(5 * time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected shutdown to wait for the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not finish once the job had")
+	}
+
+	// the final backup is taken after the job finished so it holds the outcome
+	data, err := storage.Load(".jobs")
+	if err != nil {
+		t.Fatalf("Expected the jobs to be backed up %v", err)
+	}
+	jobs := []impl.Job{}
+	err = json.Unmarshal(data, &jobs)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != id || jobs[0].State != impl.JobSucceeded {
+		t.Fatalf("Expected the backup to hold the finished job got %s %v", data, err)
+	}
+}
@@ -26,38 +26,87 @@ import (
 	"gerrit.opencord.org/abstract-olt/models"
 	"gerrit.opencord.org/abstract-olt/models/abstract"
 	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
 )
 
 /*
 CreateChassis - allocates a new Chassis struct and stores it in chassisMap
 */
-func CreateChassis(clli string, xosAddress net.TCPAddr, xosUser string, xosPassword string, shelf int, rack int) (string, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
+func CreateChassis(ctx context.Context, clli string, xosAddress net.TCPAddr, xosUser string, xosPassword string, shelf int, rack int, recorder *physical.Recorder) (string, error) {
+	if recorder != nil {
+		// a new chassis sends nothing to XOS so there is nothing to record, only check it does not exist
+		if chassisHolder := models.RLockChassis(clli); chassisHolder != nil {
+			chassisHolder.RUnlock()
+			return "", &models.ChassisExistsError{CLLI: clli}
+		}
+		return clli, nil
+	}
 
-	loginWorked := testLogin(xosUser, xosPassword, xosAddress.IP, xosAddress.Port)
+	loginWorked, err := testLogin(ctx, xosUser, xosPassword, xosAddress.IP, xosAddress.Port)
+	if err != nil {
+		return "", err
+	}
 	if !loginWorked {
 		return "", errors.New("Unable to validate login not creating Abstract Chassis")
 	}
 
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder != nil {
-		errMsg := fmt.Sprintf("AbstractChassis %s already exists", clli)
-		return "", errors.New(errMsg)
-	}
-
 	abstractChassis := abstract.GenerateChassis(clli, rack, shelf)
 	phyChassis := physical.Chassis{CLLI: clli, XOSUser: xosUser, XOSPassword: xosPassword, XOSAddress: xosAddress, Rack: rack, Shelf: shelf}
 
-	chassisHolder = &models.ChassisHolder{AbstractChassis: abstractChassis, PhysicalChassis: phyChassis}
+	chassisHolder := &models.ChassisHolder{AbstractChassis: abstractChassis, PhysicalChassis: phyChassis}
 	if settings.GetDebug() {
 		output := fmt.Sprintf("%v", abstractChassis)
 		formatted := strings.Replace(output, "{", "\n{", -1)
 		log.Printf("new chassis %s\n", formatted)
 	}
-	(*chassisMap)[clli] = chassisHolder
-	isDirty = true
+	err = models.AddChassis(clli, chassisHolder)
+	if err != nil {
+		return "", err
+	}
+	markDirty(chassisHolder)
+	if added := models.RLockChassis(clli); added != nil {
+		journalChanges(added)
+		added.RUnlock()
+	}
+	publish(Event{Type: EventCreated, Kind: KindChassis, CLLI: clli})
 	return clli, nil
 }
+
+/*
+DeleteChassis - removes an abstract chassis and its backup, refusing while onts are active unless force is set. When
+XOS fails to remove some of the onts the chassis is kept with them failed
+*/
+func DeleteChassis(ctx context.Context, clli string, force bool, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	physicalChassis := &chassisHolder.PhysicalChassis
+	activeOnts := physicalChassis.GetActiveOnts()
+	if len(activeOnts) > 0 && !force {
+		unlock()
+		return false, &physical.ActiveOntsError{CLLI: clli, Count: len(activeOnts)}
+	}
+	removed, err := physicalChassis.Teardown(ctx)
+	if recorder != nil {
+		unlock()
+		return true, nil
+	}
+	publishOntsDeleted(chassisHolder, removed)
+	if err != nil {
+		// the chassis is kept so deleting it again retries the onts XOS did not remove
+		markDirty(chassisHolder)
+		unlock()
+		return false, publishFailure(Event{Type: EventDeleted, Kind: KindChassis, CLLI: clli}, err)
+	}
+	physicalChassis.UnindexOnts()
+	models.RemoveChassis(clli)
+	// DoOutput locks chassis while holding the output lock so the backup is only removed once this one is released
+	unlock()
+	publish(Event{Type: EventDeleted, Kind: KindChassis, CLLI: clli})
+	err = deleteBackup(clli)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
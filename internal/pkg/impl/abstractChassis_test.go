@@ -0,0 +1,143 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+/*
+setupChassis - backs up to a temporary directory and creates the chassis clli in dummy mode with an edgecore olt,
+the returned func removes the chassis if it is still there and the backups
+*/
+func setupChassis(t *testing.T, clli string, xosAddress net.TCPAddr) func() {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v\n", err)
+	}
+	impl.SetStorage(models.NewFileStorage(dir))
+	settings.SetDummy(true)
+	settings.SetGrpc(false)
+	ctx := context.Background()
+	_, err = impl.CreateChassis(ctx, clli, xosAddress, "user", "password", 1, 1, nil)
+	if err != nil {
+		t.Fatalf("CreateChassis failed with %v\n", err)
+	}
+	oltAddress := net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}
+	_, err = impl.CreateOLTChassis(ctx, clli, "edgecore", "openolt", oltAddress, clli+"_olt1", nil)
+	if err != nil {
+		t.Fatalf("CreateOLTChassis failed with %v\n", err)
+	}
+	return func() {
+		settings.SetDummy(true)
+		if chassisHolder := models.LockChassis(clli); chassisHolder != nil {
+			chassisHolder.PhysicalChassis.UnindexOnts()
+			models.RemoveChassis(clli)
+			chassisHolder.Unlock()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+/*
+unreachableXOS - an address nothing listens on so every call to XOS fails straight away
+*/
+func unreachableXOS(t *testing.T) net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port %v\n", err)
+	}
+	address := *listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	return address
+}
+
+func TestAbstractChassis_DeleteChassis(t *testing.T) {
+	clli := "delete_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+	_, err := impl.ProvisionOnt(ctx, clli, 1, 1, 1, "DELETE1", nil)
+	if err != nil {
+		t.Fatalf("ProvisionOnt failed with %v\n", err)
+	}
+
+	_, err = impl.DeleteChassis(ctx, clli, false, nil)
+	if activeErr, ok := err.(*physical.ActiveOntsError); !ok || activeErr.Count != 1 {
+		t.Fatalf("Expected ActiveOntsError deleting a chassis with an active ont got %v\n", err)
+	}
+	if _, err = impl.FindOnt(physical.BySerialNumber, "DELETE1"); err != nil {
+		t.Fatalf("Refused DeleteChassis removed the ont %v\n", err)
+	}
+
+	// XOS can not be reached so the ont is left failed and the chassis kept to delete again
+	settings.SetDummy(false)
+	success, err := impl.DeleteChassis(ctx, clli, true, nil)
+	settings.SetDummy(true)
+	if _, ok := err.(*physical.XOSError); !ok || success {
+		t.Fatalf("Expected XOSError when XOS fails to remove the ont got %t %v\n", success, err)
+	}
+	location, err := impl.FindOnt(physical.BySerialNumber, "DELETE1")
+	if err != nil || location.State != physical.OntFailed.String() {
+		t.Fatalf("Ont XOS failed to remove should be failed got %v %v\n", location, err)
+	}
+
+	id, events := impl.Subscribe(clli, []impl.EventType{impl.EventDeleted})
+	defer impl.Unsubscribe(id)
+	success, err = impl.DeleteChassis(ctx, clli, true, nil)
+	if err != nil || !success {
+		t.Fatalf("Forced DeleteChassis failed with %v\n", err)
+	}
+	checkEvents(t, events, impl.Event{Type: impl.EventDeleted, Kind: impl.KindOnt, CLLI: clli, Slot: 1, Port: 1, Ont: 1, SerialNumber: "DELETE1"},
+		impl.Event{Type: impl.EventDeleted, Kind: impl.KindChassis, CLLI: clli})
+	if chassisHolder := models.RLockChassis(clli); chassisHolder != nil {
+		chassisHolder.RUnlock()
+		t.Fatal("Forced DeleteChassis kept the chassis")
+	}
+	if _, err = impl.FindOnt(physical.BySerialNumber, "DELETE1"); !isOntNotFound(err) {
+		t.Fatal("Forced DeleteChassis left the ont in the index")
+	}
+}
+
+/*
+checkEvents - fails unless the next events published are the ones expected, their times are not compared
+*/
+func checkEvents(t *testing.T, events <-chan impl.Event, expected ...impl.Event) {
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			got.Time = want.Time
+			if got != want {
+				t.Fatalf("Expected event %v got %v\n", want, got)
+			}
+		default:
+			t.Fatalf("Expected event %v but none was published\n", want)
+		}
+	}
+}
+
+func isOntNotFound(err error) bool {
+	_, ok := err.(*impl.OntNotFoundError)
+	return ok
+}
@@ -0,0 +1,319 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+// snapshots are kept in the storage next to the backups as .snapshot.<clli>.<unix nanoseconds>
+const snapshotPrefix = ".snapshot."
+
+/*
+Backup - a snapshot of a chassis taken when it was backed up, ID is unique for the chassis
+*/
+type Backup struct {
+	ID      string
+	CLLI    string
+	Created time.Time
+}
+
+/*
+BackupDifference - a value that is not the same in a snapshot and the live chassis, Backup and Live are json and
+empty when the value is missing on that side
+*/
+type BackupDifference struct {
+	Path   string
+	Backup string
+	Live   string
+}
+
+/*
+SnapshotNotFoundError - returned when the chassis has no snapshot with the requested ID, it may have been removed
+by the snapshot retention
+*/
+type SnapshotNotFoundError struct {
+	CLLI string
+	ID   string
+}
+
+func (e *SnapshotNotFoundError) Error() string {
+	return fmt.Sprintf("Chassis %s has no backup with ID %s", e.CLLI, e.ID)
+}
+
+func snapshotName(clli string, id string) string {
+	return snapshotPrefix + clli + "." + id
+}
+
+/*
+parseSnapshot - returns the snapshot a storage name is for, ok is false when it is not a snapshot
+*/
+func parseSnapshot(name string) (Backup, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) {
+		return Backup{}, false
+	}
+	name = strings.TrimPrefix(name, snapshotPrefix)
+	dot := strings.LastIndex(name, ".")
+	if dot < 1 {
+		return Backup{}, false
+	}
+	nanos, err := strconv.ParseInt(name[dot+1:], 10, 64)
+	if err != nil {
+		return Backup{}, false
+	}
+	return Backup{ID: name[dot+1:], CLLI: name[:dot], Created: time.Unix(0, nanos)}, true
+}
+
+/*
+ListBackups - returns the snapshots of the chassis clli, or of every chassis when clli is empty, oldest first.
+Snapshots of a deleted chassis are kept so it can be restored
+*/
+func ListBackups(clli string) ([]Backup, error) {
+	names, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
+	return snapshotsOf(names, clli), nil
+}
+
+func snapshotsOf(names []string, clli string) []Backup {
+	backups := []Backup{}
+	for _, name := range names {
+		backup, ok := parseSnapshot(name)
+		if ok && (clli == "" || backup.CLLI == clli) {
+			backups = append(backups, backup)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.Before(backups[j].Created)
+	})
+	return backups
+}
+
+/*
+saveSnapshot - keeps data, the backup of clli just saved, as a snapshot then removes the snapshots of clli beyond
+the retention. The latest snapshot is always kept however old it is. outputLock must be held
+*/
+func saveSnapshot(clli string, data []byte, now time.Time) error {
+	keep := settings.GetBackupSnapshots()
+	if keep < 1 {
+		return nil
+	}
+	err := storage.Save(snapshotName(clli, strconv.FormatInt(now.UnixNano(), 10)), data)
+	if err != nil {
+		return err
+	}
+	names, err := storage.List()
+	if err != nil {
+		return err
+	}
+	backups := snapshotsOf(names, clli)
+	age := settings.GetBackupSnapshotAge()
+	for i := 0; i < len(backups)-1; i++ {
+		backup := backups[i]
+		if len(backups)-i > keep || (age > 0 && now.Sub(backup.Created) > age) {
+			err := storage.Delete(snapshotName(clli, backup.ID))
+			if err != nil {
+				log.Printf("Unable to remove backup %s of %s %v\n", backup.ID, clli, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+loadSnapshot - reads the snapshot id of clli into a new chassis
+*/
+func loadSnapshot(clli string, id string) (*models.ChassisHolder, error) {
+	data, err := storage.Load(snapshotName(clli, id))
+	if _, ok := err.(*models.BackupNotFoundError); ok {
+		return nil, &SnapshotNotFoundError{CLLI: clli, ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	chassisHolder := &models.ChassisHolder{}
+	err = chassisHolder.Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	return chassisHolder, nil
+}
+
+/*
+DiffBackup - returns every value that differs between the snapshot id of clli and the live chassis, passwords are
+reported as changed without their values
+*/
+func DiffBackup(clli string, id string) ([]BackupDifference, error) {
+	snapshot, err := loadSnapshot(clli, id)
+	if err != nil {
+		return nil, err
+	}
+	// reserialized so an older snapshot is compared in the format the live chassis is written in
+	backupJSON, err := snapshot.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	chassisHolder := models.RLockChassis(clli)
+	if chassisHolder == nil {
+		return nil, &models.ChassisNotFoundError{CLLI: clli}
+	}
+	liveJSON, err := chassisHolder.Serialize()
+	chassisHolder.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	var backup, live interface{}
+	err = decodeJSON(backupJSON, &backup)
+	if err == nil {
+		err = decodeJSON(liveJSON, &live)
+	}
+	if err != nil {
+		return nil, err
+	}
+	differences := []BackupDifference{}
+	diffJSON("", backup, live, &differences)
+	return differences, nil
+}
+
+func decodeJSON(data []byte, value *interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+/*
+diffJSON - appends to differences every value under path that is not the same in backup and live, objects are
+compared by key and arrays by index
+*/
+func diffJSON(path string, backup interface{}, live interface{}, differences *[]BackupDifference) {
+	switch backupValue := backup.(type) {
+	case map[string]interface{}:
+		if liveValue, ok := live.(map[string]interface{}); ok {
+			keys := []string{}
+			for key := range backupValue {
+				keys = append(keys, key)
+			}
+			for key := range liveValue {
+				if _, ok := backupValue[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				keyPath := key
+				if path != "" {
+					keyPath = path + "." + key
+				}
+				diffJSON(keyPath, backupValue[key], liveValue[key], differences)
+			}
+			return
+		}
+	case []interface{}:
+		if liveValue, ok := live.([]interface{}); ok {
+			for i := 0; i < len(backupValue) || i < len(liveValue); i++ {
+				var backupItem, liveItem interface{}
+				if i < len(backupValue) {
+					backupItem = backupValue[i]
+				}
+				if i < len(liveValue) {
+					liveItem = liveValue[i]
+				}
+				diffJSON(fmt.Sprintf("%s[%d]", path, i), backupItem, liveItem, differences)
+			}
+			return
+		}
+	}
+	if reflect.DeepEqual(backup, live) {
+		return
+	}
+	difference := BackupDifference{Path: path, Backup: encodeJSON(backup), Live: encodeJSON(live)}
+	if strings.HasSuffix(path, "Password") {
+		difference.Backup, difference.Live = "changed", "changed"
+	}
+	*differences = append(*differences, difference)
+}
+
+func encodeJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+/*
+RestoreBackup - replaces the chassis clli with its snapshot id, recreating it if it has been deleted. XOS is left as
+it is unless reflow is set, then the restored chassis is sent to XOS as Reflow would
+*/
+func RestoreBackup(ctx context.Context, clli string, id string, reflow bool, recorder *physical.Recorder) (bool, error) {
+	restored, err := loadSnapshot(clli, id)
+	if err != nil {
+		return false, err
+	}
+	if recorder != nil {
+		restored.PhysicalChassis.Recorder = recorder
+		if reflow {
+			reflowChassis(ctx, restored)
+		}
+		return true, nil
+	}
+
+	old, unlock, err := lockChassis(ctx, clli, nil)
+	if _, ok := err.(*models.ChassisNotFoundError); ok {
+		old, unlock, err = nil, func() {}, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if old != nil {
+		old.PhysicalChassis.UnindexOnts()
+	}
+	restored.PhysicalChassis.IndexOnts()
+	err = models.ReplaceChassis(clli, old, restored)
+	if err != nil {
+		// a chassis with the same clli was created while it was restored
+		restored.PhysicalChassis.UnindexOnts()
+		if old != nil {
+			old.PhysicalChassis.IndexOnts()
+		}
+		unlock()
+		return false, err
+	}
+	unlock()
+	// restored is returned locked by ReplaceChassis, waiters on old get it once it is released
+	defer restored.Unlock()
+	if reflow {
+		reflowChassis(ctx, restored)
+	}
+	markDirty(restored)
+	journalChanges(restored)
+	publish(Event{Type: EventRestored, Kind: KindChassis, CLLI: clli, Message: id})
+	return true, nil
+}
@@ -0,0 +1,107 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"errors"
+	"fmt"
+
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+/*
+BatchOperationType - which ont operation a BatchOperation performs
+*/
+type BatchOperationType int
+
+// values match the BatchOperation.OperationType enum in the api
+const (
+	BatchPreProvision BatchOperationType = iota
+	BatchActivateSerial
+	BatchProvisionFull
+	BatchProvisionOnt
+	BatchDelete
+)
+
+/*
+BatchOperation - a single ont operation in a BatchProvision call, only the fields the operation needs are used
+*/
+type BatchOperation struct {
+	Type         BatchOperationType
+	SlotNumber   int
+	PortNumber   int
+	OntNumber    int
+	SerialNumber string
+	CTag         uint32
+	STag         uint32
+	NasPortID    string
+	CircuitID    string
+	TechProfile  string
+	SpeedProfile string
+}
+
+/*
+ErrBatchSkipped - result of an operation that was not attempted because an earlier one failed in stop on failure mode
+*/
+var ErrBatchSkipped = errors.New("Not attempted because an earlier operation in the batch failed")
+
+/*
+BatchProvision - applies operations in order to the chassis for clli holding its lock once for the whole batch,
+returns one error per operation (nil on success), with stopOnFailure every operation after the first failure is
+ErrBatchSkipped otherwise every operation is attempted
+*/
+func BatchProvision(ctx context.Context, clli string, operations []BatchOperation, stopOnFailure bool, recorder *physical.Recorder) ([]error, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	results := make([]error, len(operations))
+	failed := false
+	for i, op := range operations {
+		if failed && stopOnFailure {
+			results[i] = ErrBatchSkipped
+			continue
+		}
+		// the caller has given up so the rest of the batch is not attempted
+		if ctx.Err() != nil {
+			results[i] = ctx.Err()
+			failed = true
+			continue
+		}
+		switch op.Type {
+		case BatchPreProvision:
+			err = preProvisionOnt(chassisHolder, clli, op.SlotNumber, op.PortNumber, op.OntNumber, op.CTag, op.STag, op.NasPortID, op.CircuitID, op.TechProfile, op.SpeedProfile)
+		case BatchActivateSerial:
+			err = activateSerial(ctx, chassisHolder, clli, op.SlotNumber, op.PortNumber, op.OntNumber, op.SerialNumber)
+		case BatchProvisionFull:
+			err = provisionOntFull(ctx, chassisHolder, clli, op.SlotNumber, op.PortNumber, op.OntNumber, op.SerialNumber, op.CTag, op.STag, op.NasPortID, op.CircuitID)
+		case BatchProvisionOnt:
+			err = provisionOnt(ctx, chassisHolder, clli, op.SlotNumber, op.PortNumber, op.OntNumber, op.SerialNumber)
+		case BatchDelete:
+			err = deleteOnt(ctx, chassisHolder, clli, op.SlotNumber, op.PortNumber, op.OntNumber, op.SerialNumber)
+		default:
+			err = fmt.Errorf("Unknown batch operation type %d", op.Type)
+		}
+		markOntDirty(chassisHolder, op.SlotNumber, op.PortNumber, op.OntNumber)
+		results[i] = err
+		if err != nil {
+			failed = true
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,141 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package impl_test
+
+import (
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/models/abstract"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+/*
+failingBatch - activates 1/1/1 twice so the second operation fails, then activates 1/1/2
+*/
+func failingBatch(prefix string) []impl.BatchOperation {
+	return []impl.BatchOperation{
+		{Type: impl.BatchProvisionOnt, SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: prefix + "1"},
+		{Type: impl.BatchProvisionOnt, SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: prefix + "2"},
+		{Type: impl.BatchProvisionOnt, SlotNumber: 1, PortNumber: 1, OntNumber: 2, SerialNumber: prefix + "3"},
+	}
+}
+
+func ontState(t *testing.T, clli string, ontNumber int) string {
+	location, err := impl.GetOnt(clli, 1, 1, ontNumber)
+	if err != nil {
+		t.Fatalf("GetOnt failed with %v\n", err)
+	}
+	return location.State
+}
+
+func TestBatch_StopOnFailure(t *testing.T) {
+	clli := "batch_stop_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+
+	results, err := impl.BatchProvision(context.Background(), clli, failingBatch("BATCHSTOP"), true, nil)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected a result per operation got %v %v\n", results, err)
+	}
+	if results[0] != nil {
+		t.Fatalf("Expected the first operation to succeed got %v\n", results[0])
+	}
+	if _, ok := results[1].(*physical.AllReadyActiveError); !ok {
+		t.Fatalf("Expected AllReadyActiveError activating the ont again got %v\n", results[1])
+	}
+	if results[2] != impl.ErrBatchSkipped {
+		t.Fatalf("Expected the operation after the failure to be skipped got %v\n", results[2])
+	}
+	if state := ontState(t, clli, 2); state != physical.OntEmpty.String() {
+		t.Fatalf("Expected the skipped operation to leave the ont alone got %s\n", state)
+	}
+}
+
+func TestBatch_BestEffort(t *testing.T) {
+	clli := "batch_best_effort_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+
+	operations := append(failingBatch("BATCHBEST"),
+		impl.BatchOperation{Type: impl.BatchProvisionOnt, SlotNumber: 99, PortNumber: 1, OntNumber: 1, SerialNumber: "BATCHBEST4"},
+		impl.BatchOperation{Type: impl.BatchOperationType(99), SlotNumber: 1, PortNumber: 1, OntNumber: 3})
+	results, err := impl.BatchProvision(context.Background(), clli, operations, false, nil)
+	if err != nil || len(results) != 5 {
+		t.Fatalf("Expected a result per operation got %v %v\n", results, err)
+	}
+	if results[0] != nil || results[2] != nil {
+		t.Fatalf("Expected the operations either side of the failure to succeed got %v\n", results)
+	}
+	if _, ok := results[1].(*physical.AllReadyActiveError); !ok {
+		t.Fatalf("Expected AllReadyActiveError activating the ont again got %v\n", results[1])
+	}
+	if _, ok := results[3].(*abstract.OutOfRangeError); !ok {
+		t.Fatalf("Expected OutOfRangeError for slot 99 got %v\n", results[3])
+	}
+	if results[4] == nil {
+		t.Fatal("Expected an unknown operation type to fail")
+	}
+	if state := ontState(t, clli, 2); state != physical.OntActive.String() {
+		t.Fatalf("Expected the operation after the failure to be applied got %s\n", state)
+	}
+}
+
+/*
+cancelledAfter - a context that reports itself cancelled once Err has been called checks times, BatchProvision calls
+it when it has locked the chassis and before each operation
+*/
+type cancelledAfter struct {
+	context.Context
+	checks int
+}
+
+func (ctx *cancelledAfter) Err() error {
+	ctx.checks--
+	if ctx.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestBatch_Cancelled(t *testing.T) {
+	clli := "batch_cancelled_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+
+	// given up on before the chassis was locked nothing is attempted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := impl.BatchProvision(ctx, clli, failingBatch("BATCHCANCEL"), false, nil)
+	if err != context.Canceled || results != nil {
+		t.Fatalf("Expected the batch to be refused with a cancelled context got %v %v\n", results, err)
+	}
+	if state := ontState(t, clli, 1); state != physical.OntEmpty.String() {
+		t.Fatalf("Expected a cancelled batch to leave the ont alone got %s\n", state)
+	}
+
+	// given up on part way through the rest of the batch is not attempted even when it is best effort
+	operations := []impl.BatchOperation{
+		{Type: impl.BatchProvisionOnt, SlotNumber: 1, PortNumber: 1, OntNumber: 1, SerialNumber: "BATCHCANCEL1"},
+		{Type: impl.BatchProvisionOnt, SlotNumber: 1, PortNumber: 1, OntNumber: 2, SerialNumber: "BATCHCANCEL2"},
+	}
+	results, err = impl.BatchProvision(&cancelledAfter{Context: context.Background(), checks: 2}, clli, operations, false, nil)
+	if err != nil || len(results) != 2 || results[0] != nil || results[1] != context.Canceled {
+		t.Fatalf("Expected the operation after the cancel to fail with context.Canceled got %v %v\n", results, err)
+	}
+	if state := ontState(t, clli, 2); state != physical.OntEmpty.String() {
+		t.Fatalf("Expected the operation after the cancel to leave the ont alone got %s\n", state)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+/*
+dryRunChassisHolder - returns a copy of chassisHolder whose physical chassis records southbound messages in recorder
+instead of sending them to XOS, callers must hold the chassis at least for reading
+*/
+func dryRunChassisHolder(chassisHolder *models.ChassisHolder, recorder *physical.Recorder) (*models.ChassisHolder, error) {
+	json, err := chassisHolder.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	clone := &models.ChassisHolder{}
+	err = clone.Deserialize(json)
+	if err != nil {
+		return nil, err
+	}
+	clone.PhysicalChassis.Recorder = recorder
+	return clone, nil
+}
+
+/*
+isDryRun - true for a copy made by dryRunChassisHolder, nothing done to it is published or backed up
+*/
+func isDryRun(chassisHolder *models.ChassisHolder) bool {
+	return chassisHolder.PhysicalChassis.Recorder != nil
+}
@@ -19,8 +19,5 @@ package impl
 Echo - Tester function which just returns same string sent to it
 */
 func Echo(ping string) (string, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
 	return ping, nil
 }
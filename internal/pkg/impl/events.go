@@ -0,0 +1,191 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+/*
+EventType - what happened to the chassis, olt or ont an Event describes
+*/
+type EventType int
+
+/*
+EventKind - which kind of equipment an Event describes
+*/
+type EventKind int
+
+// values match the Event.EventType and Event.Kind enums in the api
+const (
+	EventCreated EventType = iota + 1
+	EventPreProvisioned
+	EventActivated
+	EventDeleted
+	EventXOSPushFailed
+	EventReplaced
+	EventModified
+	EventMoved
+	EventSuspended
+	EventResumed
+	EventRestored
+)
+
+const (
+	KindChassis EventKind = iota
+	KindOlt
+	KindOnt
+)
+
+// how many events a slow watcher can fall behind before events to it are dropped
+const eventBufferSize = 128
+
+/*
+Event - a single mutation made through impl
+*/
+type Event struct {
+	Type         EventType
+	Kind         EventKind
+	CLLI         string
+	Slot         int
+	Port         int
+	Ont          int
+	Hostname     string
+	SerialNumber string
+	Message      string
+	Time         time.Time
+}
+
+type subscriber struct {
+	clli   string
+	types  map[EventType]bool
+	events chan Event
+}
+
+var subscriberLock sync.Mutex
+var subscribers = make(map[int]*subscriber)
+var nextSubscriberID int
+
+/*
+Subscribe - registers a watcher for events on clli (all chassis when empty) of the given types (all types when empty)
+*/
+func Subscribe(clli string, types []EventType) (int, <-chan Event) {
+	subscriberLock.Lock()
+	defer subscriberLock.Unlock()
+	sub := &subscriber{clli: clli, types: make(map[EventType]bool), events: make(chan Event, eventBufferSize)}
+	for _, eventType := range types {
+		sub.types[eventType] = true
+	}
+	nextSubscriberID++
+	subscribers[nextSubscriberID] = sub
+	return nextSubscriberID, sub.events
+}
+
+/*
+Unsubscribe - removes a watcher registered with Subscribe and closes its channel
+*/
+func Unsubscribe(id int) {
+	subscriberLock.Lock()
+	defer subscriberLock.Unlock()
+	sub := subscribers[id]
+	if sub != nil {
+		delete(subscribers, id)
+		close(sub.events)
+	}
+}
+
+/*
+publish - hands the event to every matching watcher, never blocking the caller which still holds the chassis lock
+*/
+func publish(event Event) {
+	event.Time = time.Now()
+	subscriberLock.Lock()
+	defer subscriberLock.Unlock()
+	for id, sub := range subscribers {
+		if sub.clli != "" && sub.clli != event.CLLI {
+			continue
+		}
+		if len(sub.types) > 0 && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Event watcher %d is not keeping up dropping event %v\n", id, event)
+		}
+	}
+}
+
+/*
+publishChange - publishes event if the change it describes was applied, when only the push to XOS failed
+the change still happened so an XOSPushFailed event follows it, err is returned as is either way. Nothing is published
+for changes to a dry run copy of chassisHolder
+*/
+func publishChange(chassisHolder *models.ChassisHolder, event Event, err error) error {
+	if isDryRun(chassisHolder) {
+		return err
+	}
+	if err == nil {
+		publish(event)
+		return nil
+	}
+	xosErr, ok := err.(*physical.XOSError)
+	if !ok {
+		return err
+	}
+	log.Printf("ERROR :) %v\n", xosErr)
+	// a rolled back change never happened so only the failure is published
+	if !xosErr.RolledBack {
+		publish(event)
+	}
+	event.Type = EventXOSPushFailed
+	event.Message = xosErr.Error()
+	publish(event)
+	return err
+}
+
+/*
+publishFailure - publishes that the change event describes was not made because pushing it to XOS failed, err is
+returned as is
+*/
+func publishFailure(event Event, err error) error {
+	log.Printf("ERROR :) %v\n", err)
+	event.Type = EventXOSPushFailed
+	event.Message = err.Error()
+	publish(event)
+	return err
+}
+
+/*
+publishOntsDeleted - publishes the deletion of each ont removed from XOS along with the equipment it was on, nothing
+is published for a dry run copy of chassisHolder
+*/
+func publishOntsDeleted(chassisHolder *models.ChassisHolder, onts []physical.Ont) {
+	if isDryRun(chassisHolder) {
+		return
+	}
+	clli := chassisHolder.PhysicalChassis.CLLI
+	for _, ont := range onts {
+		port := ont.Parent
+		publish(Event{Type: EventDeleted, Kind: KindOnt, CLLI: clli, Slot: port.AbstractSlot, Port: port.AbstractPort, Ont: ont.Number,
+			SerialNumber: ont.SerialNumber})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"fmt"
+
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+/*
+OntLocation - where an ont lives in both the abstract and physical chassis and what state it is in
+*/
+type OntLocation struct {
+	CLLI               string
+	SlotNumber         int
+	PortNumber         int
+	OntNumber          int
+	Hostname           string
+	PhysicalPortNumber int
+	State              string
+	SerialNumber       string
+	NasPortID          string
+	CircuitID          string
+	STag               uint32
+	CTag               uint32
+}
+
+/*
+OntNotFoundError - returned when no ont has the serial number, circuit id or nas port id searched for
+*/
+type OntNotFoundError struct {
+	Value string
+}
+
+func (e *OntNotFoundError) Error() string {
+	return fmt.Sprintf("There is no ont with %s", e.Value)
+}
+
+/*
+FindOnt - looks up an ont by serial number, circuit id or nas port id
+*/
+func FindOnt(lookup physical.OntLookup, value string) (OntLocation, error) {
+	// the index says which chassis to lock, the ont is looked up again under its lock in case it moved meanwhile
+	for attempt := 0; attempt < 3; attempt++ {
+		clli, _, _, ok := physical.FindOnt(lookup, value)
+		if !ok {
+			break
+		}
+		chassisHolder := models.RLockChassis(clli)
+		if chassisHolder == nil {
+			continue
+		}
+		found, port, ont, ok := physical.FindOnt(lookup, value)
+		if ok && found == clli {
+			location := ontLocation(port, ont)
+			chassisHolder.RUnlock()
+			return location, nil
+		}
+		chassisHolder.RUnlock()
+	}
+	return OntLocation{}, &OntNotFoundError{Value: value}
+}
+
+/*
+GetOnt - returns the ont at slotNumber/portNumber/ontNumber on the abstract chassis clli whatever state it is in
+*/
+func GetOnt(clli string, slotNumber int, portNumber int, ontNumber int) (OntLocation, error) {
+	chassisHolder := models.RLockChassis(clli)
+	if chassisHolder == nil {
+		return OntLocation{}, &models.ChassisNotFoundError{CLLI: clli}
+	}
+	defer chassisHolder.RUnlock()
+	port, err := chassisHolder.AbstractChassis.PhysicalPort(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return OntLocation{}, err
+	}
+	location := ontLocation(port, &port.Onts[ontNumber-1])
+	// an ont that was never provisioned has no number of its own
+	location.OntNumber = ontNumber
+	return location, nil
+}
+
+func ontLocation(port *physical.PONPort, ont *physical.Ont) OntLocation {
+	location := OntLocation{
+		SlotNumber:         port.AbstractSlot,
+		PortNumber:         port.AbstractPort,
+		OntNumber:          ont.Number,
+		PhysicalPortNumber: port.Number,
+		SerialNumber:       ont.SerialNumber,
+		NasPortID:          ont.NasPortID,
+		CircuitID:          ont.CircuitID,
+		STag:               ont.Svlan,
+		CTag:               ont.Cvlan,
+	}
+	if olt := port.Parent; olt != nil {
+		location.CLLI = olt.CLLI
+		location.Hostname = olt.Hostname
+	}
+	location.State = ont.State.String()
+	return location
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package impl
+
+import (
+	"sync"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+/*
+XOSStatus - whether the XOS a chassis pushes to answered the last check
+*/
+type XOSStatus struct {
+	CLLI      string
+	Address   string
+	Reachable bool
+	Error     string `json:",omitempty"`
+	Checked   time.Time
+}
+
+/*
+MongoStatus - whether mongo answered the last check, only reported when backups go to mongo
+*/
+type MongoStatus struct {
+	Reachable bool
+	Error     string `json:",omitempty"`
+	Checked   time.Time
+}
+
+/*
+Readiness - what the last dependency check found, the server is ready once backups have been restored and mongo, when in
+use, is reachable. XOS is checked per chassis and reported but does not make the server unready, an unreachable XOS only
+fails the changes made to the chassis that push to it
+*/
+type Readiness struct {
+	Ready    bool
+	Restored bool
+	Mongo    *MongoStatus `json:",omitempty"`
+	XOS      []XOSStatus
+}
+
+var healthLock sync.Mutex
+var restored bool
+var mongoStatus *MongoStatus
+var xosStatus []XOSStatus
+
+/*
+SetRestored - records that the chassis and idempotency backups have been loaded
+*/
+func SetRestored() {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	restored = true
+}
+
+/*
+GetReadiness - returns the result of the last CheckDependencies, it never waits on a chassis lock so probes are
+answered while long changes are running
+*/
+func GetReadiness() Readiness {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	readiness := Readiness{Restored: restored, XOS: append([]XOSStatus{}, xosStatus...)}
+	if mongoStatus != nil {
+		status := *mongoStatus
+		readiness.Mongo = &status
+	}
+	readiness.Ready = restored && (mongoStatus == nil || mongoStatus.Reachable)
+	return readiness
+}
+
+/*
+CheckDependencies - checks that the XOS of every chassis and mongo, when in use, answer within timeout and keeps the
+result for GetReadiness
+*/
+func CheckDependencies(timeout time.Duration) {
+	var newMongo *MongoStatus
+	if pinger, ok := storage.(models.StoragePinger); ok {
+		newMongo = &MongoStatus{Reachable: true, Checked: time.Now()}
+		err := pinger.Ping(timeout)
+		if err != nil {
+			newMongo.Reachable = false
+			newMongo.Error = err.Error()
+		}
+	}
+
+	// copy what is needed to reach XOS so no chassis lock is held while waiting on the network
+	var targets []physical.Chassis
+	for _, clli := range models.ChassisCLLIs() {
+		chassisHolder := models.RLockChassis(clli)
+		if chassisHolder == nil {
+			continue
+		}
+		phy := &chassisHolder.PhysicalChassis
+		targets = append(targets, physical.Chassis{CLLI: clli, XOSAddress: phy.XOSAddress, XOSUser: phy.XOSUser, XOSPassword: phy.XOSPassword})
+		chassisHolder.RUnlock()
+	}
+
+	newXOS := make([]XOSStatus, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := &targets[i]
+			status := XOSStatus{CLLI: target.CLLI, Address: target.XOSAddress.String(), Reachable: true}
+			err := target.PingXOS(timeout)
+			if err != nil {
+				status.Reachable = false
+				status.Error = err.Error()
+			}
+			status.Checked = time.Now()
+			newXOS[i] = status
+		}(i)
+	}
+	wg.Wait()
+
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	mongoStatus = newMongo
+	xosStatus = newXOS
+}
@@ -0,0 +1,116 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	context "golang.org/x/net/context"
+)
+
+/*
+unreachableStorage - storage in another process that does not answer its pings
+*/
+type unreachableStorage struct {
+	models.Storage
+}
+
+func (s unreachableStorage) Ping(timeout time.Duration) error {
+	return errors.New("mongo did not answer")
+}
+
+/*
+resetHealth - forgets that the backups were restored and what the last check found, the returned func puts it back
+*/
+func resetHealth() func() {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	wasRestored, wasMongo, wasXOS := restored, mongoStatus, xosStatus
+	restored, mongoStatus, xosStatus = false, nil, nil
+	return func() {
+		healthLock.Lock()
+		defer healthLock.Unlock()
+		restored, mongoStatus, xosStatus = wasRestored, wasMongo, wasXOS
+	}
+}
+
+func TestHealth_Readiness(t *testing.T) {
+	defer resetHealth()()
+	if readiness := GetReadiness(); readiness.Ready || readiness.Restored {
+		t.Fatalf("Expected the server not to be ready before the backups are restored got %+v", readiness)
+	}
+	SetRestored()
+	if readiness := GetReadiness(); !readiness.Ready || !readiness.Restored {
+		t.Fatalf("Expected the server to be ready once the backups are restored got %+v", readiness)
+	}
+}
+
+func TestHealth_CheckDependencies(t *testing.T) {
+	defer tempStorage(t)()
+	defer resetHealth()()
+	settings.SetDummy(true)
+	settings.SetGrpc(false)
+	defer settings.SetDummy(true)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port %v", err)
+	}
+	xosAddress := *listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	clli := "health_clli"
+	_, err = CreateChassis(context.Background(), clli, xosAddress, "user", "password", 1, 1, nil)
+	if err != nil {
+		t.Fatalf("CreateChassis failed with %v", err)
+	}
+	defer func() {
+		if chassisHolder := models.LockChassis(clli); chassisHolder != nil {
+			models.RemoveChassis(clli)
+			chassisHolder.Unlock()
+		}
+	}()
+	SetRestored()
+
+	// an unreachable XOS is reported but only fails the changes to its chassis
+	settings.SetDummy(false)
+	CheckDependencies(time.Second)
+	readiness := GetReadiness()
+	var found *XOSStatus
+	for i := range readiness.XOS {
+		if readiness.XOS[i].CLLI == clli {
+			found = &readiness.XOS[i]
+		}
+	}
+	if found == nil || found.Reachable || found.Error == "" || found.Address != xosAddress.String() || found.Checked.IsZero() {
+		t.Fatalf("Expected the XOS of %s to be reported unreachable got %+v", clli, readiness.XOS)
+	}
+	if !readiness.Ready || readiness.Mongo != nil {
+		t.Fatalf("Expected an unreachable XOS to leave the server ready got %+v", readiness)
+	}
+
+	// unreachable storage makes it unready since nothing could be backed up
+	defer SetStorage(storage)
+	SetStorage(unreachableStorage{storage})
+	CheckDependencies(time.Second)
+	readiness = GetReadiness()
+	if readiness.Ready || readiness.Mongo == nil || readiness.Mongo.Reachable || readiness.Mongo.Error == "" {
+		t.Fatalf("Expected unreachable mongo to make the server unready got %+v", readiness)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	context "golang.org/x/net/context"
+)
+
+/*
+IdempotentResult - the outcome of a mutating call made with an idempotency key, replayed when the key is seen again
+*/
+type IdempotentResult struct {
+	RequestHash  string
+	ResponseType string
+	Response     []byte
+	Status       []byte
+	Expires      time.Time
+}
+
+type idempotentEntry struct {
+	result *IdempotentResult
+	// closed once the first call with the key has finished so duplicates arriving meanwhile can replay it
+	done chan struct{}
+}
+
+var idempotencyLock sync.Mutex
+var idempotencyKeys = make(map[string]*idempotentEntry)
+
+/*
+BeginIdempotent - returns the result recorded for key if there is one, otherwise reserves key and returns nil,
+in which case the caller must call FinishIdempotent once it has a result, a duplicate arriving while the key is
+reserved waits for that result until ctx ends
+*/
+func BeginIdempotent(ctx context.Context, key string) (*IdempotentResult, error) {
+	for {
+		idempotencyLock.Lock()
+		entry, ok := idempotencyKeys[key]
+		if ok && entry.result != nil && time.Now().After(entry.result.Expires) {
+			delete(idempotencyKeys, key)
+			ok = false
+		}
+		if !ok {
+			idempotencyKeys[key] = &idempotentEntry{done: make(chan struct{})}
+			idempotencyLock.Unlock()
+			return nil, nil
+		}
+		if entry.result != nil {
+			idempotencyLock.Unlock()
+			return entry.result, nil
+		}
+		idempotencyLock.Unlock()
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+/*
+FinishIdempotent - records result for a key reserved by BeginIdempotent, a nil result releases the key without
+recording anything. A recorded result is journaled before FinishIdempotent returns
+*/
+func FinishIdempotent(key string, result *IdempotentResult) {
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+	entry := idempotencyKeys[key]
+	if entry == nil || entry.result != nil {
+		return
+	}
+	if result == nil {
+		delete(idempotencyKeys, key)
+	} else {
+		result.Expires = time.Now().Add(settings.GetIdempotencyWindow())
+		entry.result = result
+		markIdempotencyDirty()
+		journalIdempotency(key, result)
+	}
+	close(entry.done)
+}
+
+/*
+serializeIdempotency - returns the unexpired recorded results as json for the backup
+*/
+func serializeIdempotency() ([]byte, error) {
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+	return marshalIdempotency()
+}
+
+/*
+journalIdempotency - journals the result recorded for key so it is not lost to a crash before the next backup
+*/
+func journalIdempotency(key string, result *IdempotentResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Unable to journal the idempotency key %s %v\n", key, err)
+		return
+	}
+	appendJournal(journalEntry{Name: idempotencyBackup, Key: key, Data: data})
+}
+
+/*
+marshalIdempotency - forgets the expired results and returns the rest as json, idempotencyLock must be held
+*/
+func marshalIdempotency() ([]byte, error) {
+	now := time.Now()
+	results := make(map[string]*IdempotentResult)
+	for key, entry := range idempotencyKeys {
+		if entry.result == nil {
+			continue
+		}
+		if now.After(entry.result.Expires) {
+			delete(idempotencyKeys, key)
+			continue
+		}
+		results[key] = entry.result
+	}
+	return json.Marshal(results)
+}
+
+/*
+deserializeIdempotency - restores results written by serializeIdempotency
+*/
+func deserializeIdempotency(data []byte) error {
+	results := make(map[string]*IdempotentResult)
+	err := json.Unmarshal(data, &results)
+	if err != nil {
+		return err
+	}
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+	now := time.Now()
+	for key, result := range results {
+		if now.After(result.Expires) {
+			continue
+		}
+		done := make(chan struct{})
+		close(done)
+		idempotencyKeys[key] = &idempotentEntry{result: result, done: done}
+	}
+	return nil
+}
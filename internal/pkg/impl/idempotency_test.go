@@ -0,0 +1,143 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	context "golang.org/x/net/context"
+)
+
+/*
+uniqueKey - an idempotency key no earlier run of the tests recorded, keys are kept for the whole process
+*/
+func uniqueKey(name string) string {
+	return fmt.Sprintf("%s %d", name, time.Now().UnixNano())
+}
+
+/*
+begin - calls BeginIdempotent with a context that does not end
+*/
+func begin(t *testing.T, key string) *impl.IdempotentResult {
+	result, err := impl.BeginIdempotent(context.Background(), key)
+	if err != nil {
+		t.Fatalf("BeginIdempotent failed with %v", err)
+	}
+	return result
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	key := uniqueKey("replay_key")
+	if result := begin(t, key); result != nil {
+		t.Fatalf("Expected an unused key to be reserved got %v", result)
+	}
+	impl.FinishIdempotent(key, &impl.IdempotentResult{RequestHash: "hash1", Response: []byte("response")})
+	result := begin(t, key)
+	if result == nil || result.RequestHash != "hash1" || string(result.Response) != "response" {
+		t.Fatalf("Expected the recorded result to be replayed got %v", result)
+	}
+	// the caller compares the hash so a different request with the key gets the result of the first to reject it
+	if result := begin(t, key); result == nil || result.RequestHash != "hash1" {
+		t.Fatalf("Expected the hash of the first request with the key got %v", result)
+	}
+}
+
+func TestIdempotency_Release(t *testing.T) {
+	key := uniqueKey("release_key")
+	begin(t, key)
+	impl.FinishIdempotent(key, nil)
+	if result := begin(t, key); result != nil {
+		t.Fatalf("Expected a released key to be reserved again got %v", result)
+	}
+	impl.FinishIdempotent(key, nil)
+}
+
+func TestIdempotency_Expiry(t *testing.T) {
+	key := uniqueKey("expiry_key")
+	settings.SetIdempotencyWindow(time.Millisecond)
+	defer settings.SetIdempotencyWindow(24 * time.Hour)
+	begin(t, key)
+	impl.FinishIdempotent(key, &impl.IdempotentResult{RequestHash: "hash1"})
+	time.Sleep(5 * time.Millisecond)
+	if result := begin(t, key); result != nil {
+		t.Fatalf("Expected an expired key to be reserved again got %v", result)
+	}
+	impl.FinishIdempotent(key, nil)
+}
+
+/*
+beginAsync - calls BeginIdempotent on its own goroutine, what it returns is sent on the channel
+*/
+func beginAsync(key string) <-chan *impl.IdempotentResult {
+	results := make(chan *impl.IdempotentResult, 1)
+	go func() {
+		result, _ := impl.BeginIdempotent(context.Background(), key)
+		results <- result
+	}()
+	return results
+}
+
+func TestIdempotency_WaitingDuplicate(t *testing.T) {
+	key := uniqueKey("waiting_key")
+	begin(t, key)
+	duplicate := beginAsync(key)
+	select {
+	case result := <-duplicate:
+		t.Fatalf("Duplicate did not wait for the first call to finish got %v", result)
+	case <-time.After(20 * time.Millisecond):
+	}
+	impl.FinishIdempotent(key, &impl.IdempotentResult{RequestHash: "hash1"})
+	select {
+	case result := <-duplicate:
+		if result == nil || result.RequestHash != "hash1" {
+			t.Fatalf("Expected the duplicate to get the recorded result got %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Duplicate was not woken when the first call finished")
+	}
+
+	// when the first call records nothing the duplicate reserves the key and runs itself
+	key = uniqueKey("waiting_release_key")
+	begin(t, key)
+	duplicate = beginAsync(key)
+	time.Sleep(20 * time.Millisecond)
+	impl.FinishIdempotent(key, nil)
+	select {
+	case result := <-duplicate:
+		if result != nil {
+			t.Fatalf("Expected the duplicate to reserve the released key got %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Duplicate was not woken when the key was released")
+	}
+	impl.FinishIdempotent(key, nil)
+}
+
+func TestIdempotency_WaitingDuplicateGivesUp(t *testing.T) {
+	key := uniqueKey("waiting_cancelled_key")
+	begin(t, key)
+	defer impl.FinishIdempotent(key, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result, err := impl.BeginIdempotent(ctx, key)
+	if result != nil || err != context.DeadlineExceeded {
+		t.Fatalf("Expected the duplicate to give up when its context ended got %v %v", result, err)
+	}
+}
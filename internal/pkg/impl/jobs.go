@@ -0,0 +1,430 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	context "golang.org/x/net/context"
+)
+
+/*
+JobState - where an async job is, a job that failed in a way that may clear up is retrying until it runs out of attempts
+*/
+type JobState int
+
+// values match the Job.JobState enum in the api
+const (
+	JobQueued JobState = iota
+	JobRunning
+	JobRetrying
+	JobSucceeded
+	JobFailed
+)
+
+var jobStateNames = []string{"queued", "running", "retrying", "succeeded", "failed"}
+
+// the longest a job waits between attempts however many times it has been retried
+const maxJobRetryDelay = 5 * time.Minute
+
+func (state JobState) String() string {
+	if state < JobQueued || int(state) >= len(jobStateNames) {
+		return fmt.Sprintf("JobState(%d)", int(state))
+	}
+	return jobStateNames[state]
+}
+
+/*
+MarshalText - states are written to the backup by name
+*/
+func (state JobState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+/*
+UnmarshalText - the inverse of MarshalText
+*/
+func (state *JobState) UnmarshalText(text []byte) error {
+	for i, name := range jobStateNames {
+		if name == string(text) {
+			*state = JobState(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown job state %s", text)
+}
+
+/*
+Finished - true once the job has succeeded or given up
+*/
+func (state JobState) Finished() bool {
+	return state == JobSucceeded || state == JobFailed
+}
+
+/*
+Job - a mutating call accepted in async mode, Request is the marshalled request the JobRunner replays and once an
+attempt has been made Response or Status hold what it returned
+*/
+type Job struct {
+	ID           string
+	Method       string
+	CLLI         string
+	RequestType  string
+	Request      []byte
+	State        JobState
+	Attempts     int
+	ResponseType string
+	Response     []byte
+	Status       []byte
+	Created      time.Time
+	Updated      time.Time
+	NextAttempt  time.Time
+}
+
+/*
+JobResult - what an attempt at a job returned, the marshalled response or the marshalled status it failed with
+*/
+type JobResult struct {
+	ResponseType string
+	Response     []byte
+	Status       []byte
+}
+
+/*
+JobRunner - makes one attempt at job, retry is set when it failed in a way a later attempt may not
+*/
+type JobRunner func(ctx context.Context, job Job) (result JobResult, retry bool)
+
+/*
+JobNotFoundError - returned when there is no job with the requested ID, finished jobs are forgotten after the
+job retention
+*/
+type JobNotFoundError struct {
+	ID string
+}
+
+func (e *JobNotFoundError) Error() string {
+	return fmt.Sprintf("There is no job with ID %s", e.ID)
+}
+
+/*
+ErrJobsNotStarted - returned when a call asks for async mode but the server runs no job workers
+*/
+var ErrJobsNotStarted = errors.New("Async mode is not enabled on this server")
+
+var jobLock sync.Mutex
+
+// signalled whenever a job is queued or finishes, or a retry is due
+var jobCond = sync.NewCond(&jobLock)
+var jobs = make(map[string]*Job)
+
+// ids of the unfinished jobs in the order they were submitted
+var jobQueue []string
+
+// cllis with a job running, the next job on a chassis waits so jobs on it are applied in the order they were submitted
+var jobBusy = make(map[string]bool)
+var jobsStarted bool
+var jobsStopping bool
+
+// running workers, and the context their attempts run with which StopJobs cancels when it runs out of time
+var jobWorkers sync.WaitGroup
+var jobsContext, cancelJobs = context.WithCancel(context.Background())
+
+/*
+StartJobs - starts workers goroutines that run queued jobs with run, no workers leaves async mode disabled
+*/
+func StartJobs(workers int, run JobRunner) {
+	if workers < 1 {
+		return
+	}
+	jobLock.Lock()
+	jobsStarted = true
+	jobLock.Unlock()
+	for i := 0; i < workers; i++ {
+		jobWorkers.Add(1)
+		go jobWorker(run)
+	}
+}
+
+/*
+StopJobs - stops starting jobs and waits for the attempts already running, once ctx ends they are cancelled. Jobs
+that have not finished stay queued and carry on after a restart
+*/
+func StopJobs(ctx context.Context) {
+	jobLock.Lock()
+	jobsStopping = true
+	jobCond.Broadcast()
+	jobLock.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		jobWorkers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		cancelJobs()
+		<-stopped
+	}
+}
+
+/*
+SubmitJob - queues request, the marshalled request of type requestType for method on the chassis clli, and returns
+the ID of the job that will run it. The job is journaled before SubmitJob returns
+*/
+func SubmitJob(method string, clli string, requestType string, request []byte) (string, error) {
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	if !jobsStarted {
+		return "", ErrJobsNotStarted
+	}
+	now := time.Now()
+	job := &Job{ID: id, Method: method, CLLI: clli, RequestType: requestType, Request: request, State: JobQueued,
+		Created: now, Updated: now}
+	jobs[id] = job
+	jobQueue = append(jobQueue, id)
+	markJobsDirty()
+	journalJob(job)
+	jobCond.Broadcast()
+	return id, nil
+}
+
+/*
+GetJob - returns the job with id
+*/
+func GetJob(id string) (Job, error) {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	pruneJobs()
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, &JobNotFoundError{ID: id}
+	}
+	return *job, nil
+}
+
+/*
+ListJobs - returns the jobs on the chassis clli, or every job when clli is empty, oldest first
+*/
+func ListJobs(clli string) []Job {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	pruneJobs()
+	list := []Job{}
+	for _, job := range jobs {
+		if clli == "" || job.CLLI == clli {
+			list = append(list, *job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+func jobWorker(run JobRunner) {
+	defer jobWorkers.Done()
+	for {
+		job, ok := nextJob()
+		if !ok {
+			return
+		}
+		result, retry := run(jobsContext, job)
+		finishJob(job.ID, result, retry)
+	}
+}
+
+/*
+nextJob - waits for the oldest job that is due and has no earlier unfinished job on its chassis and marks it running,
+returns false once StopJobs has been called
+*/
+func nextJob() (Job, bool) {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	for {
+		if jobsStopping {
+			return Job{}, false
+		}
+		now := time.Now()
+		blocked := make(map[string]bool)
+		for _, id := range jobQueue {
+			job := jobs[id]
+			if blocked[job.CLLI] || jobBusy[job.CLLI] {
+				continue
+			}
+			blocked[job.CLLI] = true
+			if job.State == JobRetrying && now.Before(job.NextAttempt) {
+				continue
+			}
+			job.State = JobRunning
+			job.Attempts++
+			job.Updated = now
+			jobBusy[job.CLLI] = true
+			markJobsDirty()
+			return *job, true
+		}
+		jobCond.Wait()
+	}
+}
+
+/*
+finishJob - records the outcome of an attempt at job id, a failure that may clear up is retried after a delay that
+doubles with each attempt until settings.GetJobAttempts have been made. The outcome is journaled so a finished job
+is not run again after a crash
+*/
+func finishJob(id string, result JobResult, retry bool) {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	job := jobs[id]
+	delete(jobBusy, job.CLLI)
+	job.ResponseType = result.ResponseType
+	job.Response = result.Response
+	job.Status = result.Status
+	job.Updated = time.Now()
+	switch {
+	case result.Status == nil:
+		job.State = JobSucceeded
+	case jobsContext.Err() != nil:
+		// cut short by StopJobs so it does not count as an attempt
+		job.State = JobQueued
+		job.Attempts--
+	case retry && job.Attempts < settings.GetJobAttempts():
+		job.State = JobRetrying
+		delay := settings.GetJobRetryDelay()
+		for i := 1; i < job.Attempts && delay < maxJobRetryDelay; i++ {
+			delay *= 2
+		}
+		if delay > maxJobRetryDelay {
+			delay = maxJobRetryDelay
+		}
+		job.NextAttempt = job.Updated.Add(delay)
+		time.AfterFunc(delay, jobCond.Broadcast)
+	default:
+		job.State = JobFailed
+	}
+	if job.State.Finished() {
+		for i, queued := range jobQueue {
+			if queued == id {
+				jobQueue = append(jobQueue[:i], jobQueue[i+1:]...)
+				break
+			}
+		}
+	}
+	markJobsDirty()
+	journalJob(job)
+	jobCond.Broadcast()
+}
+
+/*
+pruneJobs - forgets finished jobs older than the job retention, jobLock must be held
+*/
+func pruneJobs() {
+	expired := time.Now().Add(-settings.GetJobRetention())
+	for id, job := range jobs {
+		if job.State.Finished() && job.Updated.Before(expired) {
+			delete(jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+/*
+serializeJobs - returns the unfinished jobs and the finished ones still retained as json for the backup
+*/
+func serializeJobs() ([]byte, error) {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	return marshalJobs()
+}
+
+/*
+journalJob - journals job so one submitted or finished is not lost to a crash before the next backup, it is journaled
+under jobLock so the last entry replayed for it is the latest. jobLock must be held
+*/
+func journalJob(job *Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Unable to journal job %s %v\n", job.ID, err)
+		return
+	}
+	appendJournal(journalEntry{Name: jobsBackup, Key: job.ID, Data: data})
+}
+
+/*
+marshalJobs - forgets the finished jobs past the job retention and returns the rest as json, jobLock must be held
+*/
+func marshalJobs() ([]byte, error) {
+	pruneJobs()
+	list := make([]*Job, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job)
+	}
+	return json.Marshal(list)
+}
+
+/*
+deserializeJobs - restores jobs written by serializeJobs, a job that was running when the backup was written is
+queued again since its attempt was cut short
+*/
+func deserializeJobs(data []byte) error {
+	list := []*Job{}
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	for _, job := range list {
+		jobs[job.ID] = job
+		if job.State.Finished() {
+			continue
+		}
+		if job.State == JobRunning {
+			job.State = JobQueued
+		}
+		if job.State == JobRetrying {
+			time.AfterFunc(time.Until(job.NextAttempt), jobCond.Broadcast)
+		}
+		jobQueue = append(jobQueue, job.ID)
+	}
+	pruneJobs()
+	jobCond.Broadcast()
+	return nil
+}
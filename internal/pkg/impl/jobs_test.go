@@ -0,0 +1,245 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	context "golang.org/x/net/context"
+)
+
+/*
+resetJobs - forgets every job and lets jobs be submitted again without workers, the job queue is package state so
+these tests sit next to it rather than in impl_test
+*/
+func resetJobs() {
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	jobs = make(map[string]*Job)
+	jobQueue = nil
+	jobBusy = make(map[string]bool)
+	jobsStarted = true
+	jobsStopping = false
+	jobsContext, cancelJobs = context.WithCancel(context.Background())
+}
+
+/*
+jobSettings - sets the attempts and first retry delay of async jobs, the returned func puts back the ones before
+*/
+func jobSettings(attempts int, delay time.Duration) func() {
+	oldAttempts, oldDelay := settings.GetJobAttempts(), settings.GetJobRetryDelay()
+	settings.SetJobAttempts(attempts)
+	settings.SetJobRetryDelay(delay)
+	return func() {
+		settings.SetJobAttempts(oldAttempts)
+		settings.SetJobRetryDelay(oldDelay)
+	}
+}
+
+func submitJob(t *testing.T, clli string) string {
+	id, err := SubmitJob("ProvisionOnt", clli, "api.AddOntMessage", []byte(clli))
+	if err != nil {
+		t.Fatalf("SubmitJob failed with %v", err)
+	}
+	return id
+}
+
+/*
+nextJobWithin - returns the job nextJob hands out, ok is false when it hands out none within wait. A nextJob still
+waiting is released so it can not take a job later
+*/
+func nextJobWithin(wait time.Duration) (Job, bool) {
+	type next struct {
+		job Job
+		ok  bool
+	}
+	result := make(chan next, 1)
+	go func() {
+		job, ok := nextJob()
+		result <- next{job, ok}
+	}()
+	select {
+	case <-time.After(wait):
+		jobLock.Lock()
+		jobsStopping = true
+		jobCond.Broadcast()
+		jobLock.Unlock()
+	case got := <-result:
+		return got.job, got.ok
+	}
+	got := <-result
+	jobLock.Lock()
+	jobsStopping = false
+	jobLock.Unlock()
+	return got.job, got.ok
+}
+
+func TestJobs_NextJobOrder(t *testing.T) {
+	resetJobs()
+	defer resetJobs()
+	defer jobSettings(3, time.Hour)()
+	first := submitJob(t, "clli1")
+	second := submitJob(t, "clli1")
+	other := submitJob(t, "clli2")
+
+	// the second job on clli1 waits for the first while clli2 carries on
+	job, _ := nextJob()
+	if job.ID != first || job.State != JobRunning || job.Attempts != 1 {
+		t.Fatalf("Expected the first job to run got %v", job)
+	}
+	job, _ = nextJob()
+	if job.ID != other {
+		t.Fatalf("Expected the job on clli2 to run while clli1 is busy got %s", job.ID)
+	}
+	if job, ok := nextJobWithin(50 * time.Millisecond); ok {
+		t.Fatalf("Job %s ran while an earlier job on its chassis was running", job.ID)
+	}
+
+	// a job waiting to be retried still holds back the jobs submitted after it on its chassis
+	finishJob(first, JobResult{Status: []byte("unavailable")}, true)
+	if job, ok := nextJobWithin(50 * time.Millisecond); ok {
+		t.Fatalf("Job %s ran before the retry of an earlier job on its chassis", job.ID)
+	}
+	jobLock.Lock()
+	jobs[first].NextAttempt = time.Now()
+	jobLock.Unlock()
+	job, _ = nextJob()
+	if job.ID != first || job.Attempts != 2 {
+		t.Fatalf("Expected the first job to be retried once due got %v", job)
+	}
+	finishJob(first, JobResult{ResponseType: "api.AddOntReturn"}, false)
+	job, _ = nextJob()
+	if job.ID != second {
+		t.Fatalf("Expected the second job on clli1 once the first finished got %s", job.ID)
+	}
+}
+
+func TestJobs_FinishJobBackoff(t *testing.T) {
+	resetJobs()
+	defer resetJobs()
+	defer jobSettings(3, time.Second)()
+	id := submitJob(t, "backoff_clli")
+
+	// each retry waits twice as long as the one before until the attempts run out
+	for attempt, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		nextJob()
+		finishJob(id, JobResult{Status: []byte("unavailable")}, true)
+		job, _ := GetJob(id)
+		if job.State != JobRetrying || job.Attempts != attempt+1 || job.NextAttempt.Sub(job.Updated) != delay {
+			t.Fatalf("Expected attempt %d to be retried after %v got %v %d %v", attempt+1, delay, job.State, job.Attempts, job.NextAttempt.Sub(job.Updated))
+		}
+		jobLock.Lock()
+		jobs[id].NextAttempt = time.Now()
+		jobLock.Unlock()
+	}
+	nextJob()
+	finishJob(id, JobResult{Status: []byte("unavailable")}, true)
+	job, _ := GetJob(id)
+	if job.State != JobFailed || job.Attempts != 3 || len(jobQueue) != 0 {
+		t.Fatalf("Expected the job to fail after 3 attempts got %v %d queue %v", job.State, job.Attempts, jobQueue)
+	}
+
+	// the wait is capped however many attempts have been made
+	settings.SetJobRetryDelay(4 * time.Minute)
+	id = submitJob(t, "backoff_clli")
+	jobLock.Lock()
+	jobs[id].Attempts = 1
+	jobLock.Unlock()
+	nextJob()
+	finishJob(id, JobResult{Status: []byte("unavailable")}, true)
+	if job, _ = GetJob(id); job.NextAttempt.Sub(job.Updated) != maxJobRetryDelay {
+		t.Fatalf("Expected the retry delay to be capped at %v got %v", maxJobRetryDelay, job.NextAttempt.Sub(job.Updated))
+	}
+
+	// a failure that will not clear up is not retried and a success keeps what was returned
+	id = submitJob(t, "final_clli")
+	nextJob()
+	finishJob(id, JobResult{Status: []byte("invalid")}, false)
+	if job, _ = GetJob(id); job.State != JobFailed || job.Attempts != 1 || string(job.Status) != "invalid" {
+		t.Fatalf("Expected a job that can not be retried to fail at once got %v", job)
+	}
+	id = submitJob(t, "final_clli")
+	nextJob()
+	finishJob(id, JobResult{ResponseType: "api.AddOntReturn", Response: []byte("done")}, false)
+	if job, _ = GetJob(id); job.State != JobSucceeded || string(job.Response) != "done" || job.ResponseType != "api.AddOntReturn" {
+		t.Fatalf("Expected the job to succeed with its response got %v", job)
+	}
+}
+
+func TestJobs_StopJobsRequeue(t *testing.T) {
+	resetJobs()
+	defer resetJobs()
+	defer jobSettings(3, time.Second)()
+	running := make(chan struct{})
+	StartJobs(1, func(ctx context.Context, job Job) (JobResult, bool) {
+		close(running)
+		<-ctx.Done()
+		return JobResult{Status: []byte("canceled")}, true
+	})
+	id := submitJob(t, "stop_clli")
+	<-running
+
+	// the attempt does not end by itself so it is cancelled once StopJobs runs out of time
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	StopJobs(ctx)
+	job, _ := GetJob(id)
+	if job.State != JobQueued || job.Attempts != 0 {
+		t.Fatalf("Expected the cancelled job to be queued again without using an attempt got %v %d", job.State, job.Attempts)
+	}
+	if len(jobQueue) != 1 || jobQueue[0] != id || jobBusy["stop_clli"] {
+		t.Fatalf("Expected the cancelled job to stay first in the queue got %v busy %v", jobQueue, jobBusy)
+	}
+}
+
+func TestJobs_DeserializeJobs(t *testing.T) {
+	resetJobs()
+	defer resetJobs()
+	now := time.Now()
+	backup := []*Job{
+		{ID: "running", CLLI: "clli1", State: JobRunning, Attempts: 1, Created: now.Add(-time.Minute), Updated: now},
+		{ID: "queued", CLLI: "clli1", State: JobQueued, Created: now.Add(-2 * time.Minute), Updated: now},
+		{ID: "retrying", CLLI: "clli2", State: JobRetrying, Attempts: 1, Created: now, Updated: now, NextAttempt: now.Add(time.Hour)},
+		{ID: "succeeded", CLLI: "clli2", State: JobSucceeded, Attempts: 1, Created: now, Updated: now},
+		{ID: "expired", CLLI: "clli2", State: JobFailed, Attempts: 3, Created: now.Add(-48 * time.Hour), Updated: now.Add(-48 * time.Hour)},
+	}
+	data, err := json.Marshal(backup)
+	if err != nil {
+		t.Fatalf("Unable to marshal the jobs %v", err)
+	}
+	err = deserializeJobs(data)
+	if err != nil {
+		t.Fatalf("deserializeJobs failed with %v", err)
+	}
+
+	// the attempt cut short by the restart is made again, unfinished jobs are queued oldest first
+	if job, _ := GetJob("running"); job.State != JobQueued || job.Attempts != 1 {
+		t.Fatalf("Expected the running job to be queued again got %v", job)
+	}
+	if !reflect.DeepEqual(jobQueue, []string{"queued", "running", "retrying"}) {
+		t.Fatalf("Expected the unfinished jobs queued oldest first got %v", jobQueue)
+	}
+	if job, err := GetJob("succeeded"); err != nil || job.State != JobSucceeded {
+		t.Fatalf("Expected the finished job to be kept got %v %v", job, err)
+	}
+	if _, err := GetJob("expired"); err == nil {
+		t.Fatal("Expected a finished job older than the retention to be forgotten")
+	}
+}
@@ -0,0 +1,477 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+// the journal is a directory of segments written one after the other, each a json journalEntry per line. It is not
+// a write-ahead log, a change is journaled once it has been made so one cut short by a crash is not in it
+const journalSuffix = ".journal"
+
+/*
+journalEntry - what a change left the backup Name as, or that it was deleted. With a Key only that part of the backup
+changed, the ont at slot/port/ont of a chassis, an idempotency key or a job ID, and Data is what it was left as
+*/
+type journalEntry struct {
+	Name    string
+	Key     string          `json:",omitempty"`
+	Data    json.RawMessage `json:",omitempty"`
+	Deleted bool            `json:",omitempty"`
+}
+
+// the abstract slot/port/ont of an ont that changed
+type ontPosition struct {
+	slot int
+	port int
+	ont  int
+}
+
+/*
+unjournaledChanges - what changed on a chassis while it was locked, the whole chassis when anything other than its
+onts changed
+*/
+type unjournaledChanges struct {
+	chassis bool
+	onts    map[ontPosition]bool
+}
+
+var journalLock sync.Mutex
+var journalDir string
+var journalFile *os.File
+var journalSegment int
+var journalSize int64
+var journalMaxSize int64
+var journalCompacting bool
+
+// chassis changed while locked that are journaled before the lock is released
+var unjournaled = make(map[string]*unjournaledChanges)
+
+/*
+OpenJournal - replays the journal in dir into the storage and starts a new one, every change to a chassis is then
+synced to it once it has been made and before the call that made it returns. Once the journal grows past maxSize a
+backup is taken so it can be discarded. Must be called after SetStorage and before the chassis are restored
+*/
+func OpenJournal(dir string, maxSize int64) error {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return err
+	}
+	err = replayJournal(dir, segments)
+	if err != nil {
+		return err
+	}
+	journalDir = dir
+	journalMaxSize = maxSize
+	if len(segments) > 0 {
+		journalSegment = segments[len(segments)-1]
+	}
+	err = startSegment()
+	if err != nil {
+		return err
+	}
+	removeSegments(dir, segments)
+	return nil
+}
+
+/*
+journalSegments - returns the numbers of the segments in dir in the order they were written
+*/
+func journalSegments(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := []int{}
+	for _, file := range files {
+		var segment int
+		if !strings.HasSuffix(file.Name(), journalSuffix) {
+			continue
+		}
+		_, err := fmt.Sscanf(file.Name(), "%d"+journalSuffix, &segment)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func segmentFile(dir string, segment int) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", segment, journalSuffix))
+}
+
+/*
+replayJournal - saves what the entries found in segments left each backup as to the storage, an entry cut short by
+a crash ends its segment
+*/
+func replayJournal(dir string, segments []int) error {
+	replayed := make(map[string]*replayedBackup)
+	var names []string
+	for _, segment := range segments {
+		file, err := os.Open(segmentFile(dir, segment))
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<30)
+		for scanner.Scan() {
+			entry := journalEntry{}
+			err := json.Unmarshal(scanner.Bytes(), &entry)
+			if err != nil {
+				log.Printf("Ignoring the rest of journal segment %d %v\n", segment, err)
+				break
+			}
+			backup, ok := replayed[entry.Name]
+			if !ok {
+				backup = &replayedBackup{}
+				replayed[entry.Name] = backup
+				names = append(names, entry.Name)
+			}
+			if entry.Key == "" {
+				backup.last = &entry
+				backup.changes = nil
+			} else {
+				backup.changes = append(backup.changes, entry)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		err := replayed[name].replay(name)
+		if err != nil {
+			return fmt.Errorf("Unable to replay the journal for %s %v", name, err)
+		}
+	}
+	if len(names) > 0 {
+		log.Printf("Replayed changes to %d backups from the journal\n", len(names))
+	}
+	return nil
+}
+
+/*
+replayedBackup - the last entry that saved or deleted a whole backup and the changes to parts of it journaled since
+*/
+type replayedBackup struct {
+	last    *journalEntry
+	changes []journalEntry
+}
+
+/*
+replay - applies the changes to the backup name was last saved as, in the journal or else in the storage
+*/
+func (backup *replayedBackup) replay(name string) error {
+	if backup.last != nil && backup.last.Deleted {
+		if len(backup.changes) > 0 {
+			return fmt.Errorf("%d changes were journaled after it was deleted", len(backup.changes))
+		}
+		return storage.Delete(name)
+	}
+	var data []byte
+	var err error
+	if backup.last != nil {
+		data = backup.last.Data
+	} else {
+		data, err = readBackup(name)
+		if err != nil {
+			return err
+		}
+	}
+	switch name {
+	case idempotencyBackup:
+		data, err = replayIdempotency(data, backup.changes)
+	case jobsBackup:
+		data, err = replayJobs(data, backup.changes)
+	default:
+		data, err = replayOnts(data, backup.changes)
+	}
+	if err != nil {
+		return err
+	}
+	return storage.Save(name, data)
+}
+
+/*
+replayIdempotency - sets the results journaled for each key in the idempotency backup data
+*/
+func replayIdempotency(data []byte, changes []journalEntry) ([]byte, error) {
+	if len(changes) == 0 {
+		return data, nil
+	}
+	results := make(map[string]json.RawMessage)
+	if data != nil {
+		err := json.Unmarshal(data, &results)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range changes {
+		results[change.Key] = change.Data
+	}
+	return json.Marshal(results)
+}
+
+/*
+replayJobs - replaces or adds each journaled job in the jobs backup data
+*/
+func replayJobs(data []byte, changes []journalEntry) ([]byte, error) {
+	if len(changes) == 0 {
+		return data, nil
+	}
+	list := []*Job{}
+	if data != nil {
+		err := json.Unmarshal(data, &list)
+		if err != nil {
+			return nil, err
+		}
+	}
+	index := make(map[string]int)
+	for i, job := range list {
+		index[job.ID] = i
+	}
+	for _, change := range changes {
+		job := &Job{}
+		err := json.Unmarshal(change.Data, job)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[change.Key]; ok {
+			list[i] = job
+			continue
+		}
+		index[change.Key] = len(list)
+		list = append(list, job)
+	}
+	return json.Marshal(list)
+}
+
+/*
+replayOnts - puts each journaled ont at its slot/port/ont of the chassis backup data
+*/
+func replayOnts(data []byte, changes []journalEntry) ([]byte, error) {
+	if len(changes) == 0 {
+		return data, nil
+	}
+	if data == nil {
+		return nil, errors.New("Onts were journaled for a chassis that was never backed up")
+	}
+	chassisHolder := models.ChassisHolder{}
+	err := chassisHolder.Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		var position ontPosition
+		_, err := fmt.Sscanf(change.Key, "%d/%d/%d", &position.slot, &position.port, &position.ont)
+		if err != nil {
+			return nil, err
+		}
+		port, err := chassisHolder.AbstractChassis.PhysicalPort(position.slot, position.port, position.ont)
+		if err != nil {
+			return nil, err
+		}
+		ont := physical.Ont{}
+		err = json.Unmarshal(change.Data, &ont)
+		if err != nil {
+			return nil, err
+		}
+		ont.Parent = port
+		port.Onts[position.ont-1] = ont
+	}
+	return chassisHolder.Serialize()
+}
+
+/*
+startSegment - closes the segment being written and starts the next one, journalLock must be held
+*/
+func startSegment() error {
+	if journalFile != nil {
+		journalFile.Close()
+		journalFile = nil
+	}
+	file, err := os.OpenFile(segmentFile(journalDir, journalSegment+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	journalSegment++
+	journalFile = file
+	journalSize = 0
+	journalCompacting = false
+	return nil
+}
+
+func removeSegments(dir string, segments []int) {
+	for _, segment := range segments {
+		err := os.Remove(segmentFile(dir, segment))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Unable to remove journal segment %d %v\n", segment, err)
+		}
+	}
+}
+
+/*
+rotateJournal - starts a new segment and returns the ones before it, which can be removed once everything marked
+dirty before the rotation has been backed up. Returns nil when there is no journal
+*/
+func rotateJournal() []int {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	if journalFile == nil {
+		return nil
+	}
+	err := startSegment()
+	if err != nil {
+		// keep appending to the open segment, it is discarded by a later rotation
+		log.Printf("Unable to start a new journal segment %v\n", err)
+		return nil
+	}
+	segments, err := journalSegments(journalDir)
+	if err != nil {
+		log.Printf("Unable to list the journal %v\n", err)
+		return nil
+	}
+	var done []int
+	for _, segment := range segments {
+		if segment < journalSegment {
+			done = append(done, segment)
+		}
+	}
+	return done
+}
+
+/*
+discardJournal - removes segments returned by rotateJournal
+*/
+func discardJournal(segments []int) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	removeSegments(journalDir, segments)
+}
+
+/*
+appendJournal - writes entry and syncs it to disk, a failure is logged since the change has already been made and
+is still backed up by the next DoOutput
+*/
+func appendJournal(entry journalEntry) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	if journalFile == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Unable to journal the change to %s %v\n", entry.Name, err)
+		return
+	}
+	n, err := journalFile.Write(append(line, '\n'))
+	journalSize += int64(n)
+	if err == nil {
+		err = journalFile.Sync()
+	}
+	if err != nil {
+		log.Printf("Unable to journal the change to %s %v\n", entry.Name, err)
+		return
+	}
+	if journalSize > journalMaxSize && !journalCompacting {
+		journalCompacting = true
+		go DoOutput()
+	}
+}
+
+func markUnjournaled(clli string) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	unjournaledChangesTo(clli).chassis = true
+}
+
+func markOntUnjournaled(clli string, position ontPosition) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	unjournaledChangesTo(clli).onts[position] = true
+}
+
+// journalLock must be held
+func unjournaledChangesTo(clli string) *unjournaledChanges {
+	changes, ok := unjournaled[clli]
+	if !ok {
+		changes = &unjournaledChanges{onts: make(map[ontPosition]bool)}
+		unjournaled[clli] = changes
+	}
+	return changes
+}
+
+/*
+journalChanges - journals what changed on chassisHolder since it was last journaled, only the onts that changed
+unless something else on the chassis did. The caller must hold its lock
+*/
+func journalChanges(chassisHolder *models.ChassisHolder) {
+	clli := chassisHolder.PhysicalChassis.CLLI
+	journalLock.Lock()
+	changes := unjournaled[clli]
+	delete(unjournaled, clli)
+	journalLock.Unlock()
+	if changes == nil {
+		return
+	}
+	if changes.chassis {
+		data, err := chassisHolder.Serialize()
+		if err != nil {
+			log.Printf("Unable to journal the change to %s %v\n", clli, err)
+			return
+		}
+		appendJournal(journalEntry{Name: clli, Data: data})
+		return
+	}
+	for position := range changes.onts {
+		port, err := chassisHolder.AbstractChassis.PhysicalPort(position.slot, position.port, position.ont)
+		if err != nil {
+			// nothing there to have changed
+			continue
+		}
+		data, err := json.Marshal(port.Onts[position.ont-1])
+		if err != nil {
+			log.Printf("Unable to journal the change to %s %v\n", clli, err)
+			continue
+		}
+		key := fmt.Sprintf("%d/%d/%d", position.slot, position.port, position.ont)
+		appendJournal(journalEntry{Name: clli, Key: key, Data: data})
+	}
+}
@@ -0,0 +1,275 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models"
+	context "golang.org/x/net/context"
+)
+
+/*
+tempStorage - backs up to a new temporary directory, the returned func removes it
+*/
+func tempStorage(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v", err)
+	}
+	SetStorage(models.NewFileStorage(dir))
+	return func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func writeSegment(t *testing.T, dir string, segment int, lines string) {
+	err := ioutil.WriteFile(segmentFile(dir, segment), []byte(lines), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write journal segment %d %v", segment, err)
+	}
+}
+
+func TestJournal_Replay(t *testing.T) {
+	defer tempStorage(t)()
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Unable to create a journal directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	storage.Save("clli2", []byte(`{"backup":2}`))
+
+	// the last entry for each name wins across segments, the line a crash cut short is ignored
+	writeSegment(t, dir, 1, `{"Name":"clli1","Data":{"change":1}}
+{"Name":"clli2","Data":{"change":1}}
+{"Name":"clli1","Data":{"change":2}}
+`)
+	writeSegment(t, dir, 2, `{"Name":"clli2","Deleted":true}
+{"Name":".jobs","Data":[{"ID":"job1"}]}
+{"Name":".jobs","Key":"job2","Data":{"ID":"job2"}}
+{"Name":".jobs","Key":"job1","Data":{"ID":"job1","Attempts":1}}
+{"Name":"clli1","Data":{"cha`)
+	segments, err := journalSegments(dir)
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("Expected 2 journal segments got %v %v", segments, err)
+	}
+	err = replayJournal(dir, segments)
+	if err != nil {
+		t.Fatalf("replayJournal failed with %v", err)
+	}
+	if data, err := storage.Load("clli1"); err != nil || string(data) != `{"change":2}` {
+		t.Fatalf("Expected the last whole entry for clli1 got %s %v", data, err)
+	}
+	if _, err := storage.Load("clli2"); err == nil {
+		t.Fatal("Expected clli2 to be deleted from the storage")
+	}
+	list := []*Job{}
+	data, err := storage.Load(jobsBackup)
+	if err == nil {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil || len(list) != 2 || list[0].ID != "job1" || list[0].Attempts != 1 || list[1].ID != "job2" {
+		t.Fatalf("Expected job1 to be replaced and job2 added got %s %v", data, err)
+	}
+}
+
+func TestJournal_OntChanges(t *testing.T) {
+	defer tempStorage(t)()
+	settings.SetDummy(true)
+	settings.SetGrpc(false)
+	ctx := context.Background()
+	clli := "journal_onts"
+	_, err := CreateChassis(ctx, clli, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}, "user", "password", 1, 1, nil)
+	if err != nil {
+		t.Fatalf("CreateChassis failed with %v", err)
+	}
+	defer func() {
+		if chassisHolder := models.LockChassis(clli); chassisHolder != nil {
+			chassisHolder.PhysicalChassis.UnindexOnts()
+			models.RemoveChassis(clli)
+			chassisHolder.Unlock()
+		}
+	}()
+	_, err = CreateOLTChassis(ctx, clli, "edgecore", "openolt", net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, clli+"_olt1", nil)
+	if err != nil {
+		t.Fatalf("CreateOLTChassis failed with %v", err)
+	}
+	_, err = FlushOutput()
+	if err != nil {
+		t.Fatalf("FlushOutput failed with %v", err)
+	}
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Unable to create a journal directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = OpenJournal(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenJournal failed with %v", err)
+	}
+	defer func() {
+		journalLock.Lock()
+		journalFile.Close()
+		journalFile = nil
+		journalLock.Unlock()
+	}()
+
+	_, err = ProvisionOnt(ctx, clli, 1, 1, 1, "JOURNALED1", nil)
+	if err != nil {
+		t.Fatalf("ProvisionOnt failed with %v", err)
+	}
+	_, err = ProvisionOnt(ctx, clli, 1, 1, 2, "JOURNALED2", nil)
+	if err != nil {
+		t.Fatalf("ProvisionOnt failed with %v", err)
+	}
+	// only the onts are journaled, not the chassis they are on
+	segments, _ := journalSegments(dir)
+	data, err := ioutil.ReadFile(segmentFile(dir, segments[len(segments)-1]))
+	if err != nil {
+		t.Fatalf("Unable to read the journal %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i, expected := range []string{"1/1/1", "1/1/2"} {
+		entry := journalEntry{}
+		if i >= len(lines) || json.Unmarshal([]byte(lines[i]), &entry) != nil || entry.Name != clli || entry.Key != expected {
+			t.Fatalf("Expected ont %s to be journaled on its own got %s", expected, data)
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 journal entries got %s", data)
+	}
+
+	err = replayJournal(dir, segments)
+	if err != nil {
+		t.Fatalf("replayJournal failed with %v", err)
+	}
+	data, err = storage.Load(clli)
+	if err != nil {
+		t.Fatalf("Unable to load the backup of %s %v", clli, err)
+	}
+	chassisHolder := models.ChassisHolder{}
+	err = chassisHolder.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed with %v", err)
+	}
+	port, err := chassisHolder.AbstractChassis.PhysicalPort(1, 1, 1)
+	if err != nil {
+		t.Fatalf("PhysicalPort failed with %v", err)
+	}
+	if port.Onts[0].SerialNumber != "JOURNALED1" || port.Onts[1].SerialNumber != "JOURNALED2" || !port.Onts[0].Provisioned() {
+		t.Fatalf("Expected the journaled onts to be replayed into the backup got %+v %+v", port.Onts[0], port.Onts[1])
+	}
+}
+
+func TestJournal_IdempotencyAndJobs(t *testing.T) {
+	defer tempStorage(t)()
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Unable to create a journal directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = OpenJournal(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenJournal failed with %v", err)
+	}
+	defer func() {
+		journalLock.Lock()
+		journalFile.Close()
+		journalFile = nil
+		journalLock.Unlock()
+	}()
+	resetJobs()
+	defer resetJobs()
+
+	// keys are kept for the whole process so each run journals one of its own
+	key := fmt.Sprintf("journaled-key %d", time.Now().UnixNano())
+	BeginIdempotent(context.Background(), key)
+	FinishIdempotent(key, &IdempotentResult{RequestHash: "hash", ResponseType: "api.AddOntReturn"})
+	id := submitJob(t, "journal_clli")
+
+	// replayed as a restart after a crash would, before anything was backed up
+	segments, _ := journalSegments(dir)
+	err = replayJournal(dir, segments)
+	if err != nil {
+		t.Fatalf("replayJournal failed with %v", err)
+	}
+	if data, err := storage.Load(idempotencyBackup); err != nil || !strings.Contains(string(data), key) {
+		t.Fatalf("Expected the idempotency key to be journaled got %s %v", data, err)
+	}
+	if data, err := storage.Load(jobsBackup); err != nil || !strings.Contains(string(data), id) {
+		t.Fatalf("Expected the submitted job to be journaled got %s %v", data, err)
+	}
+}
+
+func TestJournal_KeptWhenBackupFails(t *testing.T) {
+	defer tempStorage(t)()
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("Unable to create a journal directory %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = OpenJournal(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenJournal failed with %v", err)
+	}
+	defer func() {
+		journalLock.Lock()
+		journalFile.Close()
+		journalFile = nil
+		journalLock.Unlock()
+		takeDirty()
+	}()
+	appendJournal(journalEntry{Name: jobsBackup, Key: "kept", Data: []byte(`{"ID":"kept"}`)})
+
+	// json can not write a year past 9999 so the idempotency keys can not be serialized
+	key := fmt.Sprintf("unserializable-key %d", time.Now().UnixNano())
+	done := make(chan struct{})
+	close(done)
+	idempotencyLock.Lock()
+	idempotencyKeys[key] = &idempotentEntry{result: &IdempotentResult{Expires: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)}, done: done}
+	idempotencyLock.Unlock()
+	defer func() {
+		idempotencyLock.Lock()
+		delete(idempotencyKeys, key)
+		idempotencyLock.Unlock()
+	}()
+	markIdempotencyDirty()
+	written, _ := journalSegments(dir)
+
+	ok, err := DoOutput()
+	if ok || err == nil {
+		t.Fatalf("Expected DoOutput to fail to serialize the idempotency keys got %t %v", ok, err)
+	}
+	if _, err := storage.Load(idempotencyBackup); err == nil {
+		t.Fatal("Expected no idempotency backup to be saved")
+	}
+	segments, _ := journalSegments(dir)
+	if len(written) != 1 || len(segments) != 2 || segments[0] != written[0] {
+		t.Fatalf("Expected the journal written before the failed backup to be kept got segments %v", segments)
+	}
+	_, idempotency, _ := takeDirty()
+	if !idempotency {
+		t.Fatal("Expected the idempotency keys to be backed up again by the next DoOutput")
+	}
+}
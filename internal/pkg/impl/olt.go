@@ -17,28 +17,27 @@
 package impl
 
 import (
-	"errors"
 	"fmt"
 	"net"
 
-	"gerrit.opencord.org/abstract-olt/models"
 	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
 )
 
 /*
-CreateOLTChassis adds an OLT chassis/line card to the Physical chassis
+CreateOLTChassis adds an OLT chassis/line card to the Physical chassis, the hostname must not be in use in the
+chassis since olts are looked up by it
 */
-func CreateOLTChassis(clli string, oltType string, driver string, address net.TCPAddr, hostname string) (string, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return "", errors.New(errString)
+func CreateOLTChassis(ctx context.Context, clli string, oltType string, driver string, address net.TCPAddr, hostname string, recorder *physical.Recorder) (string, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return "", err
 	}
+	defer unlock()
 	physicalChassis := &chassisHolder.PhysicalChassis
+	if physicalChassis.FindOLT(hostname) >= 0 {
+		return "", &physical.OLTExistsError{CLLI: clli, Hostname: hostname}
+	}
 	sOlt := physical.SimpleOLT{CLLI: clli, Hostname: hostname, Driver: driver, Address: address, Parent: physicalChassis}
 	switch oltType {
 	case "edgecore":
@@ -48,16 +47,110 @@ func CreateOLTChassis(clli string, oltType string, driver string, address net.TC
 	}
 	ports := sOlt.GetPorts()
 	for i := 0; i < len(ports); i++ {
-		absPort, err := chassisHolder.AbstractChassis.NextPort()
+		_, err = chassisHolder.AbstractChassis.AssignPort(&ports[i])
 		if err != nil {
 			fmt.Println(err)
 			return "", err
 		}
-		absPort.PhysPort = &ports[i]
 		//AssignTraits(&ports[i], absPort)
 	}
-	physicalChassis.AddOLTChassis(sOlt)
-	isDirty = true
+	err = physicalChassis.AddOLTChassis(ctx, sOlt)
+	markDirty(chassisHolder)
+	event := Event{Type: EventCreated, Kind: KindOlt, CLLI: clli, Hostname: hostname}
+	if len(ports) > 0 {
+		event.Slot = ports[0].AbstractSlot
+	}
+	err = publishChange(chassisHolder, event, err)
+	if err != nil {
+		return "", err
+	}
 	return clli, nil
 
 }
+
+/*
+RemoveOLTChassis - removes an OLT chassis/line card from the Physical chassis freeing its abstract ports for reuse,
+refuses while onts are active on it unless force is set. When XOS fails to remove it or any of its onts it is kept
+*/
+func RemoveOLTChassis(ctx context.Context, clli string, hostname string, force bool, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	physicalChassis := &chassisHolder.PhysicalChassis
+	index := physicalChassis.FindOLT(hostname)
+	if index < 0 {
+		return false, &physical.OLTNotFoundError{CLLI: clli, Hostname: hostname}
+	}
+	if !force {
+		active := 0
+		for _, port := range physicalChassis.Linecards[index].Ports {
+			for _, ont := range port.Onts {
+				if ont.Provisioned() {
+					active++
+				}
+			}
+		}
+		if active > 0 {
+			return false, &physical.ActiveOntsError{CLLI: clli, Hostname: hostname, Count: active}
+		}
+	}
+	olt, removed, err := physicalChassis.RemoveOLTChassis(ctx, index)
+	event := Event{Type: EventDeleted, Kind: KindOlt, CLLI: clli, Hostname: hostname}
+	if len(olt.Ports) > 0 {
+		event.Slot = olt.Ports[0].AbstractSlot
+	}
+	// published before the abstract ports are released while the onts still have their abstract slot and port
+	publishOntsDeleted(chassisHolder, removed)
+	if err != nil {
+		// the olt chassis is kept so removing it again retries what XOS did not remove
+		markDirty(chassisHolder)
+		if isDryRun(chassisHolder) {
+			return false, err
+		}
+		return false, publishFailure(event, err)
+	}
+	chassisHolder.AbstractChassis.ReleasePorts(olt.Ports)
+	markDirty(chassisHolder)
+	publishChange(chassisHolder, event, nil)
+	return true, nil
+}
+
+/*
+ReplaceOLTChassis swaps the OLT chassis/line card with hostname for new hardware keeping its abstract slot/port mapping
+and all provisioned onts
+*/
+func ReplaceOLTChassis(ctx context.Context, clli string, hostname string, driver string, address net.TCPAddr, newHostname string, recorder *physical.Recorder) (string, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	physicalChassis := &chassisHolder.PhysicalChassis
+	index := physicalChassis.FindOLT(hostname)
+	if index < 0 {
+		return "", &physical.OLTNotFoundError{CLLI: clli, Hostname: hostname}
+	}
+	if newHostname == "" {
+		newHostname = hostname
+	}
+	if newHostname != hostname && physicalChassis.FindOLT(newHostname) >= 0 {
+		return "", &physical.OLTExistsError{CLLI: clli, Hostname: newHostname}
+	}
+	if driver == "" {
+		driver = physicalChassis.Linecards[index].Driver
+	}
+	sOlt := physical.SimpleOLT{CLLI: clli, Hostname: newHostname, Driver: driver, Address: address, Parent: physicalChassis}
+	err = physicalChassis.ReplaceOLTChassis(ctx, index, &sOlt)
+	markDirty(chassisHolder)
+	event := Event{Type: EventReplaced, Kind: KindOlt, CLLI: clli, Hostname: newHostname, Message: "replaced " + hostname}
+	if len(sOlt.Ports) > 0 {
+		event.Slot = sOlt.Ports[0].AbstractSlot
+	}
+	err = publishChange(chassisHolder, event, err)
+	if err != nil {
+		return "", err
+	}
+	return newHostname, nil
+}
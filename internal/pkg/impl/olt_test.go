@@ -0,0 +1,95 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package impl_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+func TestOlt_RemoveOLTChassis(t *testing.T) {
+	clli := "remove_olt_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+	impl.ProvisionOnt(ctx, clli, 1, 2, 3, "REMOVE1", nil)
+
+	_, err := impl.RemoveOLTChassis(ctx, clli, clli+"_olt1", false, nil)
+	if _, ok := err.(*physical.ActiveOntsError); !ok {
+		t.Fatalf("Expected ActiveOntsError removing an olt with an active ont got %v\n", err)
+	}
+
+	id, events := impl.Subscribe(clli, nil)
+	defer impl.Unsubscribe(id)
+	success, err := impl.RemoveOLTChassis(ctx, clli, clli+"_olt1", true, nil)
+	if err != nil || !success {
+		t.Fatalf("Forced RemoveOLTChassis failed with %v\n", err)
+	}
+	checkEvents(t, events, impl.Event{Type: impl.EventDeleted, Kind: impl.KindOnt, CLLI: clli, Slot: 1, Port: 2, Ont: 3, SerialNumber: "REMOVE1"},
+		impl.Event{Type: impl.EventDeleted, Kind: impl.KindOlt, CLLI: clli, Slot: 1, Hostname: clli + "_olt1"})
+	if _, err = impl.FindOnt(physical.BySerialNumber, "REMOVE1"); !isOntNotFound(err) {
+		t.Fatal("Forced RemoveOLTChassis left the ont in the index")
+	}
+}
+
+func TestOlt_CreateOLTChassisExists(t *testing.T) {
+	clli := "duplicate_olt_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+	oltAddress := net.TCPAddr{IP: net.ParseIP("192.168.0.2"), Port: 9191}
+
+	// removing or replacing by hostname would act on the first olt so a second one with its hostname is refused
+	_, err := impl.CreateOLTChassis(ctx, clli, "edgecore", "openolt", oltAddress, clli+"_olt1", nil)
+	if _, ok := err.(*physical.OLTExistsError); !ok {
+		t.Fatalf("Expected OLTExistsError adding a second olt with the same hostname got %v\n", err)
+	}
+	_, err = impl.CreateOLTChassis(ctx, clli, "edgecore", "openolt", oltAddress, clli+"_olt2", nil)
+	if err != nil {
+		t.Fatalf("CreateOLTChassis failed with %v\n", err)
+	}
+}
+
+func TestOlt_FindOntWhileAddingOlts(t *testing.T) {
+	clli := "find_olt_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+	impl.ProvisionOnt(ctx, clli, 1, 1, 1, "FINDOLT1", nil)
+
+	// adding olts moves the linecards the index points into, lookups must not read them without the chassis lock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 2; i <= 4; i++ {
+			oltAddress := net.TCPAddr{IP: net.ParseIP(fmt.Sprintf("192.168.0.%d", i)), Port: 9191}
+			impl.CreateOLTChassis(ctx, clli, "edgecore", "openolt", oltAddress, fmt.Sprintf("%s_olt%d", clli, i), nil)
+		}
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		location, err := impl.FindOnt(physical.BySerialNumber, "FINDOLT1")
+		if err != nil || location.CLLI != clli || location.Hostname != clli+"_olt1" {
+			t.Fatalf("Expected to find the ont on %s_olt1 got %v %v\n", clli, location, err)
+		}
+	}
+}
@@ -17,94 +17,283 @@
 package impl
 
 import (
-	"errors"
 	"fmt"
+	"strings"
 
 	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/abstract"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
 )
 
 /*
 ProvisionOnt - provisions ont using sTag,cTag,NasPortID, and CircuitID generated internally
 */
-func ProvisionOnt(clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return false, errors.New(errString)
-	}
-	err := chassisHolder.AbstractChassis.ActivateONT(slotNumber, portNumber, ontNumber, serialNumber)
-	isDirty = true
+func ProvisionOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = provisionOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
 	return true, err
 }
 
 /*
 ActivateSerial - provisions ont using sTag,cTag,NasPortID, and CircuitID generated internally
 */
-func ActivateSerial(clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return false, errors.New(errString)
-	}
-	err := chassisHolder.AbstractChassis.ActivateSerial(slotNumber, portNumber, ontNumber, serialNumber)
-	isDirty = true
+func ActivateSerial(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = activateSerial(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
 	return true, err
 }
 
 /*
 PreProvisionOnt - provisions ont using sTag,cTag,NasPortID, and CircuitID passed in
 */
-func PreProvisionOnt(clli string, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return false, errors.New(errString)
+func PreProvisionOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
 	}
-	err := chassisHolder.AbstractChassis.PreProvisonONT(slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
-	isDirty = true
+	defer unlock()
+	err = preProvisionOnt(chassisHolder, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
 	return true, err
 }
 
 /*
 ProvisionOntFull - provisions ont using sTag,cTag,NasPortID, and CircuitID passed in
 */
-func ProvisionOntFull(clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return false, errors.New(errString)
-	}
-	err := chassisHolder.AbstractChassis.ActivateONTFull(slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
-	isDirty = true
+func ProvisionOntFull(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = provisionOntFull(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
 	return true, err
 }
 
+/*
+ModifyOnt - changes the vlans, NasPortID, CircuitID or profiles of an active ont, empty values are left unchanged,
+returns the names of the fields that changed
+*/
+func ModifyOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string, recorder *physical.Recorder) ([]string, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	changed, err := modifyOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
+	return changed, err
+}
+
+/*
+PutOnt - makes the ont at slot/port/ont look like what is passed in. An ont that is not provisioned yet is
+pre-provisioned with the vlans, ids and profiles given and activated with serialNumber, or is given the generated ones
+when only a serial number is passed. A provisioned ont has its serial number replaced and the rest modified, with
+empty values left unchanged. Returns whether the ont was created and the fields of an existing ont that changed
+*/
+func PutOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string, recorder *physical.Recorder) (bool, []string, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, nil, err
+	}
+	defer unlock()
+	created, changed, err := putOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
+	return created, changed, err
+}
+
+/*
+SuspendOnt - cuts service to an active ont keeping everything provisioned on it
+*/
+func SuspendOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = suspendOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
+	return err == nil, err
+}
+
+/*
+ResumeOnt - restores service to a suspended ont
+*/
+func ResumeOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = resumeOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
+	return err == nil, err
+}
+
+/*
+ReplaceOntSerial - gives an active ont the serial number of the hardware it was swapped for, returns the old serial number
+*/
+func ReplaceOntSerial(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, recorder *physical.Recorder) (string, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	previous, err := replaceOntSerial(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
+	return previous, err
+}
+
+/*
+MoveOnt - moves an active ont to another slot/port/ont which may be on the chassis toCLLI, with keepIdentity it keeps
+its vlans, NasPortID and CircuitID otherwise they are recomputed for its new position, returns the ont as moved
+*/
+func MoveOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, toCLLI string, toSlot int, toPort int, toOnt int, keepIdentity bool, recorder *physical.Recorder) (physical.Ont, error) {
+	from, to, unlock, err := lockChassisPair(ctx, clli, toCLLI, recorder)
+	if err != nil {
+		return physical.Ont{}, err
+	}
+	defer unlock()
+	ont, err := moveOnt(ctx, from, clli, slotNumber, portNumber, ontNumber, to, toCLLI, toSlot, toPort, toOnt, keepIdentity)
+	markOntDirty(from, slotNumber, portNumber, ontNumber)
+	markOntDirty(to, toSlot, toPort, toOnt)
+	return ont, err
+}
+
 /*
 DeleteOnt - deletes a previously provision ont
 */
-func DeleteOnt(clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	err := chassisHolder.AbstractChassis.DeleteONT(slotNumber, portNumber, ontNumber, serialNumber)
-	isDirty = true
+func DeleteOnt(ctx context.Context, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	err = deleteOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	markOntDirty(chassisHolder, slotNumber, portNumber, ontNumber)
 	return true, err
 }
+
+// the functions below do the work of the exported ones above without taking the chassis lock
+// so several operations can be applied while it is held once
+
+func provisionOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassisHolder.AbstractChassis.ActivateONT(ctx, slotNumber, portNumber, ontNumber, serialNumber)
+	event := Event{Type: EventActivated, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, SerialNumber: serialNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func activateSerial(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassisHolder.AbstractChassis.ActivateSerial(ctx, slotNumber, portNumber, ontNumber, serialNumber)
+	event := Event{Type: EventActivated, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, SerialNumber: serialNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func preProvisionOnt(chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) error {
+	err := chassisHolder.AbstractChassis.PreProvisonONT(slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	event := Event{Type: EventPreProvisioned, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func provisionOntFull(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) error {
+	err := chassisHolder.AbstractChassis.ActivateONTFull(ctx, slotNumber, portNumber, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
+	event := Event{Type: EventActivated, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, SerialNumber: serialNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func deleteOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassisHolder.AbstractChassis.DeleteONT(ctx, slotNumber, portNumber, ontNumber, serialNumber)
+	event := Event{Type: EventDeleted, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, SerialNumber: serialNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func putOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) (bool, []string, error) {
+	port, err := chassisHolder.AbstractChassis.PhysicalPort(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return false, nil, err
+	}
+	ont := port.Onts[ontNumber-1]
+	if ont.Provisioned() {
+		changed := []string{}
+		if serialNumber != "" && serialNumber != ont.SerialNumber {
+			_, err = replaceOntSerial(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+			if err != nil {
+				return false, nil, err
+			}
+			changed = append(changed, "SerialNumber")
+		}
+		modified, err := modifyOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+		return false, append(changed, modified...), err
+	}
+	preProvision := sTag != 0 || cTag != 0 || nasPortID != "" || circuitID != "" || techProfile != "" || speedProfile != ""
+	switch {
+	case preProvision || serialNumber == "":
+		err = preProvisionOnt(chassisHolder, clli, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+		if err == nil && serialNumber != "" {
+			err = activateSerial(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+		}
+	case ont.State == physical.OntPreProvisioned:
+		err = activateSerial(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	default:
+		err = provisionOnt(ctx, chassisHolder, clli, slotNumber, portNumber, ontNumber, serialNumber)
+	}
+	return err == nil, nil, err
+}
+
+func suspendOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int) error {
+	err := chassisHolder.AbstractChassis.SuspendONT(ctx, slotNumber, portNumber, ontNumber)
+	event := Event{Type: EventSuspended, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func resumeOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int) error {
+	err := chassisHolder.AbstractChassis.ResumeONT(ctx, slotNumber, portNumber, ontNumber)
+	event := Event{Type: EventResumed, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber}
+	return publishChange(chassisHolder, event, err)
+}
+
+func replaceOntSerial(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, serialNumber string) (string, error) {
+	previous, err := chassisHolder.AbstractChassis.ReplaceONTSerial(ctx, slotNumber, portNumber, ontNumber, serialNumber)
+	// nothing changed when the ont was rejected or already had the serial number
+	if previous == serialNumber {
+		return previous, err
+	}
+	event := Event{Type: EventReplaced, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, SerialNumber: serialNumber}
+	if previous != "" {
+		event.Message = "replaced serial " + previous
+	}
+	return previous, publishChange(chassisHolder, event, err)
+}
+
+func moveOnt(ctx context.Context, from *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, to *models.ChassisHolder, toCLLI string, toSlot int, toPort int, toOnt int, keepIdentity bool) (physical.Ont, error) {
+	ont, err := abstract.MoveONT(ctx, &from.AbstractChassis, slotNumber, portNumber, ontNumber, &to.AbstractChassis, toSlot, toPort, toOnt, keepIdentity)
+	event := Event{Type: EventMoved, Kind: KindOnt, CLLI: toCLLI, Slot: toSlot, Port: toPort, Ont: toOnt, SerialNumber: ont.SerialNumber,
+		Message: fmt.Sprintf("moved from %s %d/%d/%d", clli, slotNumber, portNumber, ontNumber)}
+	// a move XOS fails leaves the ont on its old port even when putting it back failed too
+	if _, ok := err.(*physical.XOSError); ok && !isDryRun(to) {
+		return ont, publishFailure(event, err)
+	}
+	return ont, publishChange(to, event, err)
+}
+
+func modifyOnt(ctx context.Context, chassisHolder *models.ChassisHolder, clli string, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) ([]string, error) {
+	changed, err := chassisHolder.AbstractChassis.ModifyONT(ctx, slotNumber, portNumber, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	// nothing changed when the ont was rejected or already had the values asked for
+	if len(changed) == 0 {
+		return changed, err
+	}
+	event := Event{Type: EventModified, Kind: KindOnt, CLLI: clli, Slot: slotNumber, Port: portNumber, Ont: ontNumber, Message: "changed " + strings.Join(changed, ",")}
+	return changed, publishChange(chassisHolder, event, err)
+}
@@ -0,0 +1,96 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package impl_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
+
+func TestOnt_PutOntCreates(t *testing.T) {
+	clli := "put_create_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+
+	// a serial number on its own activates the ont with the generated vlans and ids
+	created, changed, err := impl.PutOnt(ctx, clli, 1, 1, 1, "PUTCREATE1", 0, 0, "", "", "", "", nil)
+	if err != nil || !created || changed != nil {
+		t.Fatalf("Expected the ont to be created got %t %v %v\n", created, changed, err)
+	}
+	location, _ := impl.GetOnt(clli, 1, 1, 1)
+	if location.State != physical.OntActive.String() || location.SerialNumber != "PUTCREATE1" || location.STag == 0 {
+		t.Fatalf("Expected an active ont with generated vlans got %+v\n", location)
+	}
+
+	// the values passed in are pre-provisioned before the serial number is activated
+	created, changed, err = impl.PutOnt(ctx, clli, 1, 1, 2, "PUTCREATE2", 30, 40, "PUTNAS2", "PUTCIRCUIT2", "", "", nil)
+	if err != nil || !created || changed != nil {
+		t.Fatalf("Expected the ont to be created got %t %v %v\n", created, changed, err)
+	}
+	location, _ = impl.GetOnt(clli, 1, 1, 2)
+	if location.State != physical.OntActive.String() || location.CTag != 30 || location.STag != 40 || location.NasPortID != "PUTNAS2" ||
+		location.CircuitID != "PUTCIRCUIT2" {
+		t.Fatalf("Expected an active ont with the values passed in got %+v\n", location)
+	}
+
+	// without a serial number it is only pre-provisioned, a later put with one activates it
+	created, _, err = impl.PutOnt(ctx, clli, 1, 1, 3, "", 50, 60, "PUTNAS3", "PUTCIRCUIT3", "", "", nil)
+	if err != nil || !created {
+		t.Fatalf("Expected the ont to be pre-provisioned got %t %v\n", created, err)
+	}
+	if location, _ = impl.GetOnt(clli, 1, 1, 3); location.State != physical.OntPreProvisioned.String() {
+		t.Fatalf("Expected a pre-provisioned ont got %+v\n", location)
+	}
+	created, changed, err = impl.PutOnt(ctx, clli, 1, 1, 3, "PUTCREATE3", 0, 0, "", "", "", "", nil)
+	if err != nil || !created || changed != nil {
+		t.Fatalf("Expected the pre-provisioned ont to be activated got %t %v %v\n", created, changed, err)
+	}
+	location, _ = impl.GetOnt(clli, 1, 1, 3)
+	if location.State != physical.OntActive.String() || location.SerialNumber != "PUTCREATE3" || location.NasPortID != "PUTNAS3" {
+		t.Fatalf("Expected the ont to be activated with what was pre-provisioned got %+v\n", location)
+	}
+}
+
+func TestOnt_PutOntChanges(t *testing.T) {
+	clli := "put_change_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	ctx := context.Background()
+	impl.PutOnt(ctx, clli, 1, 1, 1, "PUTCHANGE1", 30, 40, "PUTNAS1", "PUTCIRCUIT1", "", "", nil)
+
+	// putting what the ont already has changes nothing
+	created, changed, err := impl.PutOnt(ctx, clli, 1, 1, 1, "PUTCHANGE1", 30, 40, "PUTNAS1", "PUTCIRCUIT1", "", "", nil)
+	if err != nil || created || len(changed) != 0 {
+		t.Fatalf("Expected nothing to change got %t %v %v\n", created, changed, err)
+	}
+
+	created, changed, err = impl.PutOnt(ctx, clli, 1, 1, 1, "PUTCHANGE2", 0, 0, "", "PUTCIRCUIT2", "", "", nil)
+	if err != nil || created || !reflect.DeepEqual(changed, []string{"SerialNumber", "CircuitID"}) {
+		t.Fatalf("Expected the serial number and circuit id to change got %t %v %v\n", created, changed, err)
+	}
+	location, _ := impl.GetOnt(clli, 1, 1, 1)
+	if location.SerialNumber != "PUTCHANGE2" || location.CircuitID != "PUTCIRCUIT2" || location.NasPortID != "PUTNAS1" ||
+		location.CTag != 30 || location.STag != 40 {
+		t.Fatalf("Expected only the fields passed in to change got %+v\n", location)
+	}
+	if _, err = impl.FindOnt(physical.BySerialNumber, "PUTCHANGE1"); !isOntNotFound(err) {
+		t.Fatalf("Expected the replaced serial number to be forgotten got %v\n", err)
+	}
+}
@@ -16,89 +16,216 @@
 package impl
 
 import (
-	"fmt"
+	"bytes"
 	"log"
-	"os"
+	"strings"
+	"time"
 
 	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
 	"gerrit.opencord.org/abstract-olt/models"
-	"github.com/mongodb/mongo-go-driver/bson"
-	"github.com/mongodb/mongo-go-driver/mongo"
-	"github.com/mongodb/mongo-go-driver/mongo/options"
-	context "golang.org/x/net/context"
 )
 
-/*
-DoOutput - creates a backup and stores it to disk/mongodb
-*/
-func DoOutput() (bool, error) {
-	if isDirty {
-		myChan := getSyncChannel()
-		<-myChan
-		defer done(myChan, true)
-		chassisMap := models.GetChassisMap()
-		if settings.GetMongo() {
-			clientOptions := options.Client()
-			creds := options.Credential{AuthMechanism: "SCRAM-SHA-256", AuthSource: "AbstractOLT", Username: settings.GetMongoUser(), Password: settings.GetMongoPassword()}
-			clientOptions.SetAuth(creds)
+// the idempotency keys and async jobs are backed up next to the chassis under names no clli can have
+const idempotencyBackup = ".idempotency"
+const jobsBackup = ".jobs"
 
-			client, err := mongo.NewClientWithOptions(settings.GetMongodb(), clientOptions)
-			client.Connect(context.Background())
-			if err != nil {
-				log.Printf("client connect to mongo db @%s failed with %v\n", settings.GetMongodb(), err)
-			}
-			defer client.Disconnect(context.Background())
-			for clli, chassisHolder := range *chassisMap {
-				json, _ := (chassisHolder).Serialize()
-				collection := client.Database("AbstractOLT").Collection("backups")
-				//update or insert if not existent
-				upsert := true
-				res, err := collection.UpdateOne(context.Background(),
-					bson.D{
-						{"_id", clli},
-					},
-					bson.D{
-						{
-							"$set", bson.D{
-								{"body", json},
-							},
-						},
-					}, &options.UpdateOptions{Upsert: &upsert})
+// where DoOutput writes and the restore reads, set once at startup before any call is served
+var storage models.Storage = models.NewFileStorage("backup")
 
-				if err != nil {
-					log.Printf("collection.UpdateOne failed with %v\n", err)
-				} else {
-					id := res.UpsertedID
-					if settings.GetDebug() {
-						log.Printf("Update Succeeded with id %v\n", id)
-					}
-				}
-			}
-		} else {
-			for clli, chassisHolder := range *chassisMap {
+/*
+SetStorage - selects where backups are written and restored from
+*/
+func SetStorage(backupStorage models.Storage) {
+	storage = backupStorage
+}
 
-				json, _ := (chassisHolder).Serialize()
-				if settings.GetMongo() {
+/*
+DoOutput - creates a backup of every chassis that changed since the last one and saves it to the storage along with a
+snapshot for ListBackups, each chassis is only locked while it is serialized. A backup that could not be serialized
+or saved is tried again by the next DoOutput, the journal written before it started is only discarded once they are
+all saved
+*/
+func DoOutput() (bool, error) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	// rotated first so every change in the older segments is marked dirty by the time it is taken
+	segments := rotateJournal()
+	cllis, idempotency, jobs := takeDirty()
+	if len(cllis) == 0 && !idempotency && !jobs {
+		if settings.GetDebug() {
+			log.Print("Not dirty not dumping config")
+		}
+		discardJournal(segments)
+		return true, nil
+	}
+	var lastErr error
+	now := time.Now()
+	for _, clli := range cllis {
+		chassisHolder := models.RLockChassis(clli)
+		if chassisHolder == nil {
+			// deleted since it changed, DeleteChassis removes its backup
+			continue
+		}
+		json, err := chassisHolder.Serialize()
+		chassisHolder.RUnlock()
+		if err != nil {
+			log.Printf("Unable to serialize chassis %s %v\n", clli, err)
+			markChassisDirty(clli)
+			lastErr = err
+			continue
+		}
+		err = storage.Save(clli, json)
+		if err != nil {
+			log.Printf("Unable to back up chassis %s %v\n", clli, err)
+			markChassisDirty(clli)
+			lastErr = err
+			continue
+		}
+		err = saveSnapshot(clli, json, now)
+		if err != nil {
+			log.Printf("Unable to snapshot chassis %s %v\n", clli, err)
+		}
+	}
+	if idempotency {
+		json, err := serializeIdempotency()
+		if err == nil {
+			err = storage.Save(idempotencyBackup, json)
+		}
+		if err != nil {
+			log.Printf("Unable to back up idempotency keys %v\n", err)
+			markIdempotencyDirty()
+			lastErr = err
+		}
+	}
+	if jobs {
+		json, err := serializeJobs()
+		if err == nil {
+			err = storage.Save(jobsBackup, json)
+		}
+		if err != nil {
+			log.Printf("Unable to back up jobs %v\n", err)
+			markJobsDirty()
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return false, lastErr
+	}
+	discardJournal(segments)
+	return true, nil
+}
 
-				} else {
-					//TODO parameterize dump location
-					backupFile := fmt.Sprintf("backup/%s", clli)
-					f, _ := os.Create(backupFile)
+/*
+FlushOutput - backs up every chassis, the idempotency keys and the jobs whether or not they changed
+*/
+func FlushOutput() (bool, error) {
+	dirtyLock.Lock()
+	for _, clli := range models.ChassisCLLIs() {
+		dirtyChassis[clli] = true
+	}
+	idempotencyDirty = true
+	jobsDirty = true
+	dirtyLock.Unlock()
+	return DoOutput()
+}
 
-					defer f.Close()
+/*
+deleteBackup - removes the persisted backup of a chassis from the storage, it is journaled first so a crash before
+the delete does not bring the chassis back
+*/
+func deleteBackup(clli string) error {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	appendJournal(journalEntry{Name: clli, Deleted: true})
+	err := storage.Delete(clli)
+	if err != nil {
+		log.Printf("Unable to remove backup %s %v\n", clli, err)
+	}
+	return err
+}
 
-					_, _ = f.WriteString(string(json))
-					f.Sync()
-				}
+/*
+RestoreChassis - loads every chassis backed up in the storage, a backup written in an older format is migrated and
+saved back once it has been restored and serializes to the same backup again. A backup that can not be read is logged
+and skipped, one whose migration does not survive that check is skipped and left as it was
+*/
+func RestoreChassis() error {
+	names, err := storage.List()
+	if err != nil {
+		return err
+	}
+	for _, clli := range names {
+		if strings.HasPrefix(clli, ".") {
+			continue
+		}
+		json, err := storage.Load(clli)
+		if err != nil {
+			log.Printf("Unable to read backup of %s %v\n", clli, err)
+			continue
+		}
+		json, upgraded, err := models.MigrateBackup(json)
+		if err != nil {
+			log.Printf("Unable to migrate backup of %s %v\n", clli, err)
+			continue
+		}
+		chassisHolder := models.ChassisHolder{}
+		err = chassisHolder.Deserialize(json)
+		if err != nil {
+			log.Printf("Deserialize threw an error for clli %s %v\n", clli, err)
+			continue
+		}
+		if upgraded {
+			restored, err := chassisHolder.Serialize()
+			if err != nil || !bytes.Equal(restored, json) {
+				log.Printf("Migrated backup of %s does not restore unchanged, keeping the original %v\n", clli, err)
+				continue
+			}
+			err = storage.Save(clli, json)
+			if err != nil {
+				log.Printf("Unable to save the migrated backup of %s %v\n", clli, err)
 			}
 		}
-		isDirty = false
-	} else {
-		if settings.GetDebug() {
-			log.Print("Not dirty not dumping config")
+		// indexed before it is added so requests arriving during the restore find its onts
+		chassisHolder.PhysicalChassis.IndexOnts()
+		err = models.AddChassis(clli, &chassisHolder)
+		if err != nil {
+			chassisHolder.PhysicalChassis.UnindexOnts()
+			log.Printf("Unable to restore %s %v\n", clli, err)
 		}
+	}
+	return nil
+}
 
+/*
+RestoreIdempotency - reloads the idempotency keys saved by DoOutput from the storage
+*/
+func RestoreIdempotency() error {
+	json, err := readBackup(idempotencyBackup)
+	if json == nil || err != nil {
+		return err
 	}
-	return true, nil
+	return deserializeIdempotency(json)
+}
 
+/*
+RestoreJobs - reloads the async jobs saved by DoOutput from the storage, must be called before StartJobs so
+unfinished jobs are picked up
+*/
+func RestoreJobs() error {
+	json, err := readBackup(jobsBackup)
+	if json == nil || err != nil {
+		return err
+	}
+	return deserializeJobs(json)
+}
+
+/*
+readBackup - reads the backup name written outside of the chassis backups, returns nil when there is none
+*/
+func readBackup(name string) ([]byte, error) {
+	json, err := storage.Load(name)
+	if _, ok := err.(*models.BackupNotFoundError); ok {
+		return nil, nil
+	}
+	return json, err
 }
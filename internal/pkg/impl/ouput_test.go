@@ -0,0 +1,69 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package impl_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/impl"
+	"gerrit.opencord.org/abstract-olt/models"
+	context "golang.org/x/net/context"
+)
+
+func TestOuput_FlushOutput(t *testing.T) {
+	clli := "flush_clli"
+	defer setupChassis(t, clli, unreachableXOS(t))()
+	impl.ProvisionOnt(context.Background(), clli, 1, 1, 1, "FLUSH1", nil)
+	_, err := impl.DoOutput()
+	if err != nil {
+		t.Fatalf("DoOutput failed with %v\n", err)
+	}
+
+	// nothing is dirty any more so only a flush backs it up again
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	storage := models.NewFileStorage(dir)
+	impl.SetStorage(storage)
+	impl.DoOutput()
+	if _, err := storage.Load(clli); err == nil {
+		t.Fatal("Expected DoOutput to only back up what changed")
+	}
+	ok, err := impl.FlushOutput()
+	if !ok || err != nil {
+		t.Fatalf("FlushOutput failed with %t %v\n", ok, err)
+	}
+	for _, name := range []string{clli, ".idempotency", ".jobs"} {
+		if _, err := storage.Load(name); err != nil {
+			t.Fatalf("Expected FlushOutput to back up %s got %v\n", name, err)
+		}
+	}
+	data, _ := storage.Load(clli)
+	chassisHolder := models.ChassisHolder{}
+	err = chassisHolder.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed with %v\n", err)
+	}
+	port, _ := chassisHolder.AbstractChassis.PhysicalPort(1, 1, 1)
+	if port == nil || port.Onts[0].SerialNumber != "FLUSH1" {
+		t.Fatal("Expected the flushed backup to hold the ont provisioned before it")
+	}
+}
@@ -15,36 +15,55 @@
 */
 package impl
 
-import "gerrit.opencord.org/abstract-olt/models"
+import (
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
 
 /*
 Reflow - takes internal config and resends to xos
 */
-func Reflow() (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	for _, chassisHolder := range *chassisMap {
-		physical := chassisHolder.PhysicalChassis
-		for index := range physical.Linecards {
-			olt := physical.Linecards[index]
-			physical.SendOltTosca(olt)
-			for portIndex := range olt.Ports {
-				port := olt.Ports[portIndex]
-				for ontIndex := range port.Onts {
-					ont := port.Onts[ontIndex]
-					if ont.Active {
-						physical.SendOntTosca(ont)
-						physical.SendSubscriberTosca(ont)
+func Reflow(ctx context.Context) (bool, error) {
+	for _, clli := range models.ChassisCLLIs() {
+		chassisHolder, unlock, err := lockChassis(ctx, clli, nil)
+		if _, ok := err.(*models.ChassisNotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		reflowChassis(ctx, chassisHolder)
+		unlock()
+	}
+	return true, nil
+	//TODO lots of this could throw errors
+}
 
+func reflowChassis(ctx context.Context, chassisHolder *models.ChassisHolder) {
+	physicalChassis := chassisHolder.PhysicalChassis
+	for index := range physicalChassis.Linecards {
+		olt := physicalChassis.Linecards[index]
+		physicalChassis.SendOltTosca(ctx, olt)
+		for portIndex := range olt.Ports {
+			port := &olt.Ports[portIndex]
+			for ontIndex := range port.Onts {
+				ont := port.Onts[ontIndex]
+				if ont.Provisioned() {
+					var ontErr error
+					if ont.State != physical.OntSuspended {
+						ontErr = physicalChassis.SendOntTosca(ctx, ont)
+					}
+					subscriberErr := physicalChassis.SendSubscriberTosca(ctx, ont)
+					// an ont whose activation XOS rejected is active once it has been pushed
+					if ont.State == physical.OntFailed && ontErr == nil && subscriberErr == nil {
+						port.MarkActive(ontIndex + 1)
+						markOntDirty(chassisHolder, port.AbstractSlot, port.AbstractPort, ontIndex+1)
 					}
-
 				}
 
 			}
+
 		}
 	}
-	return true, nil
-	//TODO lots of this could throw errors
 }
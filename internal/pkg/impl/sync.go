@@ -15,21 +15,151 @@
 */
 package impl
 
-import "sync"
+import (
+	"sort"
+	"sync"
 
-var syncChan chan bool
-var isDirty bool
+	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
+)
 
-var runOnce sync.Once
+// changes to a chassis are serialized by its own lock so a slow XOS only holds up the chassis that pushes to it,
+// what needs backing up is tracked per chassis so DoOutput only locks the chassis that changed
+var dirtyLock sync.Mutex
+var dirtyChassis = make(map[string]bool)
+var idempotencyDirty bool
+var jobsDirty bool
 
-func getSyncChannel() chan bool {
-	runOnce.Do(func() {
-		syncChan = make(chan bool, 1)
-		syncChan <- true
-	})
+// held while backups are written so an older snapshot never overwrites a newer one or a deleted chassis's backup
+var outputLock sync.Mutex
 
-	return syncChan
+/*
+lockChassis - looks up the chassis for clli and locks it for writing, when recorder is set the chassis is only locked
+for reading and a copy to dry run against is returned. Calls to XOS made while it is held give up with ctx, and
+nothing is done if ctx ended while waiting for the lock. The returned func releases the lock
+*/
+func lockChassis(ctx context.Context, clli string, recorder *physical.Recorder) (*models.ChassisHolder, func(), error) {
+	if recorder != nil {
+		chassisHolder := models.RLockChassis(clli)
+		if chassisHolder == nil {
+			return nil, nil, &models.ChassisNotFoundError{CLLI: clli}
+		}
+		if err := ctx.Err(); err != nil {
+			chassisHolder.RUnlock()
+			return nil, nil, err
+		}
+		clone, err := dryRunChassisHolder(chassisHolder, recorder)
+		if err != nil {
+			chassisHolder.RUnlock()
+			return nil, nil, err
+		}
+		return clone, chassisHolder.RUnlock, nil
+	}
+	chassisHolder := models.LockChassis(clli)
+	if chassisHolder == nil {
+		return nil, nil, &models.ChassisNotFoundError{CLLI: clli}
+	}
+	if err := ctx.Err(); err != nil {
+		chassisHolder.Unlock()
+		return nil, nil, err
+	}
+	unlock := func() {
+		// journaled before the lock is released so the change is on disk before the call returns
+		journalChanges(chassisHolder)
+		chassisHolder.Unlock()
+	}
+	return chassisHolder, unlock, nil
+}
+
+/*
+lockChassisPair - locks the chassis for both cllis in clli order so two calls locking the same pair cannot deadlock,
+when they are the same chassis it is locked once and returned twice
+*/
+func lockChassisPair(ctx context.Context, clli string, otherCLLI string, recorder *physical.Recorder) (*models.ChassisHolder, *models.ChassisHolder, func(), error) {
+	if clli == otherCLLI {
+		chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+		return chassisHolder, chassisHolder, unlock, err
+	}
+	cllis := []string{clli, otherCLLI}
+	sort.Strings(cllis)
+	first, unlockFirst, err := lockChassis(ctx, cllis[0], recorder)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	second, unlockSecond, err := lockChassis(ctx, cllis[1], recorder)
+	if err != nil {
+		unlockFirst()
+		return nil, nil, nil, err
+	}
+	unlock := func() {
+		unlockSecond()
+		unlockFirst()
+	}
+	if cllis[0] == clli {
+		return first, second, unlock, nil
+	}
+	return second, first, unlock, nil
 }
-func done(myChan chan bool, done bool) {
-	myChan <- done
+
+/*
+markDirty - flags chassisHolder as needing a backup and journaling whole unless it is a dry run copy
+*/
+func markDirty(chassisHolder *models.ChassisHolder) {
+	if isDryRun(chassisHolder) {
+		return
+	}
+	clli := chassisHolder.PhysicalChassis.CLLI
+	markChassisDirty(clli)
+	markUnjournaled(clli)
+}
+
+/*
+markOntDirty - flags chassisHolder as needing a backup when only the ont at slotNumber/portNumber/ontNumber may have
+changed, just that ont is journaled
+*/
+func markOntDirty(chassisHolder *models.ChassisHolder, slotNumber int, portNumber int, ontNumber int) {
+	if isDryRun(chassisHolder) {
+		return
+	}
+	clli := chassisHolder.PhysicalChassis.CLLI
+	markChassisDirty(clli)
+	markOntUnjournaled(clli, ontPosition{slot: slotNumber, port: portNumber, ont: ontNumber})
+}
+
+func markChassisDirty(clli string) {
+	dirtyLock.Lock()
+	defer dirtyLock.Unlock()
+	dirtyChassis[clli] = true
+}
+
+func markIdempotencyDirty() {
+	dirtyLock.Lock()
+	defer dirtyLock.Unlock()
+	idempotencyDirty = true
+}
+
+func markJobsDirty() {
+	dirtyLock.Lock()
+	defer dirtyLock.Unlock()
+	jobsDirty = true
+}
+
+/*
+takeDirty - returns what needs backing up and clears it
+*/
+func takeDirty() ([]string, bool, bool) {
+	dirtyLock.Lock()
+	defer dirtyLock.Unlock()
+	cllis := make([]string, 0, len(dirtyChassis))
+	for clli := range dirtyChassis {
+		cllis = append(cllis, clli)
+	}
+	sort.Strings(cllis)
+	dirtyChassis = make(map[string]bool)
+	idempotency := idempotencyDirty
+	idempotencyDirty = false
+	jobs := jobsDirty
+	jobsDirty = false
+	return cllis, idempotency, jobs
 }
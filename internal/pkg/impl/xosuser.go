@@ -25,42 +25,50 @@ import (
 	"strings"
 
 	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
-	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+	context "golang.org/x/net/context"
 )
 
 /*
 ChangeXOSUserPassword - allows update of xos credentials
 */
-func ChangeXOSUserPassword(clli string, xosUser string, xosPassword string) (bool, error) {
-	myChan := getSyncChannel()
-	<-myChan
-	defer done(myChan, true)
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
-	if chassisHolder == nil {
-		errString := fmt.Sprintf("There is no chassis with CLLI of %s", clli)
-		return false, errors.New(errString)
+func ChangeXOSUserPassword(ctx context.Context, clli string, xosUser string, xosPassword string, recorder *physical.Recorder) (bool, error) {
+	chassisHolder, unlock, err := lockChassis(ctx, clli, recorder)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if recorder != nil {
+		// nothing is sent to XOS when credentials change so there is nothing to record
+		return true, nil
 	}
 	xosIP := chassisHolder.PhysicalChassis.XOSAddress.IP
 	xosPort := chassisHolder.PhysicalChassis.XOSAddress.Port
-	loginWorked := testLogin(xosUser, xosPassword, xosIP, xosPort)
+	loginWorked, err := testLogin(ctx, xosUser, xosPassword, xosIP, xosPort)
+	if err != nil {
+		return false, err
+	}
 	if !loginWorked {
 		return false, errors.New("Unable to validate login when changing password")
 	}
 
 	chassisHolder.PhysicalChassis.XOSUser = xosUser
 	chassisHolder.PhysicalChassis.XOSPassword = xosPassword
-	isDirty = true
+	markDirty(chassisHolder)
 	return true, nil
 
 }
 
-func testLogin(xosUser string, xosPassword string, xosIP net.IP, xosPort int) bool {
+/*
+testLogin - checks the XOS credentials with TOSCA, err is only set when XOS did not answer before ctx or the southbound
+timeout ended
+*/
+func testLogin(ctx context.Context, xosUser string, xosPassword string, xosIP net.IP, xosPort int) (bool, error) {
 	if settings.GetDummy() {
-		return true
+		return true, nil
 	}
 	if settings.GetGrpc() {
-		return true
+		return true, nil
 	}
 	var dummyYaml = `
 tosca_definitions_version: tosca_simple_yaml_1_0
@@ -75,16 +83,19 @@ topology_template:
         must-exist: true
         name: mysite
 `
+	xosCtx, cancel := context.WithTimeout(ctx, settings.GetSouthboundTimeout())
+	defer cancel()
 	client := &http.Client{}
 	requestList := fmt.Sprintf("http://%s:%d/run", xosIP, xosPort)
 	req, err := http.NewRequest("POST", requestList, strings.NewReader(dummyYaml))
+	req = req.WithContext(xosCtx)
 	req.Header.Add("xos-username", xosUser)
 	req.Header.Add("xos-password", xosPassword)
 	resp, err := client.Do(req)
 	log.Printf("testLogin resp:%v", resp)
 	if err != nil {
 		log.Printf("Unable to validate XOS Login Information %v", err)
-		return false
+		return false, xosCtx.Err()
 	}
 	defer resp.Body.Close()
 
@@ -92,8 +103,8 @@ topology_template:
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 		bodyString := string(bodyBytes)
 		fmt.Println(bodyString)
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 
 }
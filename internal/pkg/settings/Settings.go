@@ -16,6 +16,8 @@
 
 package settings
 
+import "time"
+
 var debug = false
 var dummy = false
 var mongo = false
@@ -23,6 +25,13 @@ var grpc = true
 var mongodb = ""
 var mongoUser = ""
 var mongoPasswd = ""
+var idempotencyWindow = 24 * time.Hour
+var southboundTimeout = 30 * time.Second
+var jobAttempts = 5
+var jobRetryDelay = 5 * time.Second
+var jobRetention = 24 * time.Hour
+var backupSnapshots = 10
+var backupSnapshotAge time.Duration
 
 /*
 SetDebug - sets debug setting
@@ -120,3 +129,101 @@ GetGrpc - returns the value of grpc
 func GetGrpc() bool {
 	return grpc
 }
+
+/*
+SetIdempotencyWindow - sets how long the result of a call made with an idempotency key is kept for replay
+*/
+func SetIdempotencyWindow(window time.Duration) {
+	idempotencyWindow = window
+}
+
+/*
+GetIdempotencyWindow - returns how long the result of a call made with an idempotency key is kept for replay
+*/
+func GetIdempotencyWindow() time.Duration {
+	return idempotencyWindow
+}
+
+/*
+SetSouthboundTimeout - sets how long a single call to XOS may take before it is given up on
+*/
+func SetSouthboundTimeout(timeout time.Duration) {
+	southboundTimeout = timeout
+}
+
+/*
+GetSouthboundTimeout - returns how long a single call to XOS may take before it is given up on
+*/
+func GetSouthboundTimeout() time.Duration {
+	return southboundTimeout
+}
+
+/*
+SetJobAttempts - sets how many times an async job is tried before it is marked failed
+*/
+func SetJobAttempts(attempts int) {
+	jobAttempts = attempts
+}
+
+/*
+GetJobAttempts - returns how many times an async job is tried before it is marked failed
+*/
+func GetJobAttempts() int {
+	return jobAttempts
+}
+
+/*
+SetJobRetryDelay - sets how long an async job waits before its first retry, the wait doubles with each retry
+*/
+func SetJobRetryDelay(delay time.Duration) {
+	jobRetryDelay = delay
+}
+
+/*
+GetJobRetryDelay - returns how long an async job waits before its first retry
+*/
+func GetJobRetryDelay() time.Duration {
+	return jobRetryDelay
+}
+
+/*
+SetJobRetention - sets how long a finished async job can still be looked up
+*/
+func SetJobRetention(retention time.Duration) {
+	jobRetention = retention
+}
+
+/*
+GetJobRetention - returns how long a finished async job can still be looked up
+*/
+func GetJobRetention() time.Duration {
+	return jobRetention
+}
+
+/*
+SetBackupSnapshots - sets how many snapshots of each chassis are kept, 0 keeps none
+*/
+func SetBackupSnapshots(count int) {
+	backupSnapshots = count
+}
+
+/*
+GetBackupSnapshots - returns how many snapshots of each chassis are kept
+*/
+func GetBackupSnapshots() int {
+	return backupSnapshots
+}
+
+/*
+SetBackupSnapshotAge - sets how old a snapshot can get before it is removed, 0 keeps them however old they are
+*/
+func SetBackupSnapshotAge(age time.Duration) {
+	backupSnapshotAge = age
+}
+
+/*
+GetBackupSnapshotAge - returns how old a snapshot can get before it is removed
+*/
+func GetBackupSnapshotAge() time.Duration {
+	return backupSnapshotAge
+}
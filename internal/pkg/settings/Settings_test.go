@@ -18,6 +18,7 @@ package settings_test
 
 import (
 	"testing"
+	"time"
 
 	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
 )
@@ -34,3 +35,29 @@ func TestSettings_SetDummy(t *testing.T) {
 		t.Fatalf("Failed to set dummy level")
 	}
 }
+func TestSettings_SetIdempotencyWindow(t *testing.T) {
+	settings.SetIdempotencyWindow(time.Hour)
+	if settings.GetIdempotencyWindow() != time.Hour {
+		t.Fatalf("Failed to set idempotency window")
+	}
+}
+func TestSettings_SetSouthboundTimeout(t *testing.T) {
+	settings.SetSouthboundTimeout(5 * time.Second)
+	if settings.GetSouthboundTimeout() != 5*time.Second {
+		t.Fatalf("Failed to set southbound timeout")
+	}
+}
+func TestSettings_SetJobRetryDelay(t *testing.T) {
+	settings.SetJobAttempts(3)
+	settings.SetJobRetryDelay(time.Second)
+	if settings.GetJobAttempts() != 3 || settings.GetJobRetryDelay() != time.Second {
+		t.Fatalf("Failed to set job retries")
+	}
+}
+func TestSettings_SetBackupSnapshots(t *testing.T) {
+	settings.SetBackupSnapshots(5)
+	settings.SetBackupSnapshotAge(time.Hour)
+	if settings.GetBackupSnapshots() != 5 || settings.GetBackupSnapshotAge() != time.Hour {
+		t.Fatalf("Failed to set backup snapshot retention")
+	}
+}
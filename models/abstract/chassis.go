@@ -17,8 +17,11 @@
 package abstract
 
 import (
+	"context"
 	"errors"
 	"fmt"
+
+	"gerrit.opencord.org/abstract-olt/models/physical"
 )
 
 const MAX_SLOTS int = 16
@@ -42,15 +45,43 @@ type PortAllocationInfo struct {
 	outOfPorts bool
 }
 
+/*
+NextPort pulls the first unMapped port in the abstract chassis so the next physical port can be mapped to it,
+ports freed up by a removed OLT are handed out again before the allocation cursor moves forward
+*/
 func (chassis *Chassis) NextPort() (*Port, error) {
+	slotIndex, portIndex, err := chassis.nextFree()
+	if err != nil {
+		return nil, err
+	}
+	return &chassis.Slots[slotIndex].Ports[portIndex], nil
+}
+
+func (chassis *Chassis) nextFree() (int, int, error) {
 	info := &chassis.AllocInfo
 
+	allocated := info.slot*MAX_PORTS + info.port
 	if info.outOfPorts {
-		return nil, errors.New("Abstract chassis out of ports")
+		allocated = MAX_SLOTS * MAX_PORTS
+	}
+	for i := 0; i < allocated; i++ {
+		if chassis.Slots[i/MAX_PORTS].Ports[i%MAX_PORTS].PhysPort == nil {
+			return i / MAX_PORTS, i % MAX_PORTS, nil
+		}
 	}
 
-	nextPort := &chassis.Slots[info.slot].Ports[info.port]
+	for !info.outOfPorts {
+		slotIndex, portIndex := info.slot, info.port
+		chassis.advance()
+		if chassis.Slots[slotIndex].Ports[portIndex].PhysPort == nil {
+			return slotIndex, portIndex, nil
+		}
+	}
+	return 0, 0, errors.New("Abstract chassis out of ports")
+}
 
+func (chassis *Chassis) advance() {
+	info := &chassis.AllocInfo
 	info.port++
 	if info.port == MAX_PORTS {
 		info.port = 0
@@ -60,91 +91,213 @@ func (chassis *Chassis) NextPort() (*Port, error) {
 			info.outOfPorts = true
 		}
 	}
+}
 
-	return nextPort, nil
+/*
+AssignPort - maps a physical PON port to the next free abstract port and records the mapping on the physical port
+*/
+func (chassis *Chassis) AssignPort(physPort *physical.PONPort) (*Port, error) {
+	slotIndex, portIndex, err := chassis.nextFree()
+	if err != nil {
+		return nil, err
+	}
+	port := &chassis.Slots[slotIndex].Ports[portIndex]
+	port.PhysPort = physPort
+	physPort.AbstractSlot = slotIndex + 1
+	physPort.AbstractPort = portIndex + 1
+	return port, nil
 }
-func (chassis *Chassis) PreProvisonONT(slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) error {
-	if slotNumber > len(chassis.Slots) {
-		errorMsg := fmt.Sprintf("Invalid slot Number %d ", slotNumber)
-		return errors.New(errorMsg)
+
+/*
+RestorePort - maps a physical PON port back to the abstract port recorded on it
+*/
+func (chassis *Chassis) RestorePort(physPort *physical.PONPort) (*Port, error) {
+	slotIndex := physPort.AbstractSlot - 1
+	portIndex := physPort.AbstractPort - 1
+	if slotIndex < 0 || slotIndex >= MAX_SLOTS || portIndex < 0 || portIndex >= MAX_PORTS {
+		errorMsg := fmt.Sprintf("Invalid abstract mapping slot %d port %d", physPort.AbstractSlot, physPort.AbstractPort)
+		return nil, errors.New(errorMsg)
 	}
-	if portNumber > 16 {
-		errorMsg := fmt.Sprintf("Invalid port Number %d ", portNumber)
-		return errors.New(errorMsg)
+	port := &chassis.Slots[slotIndex].Ports[portIndex]
+	if port.PhysPort != nil {
+		errorMsg := fmt.Sprintf("Abstract port %d on slot %d is already mapped", physPort.AbstractPort, physPort.AbstractSlot)
+		return nil, errors.New(errorMsg)
 	}
-	if ontNumber > 64 {
-		errorMsg := fmt.Sprintf("Invalid ont Number %d ", ontNumber)
-		return errors.New(errorMsg)
+	port.PhysPort = physPort
+	// keep the cursor ahead of everything that has been handed out
+	info := &chassis.AllocInfo
+	for !info.outOfPorts && info.slot*MAX_PORTS+info.port <= slotIndex*MAX_PORTS+portIndex {
+		chassis.advance()
 	}
+	return port, nil
+}
 
-	err := chassis.Slots[slotNumber-1].Ports[portNumber-1].preProvisionOnt(ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
-	return err
+/*
+ReleasePorts - unmaps every abstract port pointing at one of the given physical ports so they can be reused
+*/
+func (chassis *Chassis) ReleasePorts(ports []physical.PONPort) int {
+	released := 0
+	for i := range chassis.Slots {
+		slot := &chassis.Slots[i]
+		for j := range slot.Ports {
+			port := &slot.Ports[j]
+			for k := range ports {
+				if port.PhysPort == &ports[k] {
+					port.PhysPort = nil
+					ports[k].AbstractSlot = 0
+					ports[k].AbstractPort = 0
+					released++
+				}
+			}
+		}
+	}
+	return released
+}
+
+/*
+OutOfRangeError - returned when a slot, port or ont number is outside of the abstract chassis
+*/
+type OutOfRangeError struct {
+	Field string
+	Value int
+	Max   int
+}
+
+func (e *OutOfRangeError) Error() string {
+	return fmt.Sprintf("Invalid %s Number %d must be between 1 and %d", e.Field, e.Value, e.Max)
 }
-func (chassis *Chassis) ActivateSerial(slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
-	if slotNumber > len(chassis.Slots) {
-		errorMsg := fmt.Sprintf("Invalid slot Number %d ", slotNumber)
-		return errors.New(errorMsg)
+
+func (chassis *Chassis) checkRange(slotNumber int, portNumber int, ontNumber int) error {
+	if slotNumber < 1 || slotNumber > len(chassis.Slots) {
+		return &OutOfRangeError{Field: "slot", Value: slotNumber, Max: len(chassis.Slots)}
 	}
-	if portNumber > 16 {
-		errorMsg := fmt.Sprintf("Invalid port Number %d ", portNumber)
-		return errors.New(errorMsg)
+	if portNumber < 1 || portNumber > MAX_PORTS {
+		return &OutOfRangeError{Field: "port", Value: portNumber, Max: MAX_PORTS}
 	}
-	if ontNumber > 64 {
-		errorMsg := fmt.Sprintf("Invalid ont Number %d ", ontNumber)
-		return errors.New(errorMsg)
+	if ontNumber < 1 || ontNumber > 64 {
+		return &OutOfRangeError{Field: "ont", Value: ontNumber, Max: 64}
 	}
+	return nil
+}
 
-	err := chassis.Slots[slotNumber-1].Ports[portNumber-1].activateSerial(ontNumber, serialNumber)
-	return err
-
+/*
+PhysicalPort - returns the physical PON port mapped to slotNumber/portNumber once the slot, port and ont are in range
+*/
+func (chassis *Chassis) PhysicalPort(slotNumber int, portNumber int, ontNumber int) (*physical.PONPort, error) {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return nil, err
+	}
+	port := &chassis.Slots[slotNumber-1].Ports[portNumber-1]
+	if port.PhysPort == nil {
+		err := UnprovisonedPortError{oltNum: slotNumber, clli: chassis.CLLI, portNum: portNumber}
+		return nil, &err
+	}
+	return port.PhysPort, nil
 }
-func (chassis *Chassis) ActivateONTFull(slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) error {
-	if slotNumber > len(chassis.Slots) {
-		errorMsg := fmt.Sprintf("Invalid slot Number %d ", slotNumber)
-		return errors.New(errorMsg)
+
+func (chassis *Chassis) PreProvisonONT(slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
-	if portNumber > 16 {
-		errorMsg := fmt.Sprintf("Invalid port Number %d ", portNumber)
-		return errors.New(errorMsg)
+
+	err = chassis.Slots[slotNumber-1].Ports[portNumber-1].preProvisionOnt(ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+	return err
+}
+func (chassis *Chassis) ActivateSerial(ctx context.Context, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
-	if ontNumber > 64 {
-		errorMsg := fmt.Sprintf("Invalid ont Number %d ", ontNumber)
-		return errors.New(errorMsg)
+
+	err = chassis.Slots[slotNumber-1].Ports[portNumber-1].activateSerial(ctx, ontNumber, serialNumber)
+	return err
+
+}
+func (chassis *Chassis) ActivateONTFull(ctx context.Context, slotNumber int, portNumber int, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
 
-	err := chassis.Slots[slotNumber-1].Ports[portNumber-1].provisionOntFull(ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
+	err = chassis.Slots[slotNumber-1].Ports[portNumber-1].provisionOntFull(ctx, ontNumber, serialNumber, cTag, sTag, nasPortID, circuitID)
 	return err
 }
 
-func (chassis *Chassis) ActivateONT(slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
-	if slotNumber > len(chassis.Slots) {
-		errorMsg := fmt.Sprintf("Invalid slot Number %d ", slotNumber)
-		return errors.New(errorMsg)
+func (chassis *Chassis) ActivateONT(ctx context.Context, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
+	}
+	err = chassis.Slots[slotNumber-1].Ports[portNumber-1].provisionOnt(ctx, ontNumber, serialNumber)
+	return err
+}
+func (chassis *Chassis) ModifyONT(ctx context.Context, slotNumber int, portNumber int, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) ([]string, error) {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return nil, err
 	}
-	if portNumber > 16 {
-		errorMsg := fmt.Sprintf("Invalid port Number %d ", portNumber)
-		return errors.New(errorMsg)
+	return chassis.Slots[slotNumber-1].Ports[portNumber-1].modifyOnt(ctx, ontNumber, cTag, sTag, nasPortID, circuitID, techProfile, speedProfile)
+}
+func (chassis *Chassis) SuspendONT(ctx context.Context, slotNumber int, portNumber int, ontNumber int) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
-	if ontNumber > 64 {
-		errorMsg := fmt.Sprintf("Invalid ont Number %d ", ontNumber)
-		return errors.New(errorMsg)
+	return chassis.Slots[slotNumber-1].Ports[portNumber-1].suspendOnt(ctx, ontNumber)
+}
+func (chassis *Chassis) ResumeONT(ctx context.Context, slotNumber int, portNumber int, ontNumber int) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
-	err := chassis.Slots[slotNumber-1].Ports[portNumber-1].provisionOnt(ontNumber, serialNumber)
-	return err
+	return chassis.Slots[slotNumber-1].Ports[portNumber-1].resumeOnt(ctx, ontNumber)
+}
+func (chassis *Chassis) ReplaceONTSerial(ctx context.Context, slotNumber int, portNumber int, ontNumber int, serialNumber string) (string, error) {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return "", err
+	}
+	return chassis.Slots[slotNumber-1].Ports[portNumber-1].replaceOntSerial(ctx, ontNumber, serialNumber)
 }
-func (chassis *Chassis) DeleteONT(slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
-	if slotNumber > len(chassis.Slots) {
-		errorMsg := fmt.Sprintf("Invalid slot Number %d ", slotNumber)
-		return errors.New(errorMsg)
+
+/*
+MoveONT - moves the active ont at slot/port/ont on from to toSlot/toPort/toOnt on to, which may be the same chassis.
+With keepIdentity the ont keeps its vlans, nas port id and circuit id, otherwise they are recomputed from the vlan
+plan of the destination the same way ActivateONT does
+*/
+func MoveONT(ctx context.Context, from *Chassis, slotNumber int, portNumber int, ontNumber int, to *Chassis, toSlot int, toPort int, toOnt int, keepIdentity bool) (physical.Ont, error) {
+	err := from.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return physical.Ont{}, err
 	}
-	if portNumber > 16 {
-		errorMsg := fmt.Sprintf("Invalid port Number %d ", portNumber)
-		return errors.New(errorMsg)
+	err = to.checkRange(toSlot, toPort, toOnt)
+	if err != nil {
+		return physical.Ont{}, err
 	}
-	if ontNumber > 64 {
-		errorMsg := fmt.Sprintf("Invalid ont Number %d ", ontNumber)
-		return errors.New(errorMsg)
+	source := &from.Slots[slotNumber-1].Ports[portNumber-1]
+	destination := &to.Slots[toSlot-1].Ports[toPort-1]
+	for _, port := range []*Port{source, destination} {
+		if port.PhysPort == nil {
+			err := UnprovisonedPortError{oltNum: port.Parent.Number, clli: port.Parent.Parent.CLLI, portNum: port.Number}
+			return physical.Ont{}, &err
+		}
+	}
+	ont := source.PhysPort.Onts[ontNumber-1]
+	sVlan, cVlan, nasPortID, circuitID := ont.Svlan, ont.Cvlan, ont.NasPortID, ont.CircuitID
+	if !keepIdentity {
+		plan := destination.Onts[toOnt-1]
+		sVlan, cVlan = plan.Svlan, plan.Cvlan
+		nasPortID, circuitID = destination.generatedIDs(toOnt)
+	}
+	return physical.MoveOnt(ctx, source.PhysPort, ontNumber, destination.PhysPort, toOnt, sVlan, cVlan, nasPortID, circuitID)
+}
+func (chassis *Chassis) DeleteONT(ctx context.Context, slotNumber int, portNumber int, ontNumber int, serialNumber string) error {
+	err := chassis.checkRange(slotNumber, portNumber, ontNumber)
+	if err != nil {
+		return err
 	}
-	err := chassis.Slots[slotNumber-1].Ports[portNumber-1].deleteOnt(ontNumber, serialNumber)
+	err = chassis.Slots[slotNumber-1].Ports[portNumber-1].deleteOnt(ctx, ontNumber, serialNumber)
 	return err
 }
@@ -0,0 +1,137 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package abstract_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/abstract"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func TestChassis_ReleasePorts(t *testing.T) {
+	chassis := abstract.GenerateChassis("MY_CLLI", 1, 1)
+	first := make([]physical.PONPort, 16)
+	second := make([]physical.PONPort, 16)
+	for i := range first {
+		chassis.AssignPort(&first[i])
+	}
+	for i := range second {
+		chassis.AssignPort(&second[i])
+	}
+	if second[0].AbstractSlot != 2 || second[0].AbstractPort != 1 {
+		t.Errorf("second olt should start at slot 2 port 1 and starts at slot %d port %d\n", second[0].AbstractSlot, second[0].AbstractPort)
+	}
+
+	released := chassis.ReleasePorts(first)
+	if released != 16 {
+		t.Errorf("ReleasePorts should release 16 ports and released %d\n", released)
+	}
+	if chassis.Slots[0].Ports[0].PhysPort != nil {
+		t.Error("slot 1 port 1 should be unmapped after ReleasePorts")
+	}
+
+	replacement := make([]physical.PONPort, 16)
+	for i := range replacement {
+		chassis.AssignPort(&replacement[i])
+	}
+	if replacement[0].AbstractSlot != 1 || replacement[15].AbstractPort != 16 {
+		t.Errorf("replacement olt should reuse slot 1 and got slot %d\n", replacement[0].AbstractSlot)
+	}
+	if chassis.Slots[0].Ports[3].PhysPort != &replacement[3] {
+		t.Error("slot 1 port 4 should be mapped to the replacement olt")
+	}
+	if chassis.Slots[1].Ports[0].PhysPort != &second[0] {
+		t.Error("slot 2 port 1 should still be mapped to the second olt")
+	}
+}
+
+func TestChassis_RestorePort(t *testing.T) {
+	chassis := abstract.GenerateChassis("MY_CLLI", 1, 1)
+	port := physical.PONPort{AbstractSlot: 3, AbstractPort: 2}
+	if _, err := chassis.RestorePort(&port); err != nil {
+		t.Errorf("RestorePort failed with %v\n", err)
+	}
+	if _, err := chassis.RestorePort(&physical.PONPort{AbstractSlot: 3, AbstractPort: 2}); err == nil {
+		t.Error("RestorePort should fail for an abstract port that is already mapped")
+	}
+	next := physical.PONPort{}
+	chassis.AssignPort(&next)
+	if next.AbstractSlot != 1 || next.AbstractPort != 1 {
+		t.Errorf("AssignPort should fill the hole at slot 1 port 1 and used slot %d port %d\n", next.AbstractSlot, next.AbstractPort)
+	}
+}
+
+func TestChassis_MoveONT(t *testing.T) {
+	physical.ResetIndex()
+	ctx := context.Background()
+	settings.SetDummy(true)
+	chassis := abstract.GenerateChassis("MOVE_CLLI", 1, 1)
+	phyChassis := &physical.Chassis{CLLI: "MOVE_CLLI"}
+	olt := physical.SimpleOLT{CLLI: "MOVE_CLLI", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: phyChassis}
+	olt.CreateEdgecore()
+	phyChassis.AddOLTChassis(ctx, olt)
+	ports := phyChassis.Linecards[0].Ports
+	for i := range ports {
+		chassis.AssignPort(&ports[i])
+	}
+
+	_, err := abstract.MoveONT(ctx, &chassis, 1, 1, 1, &chassis, 1, 2, 3, true)
+	if _, ok := err.(*physical.OntNotActiveError); !ok {
+		t.Fatalf("Expected OntNotActiveError moving an inactive ont got %v", err)
+	}
+	chassis.ActivateONT(ctx, 1, 1, 1, "MOVE1")
+	original := ports[0].Onts[0]
+
+	moved, err := abstract.MoveONT(ctx, &chassis, 1, 1, 1, &chassis, 1, 2, 3, false)
+	if err != nil {
+		t.Fatalf("MoveONT failed with %v", err)
+	}
+	plan := chassis.Slots[0].Ports[1].Onts[2]
+	if moved.Svlan != plan.Svlan || moved.Cvlan != plan.Cvlan || moved.CircuitID != fmt.Sprintf("MOVE_CLLI 1/1/%d/2:3.1.1", chassis.Slots[0].Number) {
+		t.Fatalf("Recomputed identity does not match the vlan plan of the new position %v", moved)
+	}
+	if ports[1].Onts[2].State != physical.OntActive || ports[1].Onts[2].SerialNumber != "MOVE1" {
+		t.Fatal("Ont is not active on its new port")
+	}
+	if ports[0].Onts[0].State != physical.OntEmpty || ports[0].Onts[0].Number != 0 {
+		t.Fatal("Ont was not removed from its old port")
+	}
+
+	moved, err = abstract.MoveONT(ctx, &chassis, 1, 2, 3, &chassis, 1, 1, 1, true)
+	if err != nil {
+		t.Fatalf("MoveONT failed with %v", err)
+	}
+	if moved.Svlan != plan.Svlan || moved.Cvlan != plan.Cvlan || moved.CircuitID == original.CircuitID {
+		t.Fatalf("Kept identity should not change the vlans %v", moved)
+	}
+
+	// the ont kept the circuit id of 1/2/3 so no other ont can be given it there
+	err = chassis.ActivateONT(ctx, 1, 2, 3, "MOVE2")
+	if _, ok := err.(*physical.OntIDInUseError); !ok {
+		t.Fatalf("Expected OntIDInUseError activating an ont with a circuit id in use got %v", err)
+	}
+	chassis.ActivateONT(ctx, 1, 2, 4, "MOVE2")
+	_, err = abstract.MoveONT(ctx, &chassis, 1, 1, 1, &chassis, 1, 2, 4, true)
+	if _, ok := err.(*physical.AllReadyActiveError); !ok {
+		t.Fatalf("Expected AllReadyActiveError moving onto an active ont got %v", err)
+	}
+}
@@ -17,6 +17,7 @@
 package abstract
 
 import (
+	"context"
 	"fmt"
 
 	"gerrit.opencord.org/abstract-olt/models/physical"
@@ -48,13 +49,23 @@ Error - the interface method that must be implemented on error
 func (e *UnprovisonedPortError) Error() string {
 	return fmt.Sprintf("Port %d for olt %d on AbstractChasis  %s is not provisioned", e.portNum, e.oltNum, e.clli)
 }
-func (port *Port) provisionOnt(ontNumber int, serialNumber string) error {
 
+/*
+generatedIDs - the nas port id and circuit id the abstract chassis gives the ont at ontNumber on this port
+*/
+func (port *Port) generatedIDs(ontNumber int) (string, string) {
 	slot := port.Parent
 	chassis := slot.Parent
 	baseID := fmt.Sprintf("%d/%d/%d/%d:%d.1.1", chassis.Rack, chassis.Shelf, slot.Number, port.Number, ontNumber)
 	nasPortID := fmt.Sprintf("PON %s", baseID)
 	circuitID := fmt.Sprintf("%s %s", chassis.CLLI, baseID)
+	return nasPortID, circuitID
+}
+func (port *Port) provisionOnt(ctx context.Context, ontNumber int, serialNumber string) error {
+
+	slot := port.Parent
+	chassis := slot.Parent
+	nasPortID, circuitID := port.generatedIDs(ontNumber)
 
 	if port.PhysPort == nil {
 		err := UnprovisonedPortError{oltNum: slot.Number, clli: chassis.CLLI, portNum: port.Number}
@@ -62,7 +73,7 @@ func (port *Port) provisionOnt(ontNumber int, serialNumber string) error {
 	}
 	phyPort := port.PhysPort
 	ont := port.Onts[ontNumber-1]
-	err := phyPort.ActivateOnt(ontNumber, ont.Svlan, ont.Cvlan, serialNumber, nasPortID, circuitID)
+	err := phyPort.ActivateOnt(ctx, ontNumber, ont.Svlan, ont.Cvlan, serialNumber, nasPortID, circuitID)
 	return err
 }
 func (port *Port) preProvisionOnt(ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) error {
@@ -77,7 +88,7 @@ func (port *Port) preProvisionOnt(ontNumber int, cTag uint32, sTag uint32, nasPo
 	err := phyPort.PreProvisionOnt(ontNumber, sTag, cTag, nasPortID, circuitID, techProfile, speedProfile)
 	return err
 }
-func (port *Port) activateSerial(ontNumber int, serialNumber string) error {
+func (port *Port) activateSerial(ctx context.Context, ontNumber int, serialNumber string) error {
 	slot := port.Parent
 
 	if port.PhysPort == nil {
@@ -86,10 +97,10 @@ func (port *Port) activateSerial(ontNumber int, serialNumber string) error {
 		return &err
 	}
 	phyPort := port.PhysPort
-	err := phyPort.ActivateSerial(ontNumber, serialNumber)
+	err := phyPort.ActivateSerial(ctx, ontNumber, serialNumber)
 	return err
 }
-func (port *Port) provisionOntFull(ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) error {
+func (port *Port) provisionOntFull(ctx context.Context, ontNumber int, serialNumber string, cTag uint32, sTag uint32, nasPortID string, circuitID string) error {
 	slot := port.Parent
 
 	if port.PhysPort == nil {
@@ -98,10 +109,50 @@ func (port *Port) provisionOntFull(ontNumber int, serialNumber string, cTag uint
 		return &err
 	}
 	phyPort := port.PhysPort
-	err := phyPort.ActivateOnt(ontNumber, sTag, cTag, serialNumber, nasPortID, circuitID)
+	err := phyPort.ActivateOnt(ctx, ontNumber, sTag, cTag, serialNumber, nasPortID, circuitID)
 	return err
 }
-func (port *Port) deleteOnt(ontNumber int, serialNumber string) error {
+func (port *Port) modifyOnt(ctx context.Context, ontNumber int, cTag uint32, sTag uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) ([]string, error) {
+	if port.PhysPort == nil {
+		slot := port.Parent
+		chassis := slot.Parent
+		err := UnprovisonedPortError{oltNum: slot.Number, clli: chassis.CLLI, portNum: port.Number}
+		return nil, &err
+	}
+	phyPort := port.PhysPort
+	return phyPort.ModifyOnt(ctx, ontNumber, sTag, cTag, nasPortID, circuitID, techProfile, speedProfile)
+}
+func (port *Port) suspendOnt(ctx context.Context, ontNumber int) error {
+	if port.PhysPort == nil {
+		slot := port.Parent
+		chassis := slot.Parent
+		err := UnprovisonedPortError{oltNum: slot.Number, clli: chassis.CLLI, portNum: port.Number}
+		return &err
+	}
+	phyPort := port.PhysPort
+	return phyPort.SuspendOnt(ctx, ontNumber)
+}
+func (port *Port) resumeOnt(ctx context.Context, ontNumber int) error {
+	if port.PhysPort == nil {
+		slot := port.Parent
+		chassis := slot.Parent
+		err := UnprovisonedPortError{oltNum: slot.Number, clli: chassis.CLLI, portNum: port.Number}
+		return &err
+	}
+	phyPort := port.PhysPort
+	return phyPort.ResumeOnt(ctx, ontNumber)
+}
+func (port *Port) replaceOntSerial(ctx context.Context, ontNumber int, serialNumber string) (string, error) {
+	if port.PhysPort == nil {
+		slot := port.Parent
+		chassis := slot.Parent
+		err := UnprovisonedPortError{oltNum: slot.Number, clli: chassis.CLLI, portNum: port.Number}
+		return "", &err
+	}
+	phyPort := port.PhysPort
+	return phyPort.ReplaceOntSerial(ctx, ontNumber, serialNumber)
+}
+func (port *Port) deleteOnt(ctx context.Context, ontNumber int, serialNumber string) error {
 	if port.PhysPort == nil {
 		slot := port.Parent
 		chassis := slot.Parent
@@ -110,6 +161,10 @@ func (port *Port) deleteOnt(ontNumber int, serialNumber string) error {
 	}
 	phyPort := port.PhysPort
 	ont := port.Onts[ontNumber-1]
-	err := phyPort.DeleteOnt(ontNumber, ont.Svlan, ont.Cvlan, serialNumber)
+	// the serial number can be left out to delete whatever ont is there
+	if serialNumber == "" {
+		serialNumber = phyPort.Onts[ontNumber-1].SerialNumber
+	}
+	err := phyPort.DeleteOnt(ctx, ontNumber, ont.Svlan, ont.Cvlan, serialNumber)
 	return err
 }
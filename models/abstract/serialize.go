@@ -18,6 +18,7 @@ package abstract
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 func (chassis *Chassis) Serialize() ([]byte, error) {
@@ -43,3 +44,36 @@ func (chassis *Chassis) Deserialize(jsonData []byte) error {
 
 	return err
 }
+
+// the allocation cursor is unexported so only NextPort and AssignPort move it, it is written out so a restored chassis
+// hands out ports in the same order
+type portAllocationJSON struct {
+	Slot       int
+	Port       int
+	OutOfPorts bool
+}
+
+/*
+MarshalJSON - writes out the allocation cursor
+*/
+func (info PortAllocationInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portAllocationJSON{Slot: info.slot, Port: info.port, OutOfPorts: info.outOfPorts})
+}
+
+/*
+UnmarshalJSON - the inverse of MarshalJSON
+*/
+func (info *PortAllocationInfo) UnmarshalJSON(data []byte) error {
+	cursor := portAllocationJSON{}
+	err := json.Unmarshal(data, &cursor)
+	if err != nil {
+		return err
+	}
+	if cursor.Slot < 0 || cursor.Slot >= MAX_SLOTS || cursor.Port < 0 || cursor.Port >= MAX_PORTS {
+		return fmt.Errorf("Invalid port allocation cursor slot %d port %d", cursor.Slot, cursor.Port)
+	}
+	info.slot = cursor.Slot
+	info.port = cursor.Port
+	info.outOfPorts = cursor.OutOfPorts
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var backupsBucket = []byte("backups")
+
+/*
+BoltStorage - keeps every backup in a single embedded key value file, durable without running mongo
+*/
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+/*
+NewBoltStorage - opens or creates the file at path, it is locked for as long as the storage is open so only one
+server can use it
+*/
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(backupsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+/*
+Save - stores data as the backup of clli, it is synced to disk before Save returns
+*/
+func (storage *BoltStorage) Save(clli string, data []byte) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backupsBucket).Put([]byte(clli), data)
+	})
+}
+
+/*
+Load - reads the backup of clli
+*/
+func (storage *BoltStorage) Load(clli string) ([]byte, error) {
+	var data []byte
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(backupsBucket).Get([]byte(clli))
+		if value == nil {
+			return &BackupNotFoundError{CLLI: clli}
+		}
+		// value is only valid while the transaction is open
+		data = append([]byte{}, value...)
+		return nil
+	})
+	return data, err
+}
+
+/*
+List - returns the name of every backup
+*/
+func (storage *BoltStorage) List() ([]string, error) {
+	names := []string{}
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(backupsBucket).ForEach(func(key []byte, value []byte) error {
+			names = append(names, string(key))
+			return nil
+		})
+	})
+	return names, err
+}
+
+/*
+Delete - removes the backup of clli, it is not an error if there is none
+*/
+func (storage *BoltStorage) Delete(clli string) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backupsBucket).Delete([]byte(clli))
+	})
+}
+
+/*
+Close - releases the file so another server can open it
+*/
+func (storage *BoltStorage) Close() error {
+	return storage.db.Close()
+}
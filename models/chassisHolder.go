@@ -16,6 +16,8 @@
 package models
 
 import (
+	"sync"
+
 	"gerrit.opencord.org/abstract-olt/models/abstract"
 	"gerrit.opencord.org/abstract-olt/models/physical"
 )
@@ -23,4 +25,22 @@ import (
 type ChassisHolder struct {
 	PhysicalChassis physical.Chassis
 	AbstractChassis abstract.Chassis
+	// guards both chassis, taken through LockChassis and RLockChassis
+	lock sync.RWMutex
+	// set once the chassis is no longer in the chassis map so callers that were waiting on lock look it up again
+	removed bool
+}
+
+/*
+Unlock - releases a chassis locked with LockChassis
+*/
+func (chassisHolder *ChassisHolder) Unlock() {
+	chassisHolder.lock.Unlock()
+}
+
+/*
+RUnlock - releases a chassis locked with RLockChassis
+*/
+func (chassisHolder *ChassisHolder) RUnlock() {
+	chassisHolder.lock.RUnlock()
 }
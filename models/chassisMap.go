@@ -17,14 +17,20 @@
 package models
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 )
 
 var once sync.Once
 var chassisMap map[string]*ChassisHolder
 
+// guards adding and removing entries of the chassis map, each chassis has its own lock for its contents
+var chassisMapLock sync.RWMutex
+
 /*
-GetChassisMap return the chassis map singleton
+GetChassisMap return the chassis map singleton, once the server is running it is only safe to use through the
+functions below
 */
 func GetChassisMap() *map[string]*ChassisHolder {
 	// the go singleton pattern
@@ -33,3 +39,128 @@ func GetChassisMap() *map[string]*ChassisHolder {
 	})
 	return &chassisMap
 }
+
+func lookupChassis(clli string) *ChassisHolder {
+	chassisMapLock.RLock()
+	defer chassisMapLock.RUnlock()
+	return (*GetChassisMap())[clli]
+}
+
+/*
+LockChassis - returns the chassis for clli locked for writing, or nil when there is none
+*/
+func LockChassis(clli string) *ChassisHolder {
+	for {
+		chassisHolder := lookupChassis(clli)
+		if chassisHolder == nil {
+			return nil
+		}
+		chassisHolder.lock.Lock()
+		if !chassisHolder.removed {
+			return chassisHolder
+		}
+		// removed while waiting for the lock, a new chassis may have taken its clli since
+		chassisHolder.lock.Unlock()
+	}
+}
+
+/*
+RLockChassis - returns the chassis for clli locked for reading, or nil when there is none
+*/
+func RLockChassis(clli string) *ChassisHolder {
+	for {
+		chassisHolder := lookupChassis(clli)
+		if chassisHolder == nil {
+			return nil
+		}
+		chassisHolder.lock.RLock()
+		if !chassisHolder.removed {
+			return chassisHolder
+		}
+		chassisHolder.lock.RUnlock()
+	}
+}
+
+/*
+AddChassis - stores chassisHolder as the chassis for clli unless there already is one
+*/
+func AddChassis(clli string, chassisHolder *ChassisHolder) error {
+	chassisMapLock.Lock()
+	defer chassisMapLock.Unlock()
+	chassisMap := GetChassisMap()
+	if (*chassisMap)[clli] != nil {
+		return &ChassisExistsError{CLLI: clli}
+	}
+	(*chassisMap)[clli] = chassisHolder
+	return nil
+}
+
+/*
+RemoveChassis - drops the chassis for clli, callers must hold it locked with LockChassis
+*/
+func RemoveChassis(clli string) {
+	chassisMapLock.Lock()
+	defer chassisMapLock.Unlock()
+	chassisMap := GetChassisMap()
+	if chassisHolder := (*chassisMap)[clli]; chassisHolder != nil {
+		chassisHolder.removed = true
+		delete(*chassisMap, clli)
+	}
+}
+
+/*
+ReplaceChassis - swaps old, the chassis for clli, for chassisHolder which is returned locked for writing, old is nil
+when there is no chassis for clli. Callers must hold old locked with LockChassis, those waiting on it get chassisHolder
+once they have the lock
+*/
+func ReplaceChassis(clli string, old *ChassisHolder, chassisHolder *ChassisHolder) error {
+	chassisMapLock.Lock()
+	defer chassisMapLock.Unlock()
+	chassisMap := GetChassisMap()
+	if (*chassisMap)[clli] != old {
+		return &ChassisExistsError{CLLI: clli}
+	}
+	if old != nil {
+		old.removed = true
+	}
+	chassisHolder.lock.Lock()
+	(*chassisMap)[clli] = chassisHolder
+	return nil
+}
+
+/*
+ChassisCLLIs - returns the clli of every chassis in order
+*/
+func ChassisCLLIs() []string {
+	chassisMapLock.RLock()
+	defer chassisMapLock.RUnlock()
+	chassisMap := GetChassisMap()
+	cllis := make([]string, 0, len(*chassisMap))
+	for clli := range *chassisMap {
+		cllis = append(cllis, clli)
+	}
+	sort.Strings(cllis)
+	return cllis
+}
+
+/*
+ChassisNotFoundError - returned when there is no chassis with the requested CLLI
+*/
+type ChassisNotFoundError struct {
+	CLLI string
+}
+
+func (e *ChassisNotFoundError) Error() string {
+	return fmt.Sprintf("There is no chassis with CLLI of %s", e.CLLI)
+}
+
+/*
+ChassisExistsError - returned when creating a chassis with a CLLI that is already in use
+*/
+type ChassisExistsError struct {
+	CLLI string
+}
+
+func (e *ChassisExistsError) Error() string {
+	return fmt.Sprintf("AbstractChassis %s already exists", e.CLLI)
+}
@@ -30,3 +30,93 @@ func TestChassisMap_GetPhyChassisMap(t *testing.T) {
 		t.Fatalf("GetPhyChassisMap should always return pointer to same map")
 	}
 }
+
+func TestChassisMap_LockChassis(t *testing.T) {
+	first := &models.ChassisHolder{}
+	err := models.AddChassis("LOCK_TEST_B", first)
+	if err != nil {
+		t.Fatalf("AddChassis failed with %v", err)
+	}
+	err = models.AddChassis("LOCK_TEST_B", &models.ChassisHolder{})
+	if _, ok := err.(*models.ChassisExistsError); !ok {
+		t.Fatalf("AddChassis of an existing clli should fail with ChassisExistsError not %v", err)
+	}
+	models.AddChassis("LOCK_TEST_A", &models.ChassisHolder{})
+	cllis := models.ChassisCLLIs()
+	indexA, indexB := -1, -1
+	for i, clli := range cllis {
+		switch clli {
+		case "LOCK_TEST_A":
+			indexA = i
+		case "LOCK_TEST_B":
+			indexB = i
+		}
+	}
+	if indexA < 0 || indexB != indexA+1 {
+		t.Fatalf("ChassisCLLIs should return every clli in order got %v", cllis)
+	}
+
+	// readers share the lock
+	reader := models.RLockChassis("LOCK_TEST_B")
+	if reader != first {
+		t.Fatalf("RLockChassis returned the wrong chassis")
+	}
+	if other := models.RLockChassis("LOCK_TEST_B"); other != first {
+		t.Fatalf("RLockChassis should not wait on another reader")
+	} else {
+		other.RUnlock()
+	}
+	reader.RUnlock()
+
+	holder := models.LockChassis("LOCK_TEST_B")
+	waiter := make(chan *models.ChassisHolder)
+	go func() {
+		waiter <- models.LockChassis("LOCK_TEST_B")
+	}()
+	models.RemoveChassis("LOCK_TEST_B")
+	holder.Unlock()
+	if got := <-waiter; got != nil {
+		t.Fatalf("LockChassis waiting on a chassis that was removed should return nil")
+	}
+	if models.RLockChassis("LOCK_TEST_B") != nil {
+		t.Fatalf("RLockChassis of a removed chassis should return nil")
+	}
+	if models.LockChassis("LOCK_TEST_C") != nil {
+		t.Fatalf("LockChassis of an unknown clli should return nil")
+	}
+	models.RemoveChassis("LOCK_TEST_A")
+}
+
+func TestChassisMap_ReplaceChassis(t *testing.T) {
+	old := &models.ChassisHolder{}
+	models.AddChassis("REPLACE_TEST", old)
+	holder := models.LockChassis("REPLACE_TEST")
+	waiter := make(chan *models.ChassisHolder)
+	go func() {
+		waiter <- models.LockChassis("REPLACE_TEST")
+	}()
+	replacement := &models.ChassisHolder{}
+	err := models.ReplaceChassis("REPLACE_TEST", &models.ChassisHolder{}, replacement)
+	if _, ok := err.(*models.ChassisExistsError); !ok {
+		t.Fatalf("ReplaceChassis of a chassis that is not the current one should fail with ChassisExistsError not %v", err)
+	}
+	err = models.ReplaceChassis("REPLACE_TEST", holder, replacement)
+	if err != nil {
+		t.Fatalf("ReplaceChassis failed with %v", err)
+	}
+	holder.Unlock()
+	replacement.Unlock()
+	got := <-waiter
+	if got != replacement {
+		t.Fatalf("LockChassis waiting on a chassis that was replaced should return the replacement")
+	}
+	got.Unlock()
+	added := &models.ChassisHolder{}
+	err = models.ReplaceChassis("REPLACE_TEST_NEW", nil, added)
+	if err != nil {
+		t.Fatalf("ReplaceChassis of a clli with no chassis failed with %v", err)
+	}
+	added.Unlock()
+	models.RemoveChassis("REPLACE_TEST")
+	models.RemoveChassis("REPLACE_TEST_NEW")
+}
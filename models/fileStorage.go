@@ -0,0 +1,144 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kept in the backup directory so it is created by the image, it is not a backup
+const backupPlaceHolder = "BackupPlaceHolder"
+
+// suffix of a backup that is still being written
+const tempSuffix = ".tmp"
+
+/*
+FileStorage - keeps each backup in its own file in Dir
+*/
+type FileStorage struct {
+	Dir string
+}
+
+/*
+NewFileStorage - returns storage that keeps its backups in dir, which must already exist
+*/
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{Dir: dir}
+}
+
+/*
+Save - writes data to a temporary file and renames it over the backup so a crash never leaves a partial backup, the
+file and the rename are both synced to disk before Save returns
+*/
+func (storage *FileStorage) Save(clli string, data []byte) error {
+	backupFile := filepath.Join(storage.Dir, clli)
+	tempFile := backupFile + tempSuffix
+	err := writeSynced(tempFile, data)
+	if err == nil {
+		err = os.Rename(tempFile, backupFile)
+	}
+	if err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return syncDir(storage.Dir)
+}
+
+/*
+writeSynced - writes data to the file name and flushes it to disk before closing it
+*/
+func writeSynced(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+syncDir - flushes the entries of dir to disk so a file just renamed into it is still there after a crash
+*/
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+Load - reads the backup of clli
+*/
+func (storage *FileStorage) Load(clli string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(storage.Dir, clli))
+	if os.IsNotExist(err) {
+		return nil, &BackupNotFoundError{CLLI: clli}
+	}
+	return data, err
+}
+
+/*
+List - returns the name of every backup in Dir
+*/
+func (storage *FileStorage) List() ([]string, error) {
+	files, err := ioutil.ReadDir(storage.Dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if file.IsDir() || file.Name() == backupPlaceHolder || strings.HasSuffix(file.Name(), tempSuffix) {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	return names, nil
+}
+
+/*
+Delete - removes the backup of clli, it is not an error if there is none
+*/
+func (storage *FileStorage) Delete(clli string) error {
+	err := os.Remove(filepath.Join(storage.Dir, clli))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+/*
+Close - nothing is held open between calls
+*/
+func (storage *FileStorage) Close() error {
+	return nil
+}
@@ -18,10 +18,10 @@ package inventory
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net"
 
 	"gerrit.opencord.org/abstract-olt/models"
+	"gerrit.opencord.org/abstract-olt/models/abstract"
 	"gerrit.opencord.org/abstract-olt/models/physical"
 )
 
@@ -49,6 +49,8 @@ type Port struct {
 type Ont struct {
 	Number       int
 	Active       bool
+	Suspended    bool
+	State        string
 	SVlan        uint32
 	CVlan        uint32
 	SerialNumber string
@@ -57,29 +59,50 @@ type Ont struct {
 }
 
 func GatherAllInventory() string {
-	chassisMap := models.GetChassisMap()
+	chassis_s := GetAllChassis()
+	bytes, _ := json.Marshal(chassis_s)
+	return string(bytes)
+}
+
+func GatherInventory(clli string) (string, error) {
+	chassis, err := GetChassis(clli)
+	if err != nil {
+		return "", err
+	}
+	bytes, _ := json.Marshal(chassis)
+	return string(bytes), nil
+}
+
+/*
+GetAllChassis - returns the inventory of every chassis currently provisioned, each read under its own lock
+*/
+func GetAllChassis() []Chassis {
 	chassis_s := []Chassis{}
-	for clli, chassisHolder := range *chassisMap {
+	for _, clli := range models.ChassisCLLIs() {
+		chassisHolder := models.RLockChassis(clli)
+		if chassisHolder == nil {
+			continue
+		}
 		chassis := parseClli(clli, chassisHolder)
+		chassisHolder.RUnlock()
 		chassis_s = append(chassis_s, chassis)
 	}
-	bytes, _ := json.Marshal(chassis_s)
-	return string(bytes)
+	return chassis_s
 }
 
-func GatherInventory(clli string) (string, error) {
+/*
+GetChassis - returns the inventory of the chassis with the given clli
+*/
+func GetChassis(clli string) (Chassis, error) {
 	if clli == "" {
-		return "", errors.New("You must provide a CLLI")
+		return Chassis{}, errors.New("You must provide a CLLI")
 	}
-	chassisMap := models.GetChassisMap()
-	chassisHolder := (*chassisMap)[clli]
+	chassisHolder := models.RLockChassis(clli)
 	if chassisHolder == nil {
-		errorMsg := fmt.Sprintf("No Chassis Holder found for CLLI %s", clli)
-		return "", errors.New(errorMsg)
+		return Chassis{}, &models.ChassisNotFoundError{CLLI: clli}
 	}
-	chassis := parseClli(clli, chassisHolder)
-	bytes, _ := json.Marshal(chassis)
-	return string(bytes), nil
+	defer chassisHolder.RUnlock()
+	return parseClli(clli, chassisHolder), nil
 }
 
 func parseClli(clli string, chassisHolder *models.ChassisHolder) Chassis {
@@ -92,7 +115,7 @@ func parseClli(clli string, chassisHolder *models.ChassisHolder) Chassis {
 
 	lineCards := []LineCard{}
 	for index, slot := range abstract.Slots {
-		if slot.Ports[0].PhysPort != nil {
+		if slotMapped(slot) {
 			lineCard := LineCard{Number: index + 1}
 			var currentOLT *physical.SimpleOLT
 			var physicalOLT PhysicalOlt
@@ -115,8 +138,9 @@ func parseClli(clli string, chassisHolder *models.ChassisHolder) Chassis {
 					port := Port{AbstractNumber: i + 1, PhysicalNumber: ponPort.Number}
 					onts := []Ont{}
 					for _, physicalONT := range ponPort.Onts {
-						if physicalONT.CircuitID != "" {
-							ont := Ont{Number: physicalONT.Number, Active: physicalONT.Active, SVlan: physicalONT.Svlan, CVlan: physicalONT.Cvlan, SerialNumber: physicalONT.SerialNumber,
+						if physicalONT.State != physical.OntEmpty {
+							ont := Ont{Number: physicalONT.Number, Active: physicalONT.State == physical.OntActive, Suspended: physicalONT.State == physical.OntSuspended,
+								State: physicalONT.State.String(), SVlan: physicalONT.Svlan, CVlan: physicalONT.Cvlan, SerialNumber: physicalONT.SerialNumber,
 								NasPortID: physicalONT.NasPortID, CircuitID: physicalONT.CircuitID}
 							onts = append(onts, ont)
 						}
@@ -137,3 +161,13 @@ func parseClli(clli string, chassisHolder *models.ChassisHolder) Chassis {
 	chassis.LineCards = lineCards
 	return chassis
 }
+
+// a slot can have holes left behind by a removed olt so check every port
+func slotMapped(slot abstract.Slot) bool {
+	for _, port := range slot.Ports {
+		if port.PhysPort != nil {
+			return true
+		}
+	}
+	return false
+}
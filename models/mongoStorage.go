@@ -0,0 +1,126 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/mongodb/mongo-go-driver/x/bsonx"
+	context "golang.org/x/net/context"
+)
+
+/*
+MongoStorage - keeps each backup as a document of the AbstractOLT backups collection with the CLLI as its _id
+*/
+type MongoStorage struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+/*
+NewMongoStorage - connects to the mongodb at uri as user, the connection is shared by every call until Close
+*/
+func NewMongoStorage(uri string, user string, password string) (*MongoStorage, error) {
+	clientOptions := options.Client()
+	creds := options.Credential{AuthMechanism: "SCRAM-SHA-256", AuthSource: "AbstractOLT", Username: user, Password: password}
+	clientOptions.SetAuth(creds)
+	client, err := mongo.NewClientWithOptions(uri, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("connect to mongo db @%s failed with %v", uri, err)
+	}
+	collection := client.Database("AbstractOLT").Collection("backups")
+	return &MongoStorage{client: client, collection: collection}, nil
+}
+
+/*
+Save - updates the backup of clli or inserts it if there is none
+*/
+func (storage *MongoStorage) Save(clli string, data []byte) error {
+	upsert := true
+	_, err := storage.collection.UpdateOne(context.Background(), bson.D{{"_id", clli}},
+		bson.D{{"$set", bson.D{{"body", data}}}}, &options.UpdateOptions{Upsert: &upsert})
+	return err
+}
+
+/*
+Load - reads the backup of clli
+*/
+func (storage *MongoStorage) Load(clli string) ([]byte, error) {
+	doc := bsonx.Doc{}
+	err := storage.collection.FindOne(context.Background(), bson.D{{"_id", clli}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, &BackupNotFoundError{CLLI: clli}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, data := doc.LookupElement("body").Value.Binary()
+	return data, nil
+}
+
+/*
+List - returns the _id of every backup
+*/
+func (storage *MongoStorage) List() ([]string, error) {
+	cur, err := storage.collection.Find(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+	names := []string{}
+	for cur.Next(context.Background()) {
+		doc := bsonx.Doc{}
+		err := cur.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, doc.LookupElement("_id").Value.StringValue())
+	}
+	return names, cur.Err()
+}
+
+/*
+Delete - removes the backup of clli, it is not an error if there is none
+*/
+func (storage *MongoStorage) Delete(clli string) error {
+	_, err := storage.collection.DeleteOne(context.Background(), bson.D{{"_id", clli}})
+	return err
+}
+
+/*
+Ping - checks that mongo answers within timeout
+*/
+func (storage *MongoStorage) Ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return storage.client.Ping(ctx, nil)
+}
+
+/*
+Close - disconnects from mongo
+*/
+func (storage *MongoStorage) Close() error {
+	return storage.client.Disconnect(context.Background())
+}
@@ -25,11 +25,14 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"gerrit.opencord.org/abstract-olt/contrib/xos"
 	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
 	"gerrit.opencord.org/abstract-olt/models/tosca"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type basicAuth struct {
@@ -60,6 +63,14 @@ type Chassis struct {
 	Linecards   []SimpleOLT
 	Rack        int
 	Shelf       int
+	Recorder    *Recorder `json:"-" bson:"-"`
+}
+
+/*
+xosContext - bounds a call to XOS by the southbound timeout and ctx, the request it is made for
+*/
+func xosContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, settings.GetSouthboundTimeout())
 }
 
 /*
@@ -74,36 +85,278 @@ func (e *UnprovisionedSlotError) Error() string {
 	return fmt.Sprintf("SlotNumber %d in Chassis %s is currently unprovsioned", e.SlotNumber, e.CLLI)
 }
 
+/*
+OLTNotFoundError - returned when there is no olt chassis with the requested hostname
+*/
+type OLTNotFoundError struct {
+	CLLI     string
+	Hostname string
+}
+
+func (e *OLTNotFoundError) Error() string {
+	return fmt.Sprintf("There is no OLT chassis with hostname %s in chassis %s", e.Hostname, e.CLLI)
+}
+
+/*
+OLTExistsError - returned when an olt chassis would get a hostname already in use in the chassis
+*/
+type OLTExistsError struct {
+	CLLI     string
+	Hostname string
+}
+
+func (e *OLTExistsError) Error() string {
+	return fmt.Sprintf("OLT chassis with hostname %s already exists in chassis %s", e.Hostname, e.CLLI)
+}
+
+/*
+ActiveOntsError - returned when removing equipment that still has active onts without force
+*/
+type ActiveOntsError struct {
+	CLLI     string
+	Hostname string
+	Count    int
+}
+
+func (e *ActiveOntsError) Error() string {
+	if e.Hostname == "" {
+		return fmt.Sprintf("AbstractChassis %s still has %d active onts, use force to delete it", e.CLLI, e.Count)
+	}
+	return fmt.Sprintf("OLT chassis %s still has %d active onts, use force to remove it", e.Hostname, e.Count)
+}
+
+/*
+XOSError - returned when a change was applied to the chassis but pushing it to XOS failed, unless RolledBack is set
+in which case the change was undone
+*/
+type XOSError struct {
+	CLLI       string
+	Operation  string
+	Err        error
+	RolledBack bool
+	// the ont was left failed and may be activated again
+	activationFailed bool
+}
+
+func (e *XOSError) Error() string {
+	return fmt.Sprintf("Unable to %s in XOS for Chassis %s: %v", e.Operation, e.CLLI, e.Err)
+}
+
+/*
+xosFailures - every call to XOS that failed while an operation pushed several changes, each an *XOSError
+*/
+type xosFailures []error
+
+func (failures xosFailures) Error() string {
+	messages := make([]string, len(failures))
+	for i, err := range failures {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+/*
+collectXOSErrors - returns nil when none of the calls made by operation failed, otherwise an XOSError holding the
+failures
+*/
+func (chassis *Chassis) collectXOSErrors(operation string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &XOSError{CLLI: chassis.CLLI, Operation: operation, Err: xosFailures(errs)}
+}
+
+/*
+Retryable - true when repeating the request that failed is safe, either nothing was changed or the ont it activated
+was left failed and may be activated again
+*/
+func (e *XOSError) Retryable() bool {
+	return e.RolledBack || e.activationFailed
+}
+
+/*
+TimedOut - true when XOS did not answer before the request deadline or the southbound timeout ran out
+*/
+func (e *XOSError) TimedOut() bool {
+	if failures, ok := e.Err.(xosFailures); ok {
+		for _, err := range failures {
+			if xosErr, ok := err.(*XOSError); ok && xosErr.TimedOut() {
+				return true
+			}
+		}
+		return false
+	}
+	if e.Err == context.DeadlineExceeded {
+		return true
+	}
+	if st, ok := status.FromError(e.Err); ok && st.Code() == codes.DeadlineExceeded {
+		return true
+	}
+	// covers the *url.Error returned by TOSCA calls that ran out of time
+	if netErr, ok := e.Err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
 /*
 AddOLTChassis - adds a reference to a new olt chassis
 */
-func (chassis *Chassis) AddOLTChassis(olt SimpleOLT) {
+func (chassis *Chassis) AddOLTChassis(ctx context.Context, olt SimpleOLT) error {
 	olt.SetNumber((len(chassis.Linecards) + 1))
 	chassis.Linecards = append(chassis.Linecards, olt)
+	chassis.linkLinecards()
+	err := chassis.sendOlt(ctx, olt)
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "add olt " + olt.Hostname, Err: err}
+	}
+	return nil
+}
+
+func (chassis *Chassis) sendOlt(ctx context.Context, olt SimpleOLT) error {
 	if settings.GetGrpc() {
-		chassis.SendOltGRPC(olt)
-	} else {
-		chassis.SendOltTosca(olt)
+		return chassis.SendOltGRPC(ctx, olt)
+	}
+	return chassis.SendOltTosca(ctx, olt)
+}
+
+/*
+linkLinecards - points every linecard at the chassis and the PON ports of each at the linecard, which moves whenever
+Linecards grows or shrinks
+*/
+func (chassis *Chassis) linkLinecards() {
+	for i := range chassis.Linecards {
+		olt := &chassis.Linecards[i]
+		olt.Parent = chassis
+		for j := range olt.Ports {
+			olt.Ports[j].Parent = olt
+		}
+	}
+}
+
+/*
+FindOLT - returns the index in Linecards of the olt chassis with the given hostname or -1 if there isn't one
+*/
+func (chassis *Chassis) FindOLT(hostname string) int {
+	for i := range chassis.Linecards {
+		if chassis.Linecards[i].Hostname == hostname {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+RemoveOLTChassis - tears down any active onts on the olt chassis, removes it from XOS and drops it from Linecards,
+returns the olt chassis and the onts removed from XOS. When XOS fails to remove any of them the olt chassis is kept,
+with the onts XOS did not remove failed, and the failures are returned in an XOSError
+*/
+func (chassis *Chassis) RemoveOLTChassis(ctx context.Context, index int) (SimpleOLT, []Ont, error) {
+	olt := chassis.Linecards[index]
+	var removed []Ont
+	var errs []error
+	for j := range olt.Ports {
+		onts, portErrs := chassis.deprovisionOnts(ctx, &olt.Ports[j])
+		removed = append(removed, onts...)
+		errs = append(errs, portErrs...)
 	}
+	if len(errs) == 0 {
+		if err := chassis.deleteOLT(ctx, olt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return olt, removed, chassis.collectXOSErrors("remove olt "+olt.Hostname, errs)
+	}
+	unindexPorts(olt.Ports)
+	chassis.Linecards = append(chassis.Linecards[:index], chassis.Linecards[index+1:]...)
+	chassis.linkLinecards()
+	return olt, removed, nil
+}
+
+/*
+ReplaceOLTChassis - swaps the olt chassis at index for the replacement, which takes over its ports and onts,
+every active ont is removed from XOS under the old olt and provisioned again under the replacement. The swap is kept
+whatever XOS answers, the calls to XOS that failed are returned in an XOSError
+*/
+func (chassis *Chassis) ReplaceOLTChassis(ctx context.Context, index int, replacement *SimpleOLT) error {
+	old := chassis.Linecards[index]
+	var errs []error
+	for j := range old.Ports {
+		port := &old.Ports[j]
+		for k := range port.Onts {
+			if port.Onts[k].Provisioned() {
+				port.Onts[k].Parent = port
+				if err := chassis.deleteONT(ctx, port.Onts[k]); err != nil {
+					errs = append(errs, err)
+				}
+				if err := chassis.deleteSubscriber(ctx, port.Onts[k]); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if err := chassis.deleteOLT(ctx, old); err != nil {
+		errs = append(errs, err)
+	}
+
+	replacement.Number = old.Number
+	replacement.DataSwitchPort = old.DataSwitchPort
+	replacement.Ports = old.Ports
+	chassis.Linecards[index] = *replacement
+	chassis.linkLinecards()
+	olt := &chassis.Linecards[index]
+	if err := chassis.sendOlt(ctx, *olt); err != nil {
+		errs = append(errs, &XOSError{CLLI: chassis.CLLI, Operation: "add olt " + olt.Hostname, Err: err})
+	}
+	for j := range olt.Ports {
+		port := &olt.Ports[j]
+		for k := range port.Onts {
+			if port.Onts[k].Provisioned() {
+				port.Onts[k].Parent = port
+				if err := chassis.provisionONT(ctx, port.Onts[k]); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return chassis.collectXOSErrors("replace olt "+old.Hostname, errs)
 }
 
 /*
 SendOltGRPC - provisions olt using grpc interface
 */
-func (chassis *Chassis) SendOltGRPC(olt SimpleOLT) error {
+func (chassis *Chassis) SendOltGRPC(ctx context.Context, olt SimpleOLT) error {
+	device := &xos.OLTDevice{
+		NamePresent:             &xos.OLTDevice_Name{olt.Hostname},
+		DeviceTypePresent:       &xos.OLTDevice_DeviceType{olt.Driver},
+		HostPresent:             &xos.OLTDevice_Host{olt.GetAddress().IP.String()},
+		PortPresent:             &xos.OLTDevice_Port{int32(olt.GetAddress().Port)},
+		OuterTpidPresent:        &xos.OLTDevice_OuterTpid{"0x8100"},
+		UplinkPresent:           &xos.OLTDevice_Uplink{"65536"},
+		NasIdPresent:            &xos.OLTDevice_NasId{olt.CLLI},
+		SwitchDatapathIdPresent: &xos.OLTDevice_SwitchDatapathId{"of:0000000000000001"},
+		SwitchPortPresent:       &xos.OLTDevice_SwitchPort{"1"},
+	}
+	// VoltServiceId is looked up in XOS so it is left out of a recorded device
+	if chassis.recordGRPC("CreateOLTDevice", device) {
+		return nil
+	}
 	if settings.GetDummy() {
 		log.Println("Running in Dummy mode with GRPC in SendOltGRPC")
 		return nil
 	}
-	conn, err := grpc.Dial(chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
 		username: chassis.XOSUser,
 		password: chassis.XOSPassword,
 	}))
-	defer conn.Close()
 	if err != nil {
 		log.Println(err)
 		return err
 	}
+	defer conn.Close()
 
 	xosClient := xos.NewXosClient(conn)
 	//queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "volt_service_instances", Value: &xos.QueryElement_SValue{"volt"}}
@@ -111,7 +364,7 @@ func (chassis *Chassis) SendOltGRPC(olt SimpleOLT) error {
 	queryElements := []*xos.QueryElement{queryElement}
 	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
 
-	voltResponse, err := xosClient.FilterVOLTService(context.Background(), query)
+	voltResponse, err := xosClient.FilterVOLTService(ctx, query)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -122,18 +375,8 @@ func (chassis *Chassis) SendOltGRPC(olt SimpleOLT) error {
 	}
 	voltService := voltServices[0]
 
-	response, err := xosClient.CreateOLTDevice(context.Background(), &xos.OLTDevice{
-		NamePresent:             &xos.OLTDevice_Name{olt.Hostname},
-		DeviceTypePresent:       &xos.OLTDevice_DeviceType{olt.Driver},
-		HostPresent:             &xos.OLTDevice_Host{olt.GetAddress().IP.String()},
-		PortPresent:             &xos.OLTDevice_Port{int32(olt.GetAddress().Port)},
-		OuterTpidPresent:        &xos.OLTDevice_OuterTpid{"0x8100"},
-		UplinkPresent:           &xos.OLTDevice_Uplink{"65536"},
-		NasIdPresent:            &xos.OLTDevice_NasId{olt.CLLI},
-		SwitchDatapathIdPresent: &xos.OLTDevice_SwitchDatapathId{"of:0000000000000001"},
-		SwitchPortPresent:       &xos.OLTDevice_SwitchPort{"1"},
-		VoltServicePresent:      &xos.OLTDevice_VoltServiceId{voltService.GetId()},
-	})
+	device.VoltServicePresent = &xos.OLTDevice_VoltServiceId{voltService.GetId()}
+	response, err := xosClient.CreateOLTDevice(ctx, device)
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
@@ -145,11 +388,14 @@ func (chassis *Chassis) SendOltGRPC(olt SimpleOLT) error {
 /*
 SendOltTosca - Provision OLT using TOSCA Interface
 */
-func (chassis *Chassis) SendOltTosca(olt SimpleOLT) error {
+func (chassis *Chassis) SendOltTosca(ctx context.Context, olt SimpleOLT) error {
 	ipString := olt.GetAddress().IP.String()
 	webServerPort := olt.GetAddress().Port
 	oltStruct := tosca.NewOltProvision(chassis.CLLI, olt.GetHostname(), olt.Driver, ipString, webServerPort)
 	yaml, _ := oltStruct.ToYaml()
+	if chassis.recordTosca("/run", yaml) {
+		return nil
+	}
 	if settings.GetDummy() {
 		log.Printf("yaml:%s\n", yaml)
 		log.Println("YAML IS NOT BEING SET TO XOS or DEBUG is Set")
@@ -159,9 +405,12 @@ func (chassis *Chassis) SendOltTosca(olt SimpleOLT) error {
 	if settings.GetDebug() {
 		log.Printf("yaml:%s\n", yaml)
 	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
 	client := &http.Client{}
 	requestList := fmt.Sprintf("http://%s:%d/run", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
 	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
 	req.Header.Add("xos-username", chassis.XOSUser)
 	req.Header.Add("xos-password", chassis.XOSPassword)
 	resp, err := client.Do(req)
@@ -172,48 +421,88 @@ func (chassis *Chassis) SendOltTosca(olt SimpleOLT) error {
 	log.Printf("Server response was %v\n", resp.Body)
 	return nil
 }
-func (chassis *Chassis) provisionONT(ont Ont) {
+func (chassis *Chassis) provisionONT(ctx context.Context, ont Ont) error {
 	//TODO - api call to provison s/c vlans and ont serial number etc
 	log.Printf("chassis.provisionONT(%s,SVlan:%d,CVlan:%d)\n", ont.SerialNumber, ont.Svlan, ont.Cvlan)
+	var subscriberErr error
+	ontErr := chassis.whitelistONT(ctx, ont)
 	if settings.GetGrpc() {
-		chassis.SendOntGRPC(ont)
-		chassis.SendSubscriberGRPC(ont)
+		subscriberErr = chassis.SendSubscriberGRPC(ctx, ont)
 	} else {
-		chassis.SendOntTosca(ont)
-		chassis.SendSubscriberTosca(ont)
+		subscriberErr = chassis.SendSubscriberTosca(ctx, ont)
+	}
+	if ontErr != nil {
+		return ontErr
 	}
+	if subscriberErr != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "provision subscriber " + ont.SerialNumber, Err: subscriberErr}
+	}
+	return nil
 }
 
 /*
-SendOntGRPC - Provision ONT on XOS using GRPC interface
+whitelistONT - adds the serial number of ont to the XOS whitelist so it is let onto its PON port, suspended onts are left off
 */
-func (chassis *Chassis) SendOntGRPC(ont Ont) error {
-	if settings.GetDummy() {
-		log.Println("Running in Dummy mode with GRPC in SendOntGRPC")
+func (chassis *Chassis) whitelistONT(ctx context.Context, ont Ont) error {
+	if ont.State == OntSuspended {
 		return nil
 	}
+	var err error
+	if settings.GetGrpc() {
+		err = chassis.SendOntGRPC(ctx, ont)
+	} else {
+		err = chassis.SendOntTosca(ctx, ont)
+	}
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "provision ont " + ont.SerialNumber, Err: err}
+	}
+	return nil
+}
+
+/*
+SendOntGRPC - Provision ONT on XOS using GRPC interface
+*/
+func (chassis *Chassis) SendOntGRPC(ctx context.Context, ont Ont) error {
 	ponPort := ont.Parent
 	slot := ponPort.Parent
 	ip := slot.Address.IP
 	ipNum := []byte(ip[12:16]) //only handling ipv4
 	ofID := fmt.Sprintf("of:00000000%0x", ipNum)
+	offset := 1 << 29
+	ponPortNumber := offset + (ponPort.Number - 1)
+	entry := &xos.AttWorkflowDriverWhiteListEntry{
+		SerialNumberPresent: &xos.AttWorkflowDriverWhiteListEntry_SerialNumber{ont.SerialNumber},
+		//DeviceIdPresent:     &xos.AttWorkflowDriverWhiteListEntry_DeviceId{deviceID},
+		DeviceIdPresent:  &xos.AttWorkflowDriverWhiteListEntry_DeviceId{ofID},
+		PonPortIdPresent: &xos.AttWorkflowDriverWhiteListEntry_PonPortId{int32(ponPortNumber)},
+	}
+	// OwnerId is looked up in XOS so it is left out of a recorded entry
+	if chassis.recordGRPC("CreateAttWorkflowDriverWhiteListEntry", entry) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Println("Running in Dummy mode with GRPC in SendOntGRPC")
+		return nil
+	}
 
-	conn, err := grpc.Dial(chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
 		username: chassis.XOSUser,
 		password: chassis.XOSPassword,
 	},
 	))
-	defer conn.Close()
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
 	}
+	defer conn.Close()
 	xosClient := xos.NewXosClient(conn)
 	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "name", Value: &xos.QueryElement_SValue{"att-workflow-driver"}}
 	queryElements := []*xos.QueryElement{queryElement}
 	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
 
-	attWorkFlowResponse, err := xosClient.FilterAttWorkflowDriverService(context.Background(), query)
+	attWorkFlowResponse, err := xosClient.FilterAttWorkflowDriverService(ctx, query)
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
@@ -232,7 +521,7 @@ func (chassis *Chassis) SendOntGRPC(ont Ont) error {
 	newQueryElements := []*xos.QueryElement{newQueryElement}
 	query = &xos.Query{Kind: xos.Query_DEFAULT, Elements: newQueryElements}
 
-	onuResponse, err := xosClient.FilterONUDevice(context.Background(), query)
+	onuResponse, err := xosClient.FilterONUDevice(ctx, query)
 	log.Printf("FilterONU response is %s", onuResponse)
 	onus := onuResponse.GetItems()
 	if len(onus) == 0 {
@@ -242,16 +531,9 @@ func (chassis *Chassis) SendOntGRPC(ont Ont) error {
 	}
 	deviceID := onus[0].GetDeviceId()
 
-	offset := 1 << 29
-	ponPortNumber := offset + (ponPort.Number - 1)
 	log.Printf("Calling xosClient.CreateAttWorkflowDriverWhiteListEntry with SerialNumberPresent: %s DeviceIdPresent: %s PonPortIdPresent: %d OwnerPresent: %d", ont.SerialNumber, deviceID, ponPortNumber, attWorkFlowService.GetId())
-	response, err := xosClient.CreateAttWorkflowDriverWhiteListEntry(context.Background(), &xos.AttWorkflowDriverWhiteListEntry{
-		SerialNumberPresent: &xos.AttWorkflowDriverWhiteListEntry_SerialNumber{ont.SerialNumber},
-		//DeviceIdPresent:     &xos.AttWorkflowDriverWhiteListEntry_DeviceId{deviceID},
-		DeviceIdPresent:  &xos.AttWorkflowDriverWhiteListEntry_DeviceId{ofID},
-		PonPortIdPresent: &xos.AttWorkflowDriverWhiteListEntry_PonPortId{int32(ponPortNumber)},
-		OwnerPresent:     &xos.AttWorkflowDriverWhiteListEntry_OwnerId{attWorkFlowService.GetId()},
-	})
+	entry.OwnerPresent = &xos.AttWorkflowDriverWhiteListEntry_OwnerId{attWorkFlowService.GetId()}
+	response, err := xosClient.CreateAttWorkflowDriverWhiteListEntry(ctx, entry)
 
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
@@ -264,20 +546,26 @@ func (chassis *Chassis) SendOntGRPC(ont Ont) error {
 /*
 SendOntTosca - Provision ONT on XOS using Tosca interface
 */
-func (chassis *Chassis) SendOntTosca(ont Ont) error {
+func (chassis *Chassis) SendOntTosca(ctx context.Context, ont Ont) error {
 	ponPort := ont.Parent
 	slot := ponPort.Parent
 	ontStruct := tosca.NewOntProvision(ont.SerialNumber, slot.Address.IP, ponPort.Number)
 	yaml, _ := ontStruct.ToYaml()
+	if chassis.recordTosca("/run", yaml) {
+		return nil
+	}
 
 	if settings.GetDummy() {
 		log.Printf("yaml:%s\n", yaml)
 		log.Println("YAML IS NOT BEING SET TO XOS")
 		return nil
 	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
 	client := &http.Client{}
 	requestList := fmt.Sprintf("http://%s:%d/run", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
 	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
 	req.Header.Add("xos-username", chassis.XOSUser)
 	req.Header.Add("xos-password", chassis.XOSPassword)
 	resp, err := client.Do(req)
@@ -292,58 +580,124 @@ func (chassis *Chassis) SendOntTosca(ont Ont) error {
 /*
 SendSubscriberGRPC - Provisons a subscriber using the GRPC Interface
 */
-func (chassis *Chassis) SendSubscriberGRPC(ont Ont) error {
+func (chassis *Chassis) SendSubscriberGRPC(ctx context.Context, ont Ont) error {
+	subscriber := chassis.rcordSubscriber(ont)
+	if chassis.recordGRPC("CreateRCORDSubscriber", subscriber) {
+		return nil
+	}
 	if settings.GetDummy() {
 		log.Println("Running in Dummy mode with GRPC in SendSubscriberGRPC")
 		return nil
 	}
-	ponPort := ont.Parent
-	slot := ponPort.Parent
-	conn, err := grpc.Dial(chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
 		username: chassis.XOSUser,
 		password: chassis.XOSPassword,
 	}))
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
 	defer conn.Close()
+
+	xosClient := xos.NewXosClient(conn)
+	response, err := xosClient.CreateRCORDSubscriber(ctx, subscriber)
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
 	}
+	log.Println(response)
+	return nil
+
+}
 
+/*
+updateSubscriberGRPC - pushes the vlans, NasPortID, CircuitID and serial number of an ont to the RCORDSubscriber whose
+onu_device is serialNumber using XOS GRPC Interface
+*/
+func (chassis *Chassis) updateSubscriberGRPC(ctx context.Context, ont Ont, serialNumber string) error {
+	subscriber := chassis.rcordSubscriber(ont)
+	// the XOS id is looked up by onu_device so it is left out of a recorded subscriber
+	if chassis.recordGRPC("UpdateRCORDSubscriber", subscriber) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Println("Running in Dummy mode with GRPC in updateSubscriberGRPC")
+		return nil
+	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+		username: chassis.XOSUser,
+		password: chassis.XOSPassword,
+	}))
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	defer conn.Close()
 	xosClient := xos.NewXosClient(conn)
-	rgName := fmt.Sprintf("%s_%d_%d_%d_RG", chassis.CLLI, slot.Number, ponPort.Number, ont.Number)
-	response, err := xosClient.CreateRCORDSubscriber(context.Background(), &xos.RCORDSubscriber{
-		NamePresent:      &xos.RCORDSubscriber_Name{rgName},
-		CTagPresent:      &xos.RCORDSubscriber_CTag{int32(ont.Cvlan)},
-		STagPresent:      &xos.RCORDSubscriber_STag{int32(ont.Svlan)},
-		OnuDevicePresent: &xos.RCORDSubscriber_OnuDevice{ont.SerialNumber},
-		NasPortIdPresent: &xos.RCORDSubscriber_NasPortId{ont.NasPortID},
-		CircuitIdPresent: &xos.RCORDSubscriber_CircuitId{ont.CircuitID},
-		RemoteIdPresent:  &xos.RCORDSubscriber_RemoteId{chassis.CLLI}})
+	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "onu_device", Value: &xos.QueryElement_SValue{serialNumber}}
+	queryElements := []*xos.QueryElement{queryElement}
+	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
+	subscriberResponse, err := xosClient.FilterRCORDSubscriber(ctx, query)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	subscribers := subscriberResponse.GetItems()
+	if len(subscribers) == 0 {
+		errorMsg := fmt.Sprintf("Unable to find RCORDSubscriber in XOS with OnuDevice %s", serialNumber)
+		return errors.New(errorMsg)
+	}
+	subscriber.IdPresent = &xos.RCORDSubscriber_Id{subscribers[0].GetId()}
+	log.Printf("UpdateRCORDSubscriber XOSID:%d\n", subscribers[0].GetId())
+	response, err := xosClient.UpdateRCORDSubscriber(ctx, subscriber)
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
 	}
 	log.Println(response)
 	return nil
+}
 
+func (chassis *Chassis) rcordSubscriber(ont Ont) *xos.RCORDSubscriber {
+	ponPort := ont.Parent
+	slot := ponPort.Parent
+	rgName := fmt.Sprintf("%s_%d_%d_%d_RG", chassis.CLLI, slot.Number, ponPort.Number, ont.Number)
+	return &xos.RCORDSubscriber{
+		NamePresent:      &xos.RCORDSubscriber_Name{rgName},
+		CTagPresent:      &xos.RCORDSubscriber_CTag{int32(ont.Cvlan)},
+		STagPresent:      &xos.RCORDSubscriber_STag{int32(ont.Svlan)},
+		OnuDevicePresent: &xos.RCORDSubscriber_OnuDevice{ont.SerialNumber},
+		NasPortIdPresent: &xos.RCORDSubscriber_NasPortId{ont.NasPortID},
+		CircuitIdPresent: &xos.RCORDSubscriber_CircuitId{ont.CircuitID},
+		RemoteIdPresent:  &xos.RCORDSubscriber_RemoteId{chassis.CLLI}}
 }
 
 /*
 SendSubscriberTosca - Provisons a subscriber using the Tosca Interface
 */
-func (chassis *Chassis) SendSubscriberTosca(ont Ont) error {
+func (chassis *Chassis) SendSubscriberTosca(ctx context.Context, ont Ont) error {
 	ponPort := ont.Parent
 	slot := ponPort.Parent
 	requestList := fmt.Sprintf("http://%s:%d/run", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
 	rgName := fmt.Sprintf("%s_%d_%d_%d_RG", chassis.CLLI, slot.Number, ponPort.Number, ont.Number)
 	subStruct := tosca.NewSubscriberProvision(rgName, ont.Cvlan, ont.Svlan, ont.SerialNumber, ont.NasPortID, ont.CircuitID, chassis.CLLI)
 	yaml, _ := subStruct.ToYaml()
+	if chassis.recordTosca("/run", yaml) {
+		return nil
+	}
 	if settings.GetDummy() {
 		log.Printf("yaml:%s\n", yaml)
 		log.Println("YAML IS NOT BEING SET TO XOS")
 		return nil
 	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
 	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
 	req.Header.Add("xos-username", chassis.XOSUser)
 	req.Header.Add("xos-password", chassis.XOSPassword)
 	client := &http.Client{}
@@ -357,37 +711,200 @@ func (chassis *Chassis) SendSubscriberTosca(ont Ont) error {
 	return nil
 }
 
-func (chassis *Chassis) deleteONT(ont Ont) {
+/*
+GetActiveOnts - returns every ont on the chassis that is currently active
+*/
+func (chassis *Chassis) GetActiveOnts() []Ont {
+	onts := []Ont{}
+	for i := range chassis.Linecards {
+		olt := &chassis.Linecards[i]
+		for j := range olt.Ports {
+			port := &olt.Ports[j]
+			for k := range port.Onts {
+				if port.Onts[k].Provisioned() {
+					onts = append(onts, port.Onts[k])
+				}
+			}
+		}
+	}
+	return onts
+}
+
+/*
+Teardown - removes the whitelist entry and subscriber of every active ont from XOS and returns the onts removed. An
+ont XOS failed to remove is left failed so tearing down again retries it, the failures are returned in an XOSError
+*/
+func (chassis *Chassis) Teardown(ctx context.Context) ([]Ont, error) {
+	var removed []Ont
+	var errs []error
+	for i := range chassis.Linecards {
+		olt := &chassis.Linecards[i]
+		for j := range olt.Ports {
+			onts, portErrs := chassis.deprovisionOnts(ctx, &olt.Ports[j])
+			removed = append(removed, onts...)
+			errs = append(errs, portErrs...)
+		}
+	}
+	return removed, chassis.collectXOSErrors("tear down chassis", errs)
+}
+
+/*
+deprovisionOnts - removes the whitelist entry and subscriber of every provisioned ont on the port from XOS, an ont is
+only marked pre-provisioned once both are gone and failed when either is not. Returns the onts removed and what XOS
+failed to remove
+*/
+func (chassis *Chassis) deprovisionOnts(ctx context.Context, port *PONPort) ([]Ont, []error) {
+	var removed []Ont
+	var errs []error
+	for k := range port.Onts {
+		ont := &port.Onts[k]
+		if !ont.Provisioned() {
+			continue
+		}
+		err := port.checkTransition(k+1, OntDeleting, "Delete")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ont.Parent = port
+		// XOS is sent the ont as it was so a suspended ont is not looked for on the whitelist
+		previous := *ont
+		port.unindexOnt(k + 1)
+		ont.setState(OntDeleting)
+		ontErr := chassis.deleteONT(ctx, previous)
+		subscriberErr := chassis.deleteSubscriber(ctx, previous)
+		if ontErr != nil {
+			errs = append(errs, ontErr)
+		}
+		if subscriberErr != nil {
+			errs = append(errs, subscriberErr)
+		}
+		if ontErr != nil || subscriberErr != nil {
+			ont.setState(OntFailed)
+			port.indexOnt(k + 1)
+			continue
+		}
+		removed = append(removed, previous)
+		ont.setState(OntPreProvisioned)
+		port.indexOnt(k + 1)
+	}
+	return removed, errs
+}
+
+func (chassis *Chassis) modifyONT(ctx context.Context, ont Ont) error {
+	log.Printf("chassis.modifyONT(%s,SVlan:%d,CVlan:%d)\n", ont.SerialNumber, ont.Svlan, ont.Cvlan)
+	var err error
+	if settings.GetGrpc() {
+		err = chassis.updateSubscriberGRPC(ctx, ont, ont.SerialNumber)
+	} else {
+		// the subscriber provisioning template updates the existing subscriber with the same name
+		err = chassis.SendSubscriberTosca(ctx, ont)
+	}
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "modify subscriber " + ont.SerialNumber, Err: err}
+	}
+	return nil
+}
+
+/*
+replaceONT - whitelists the new serial number of ont and points its subscriber at it, the whitelist entry of oldSerial
+must already have been deleted
+*/
+func (chassis *Chassis) replaceONT(ctx context.Context, oldSerial string, ont Ont) error {
+	log.Printf("chassis.replaceONT(%s,%s)\n", oldSerial, ont.SerialNumber)
+	var subscriberErr error
+	ontErr := chassis.whitelistONT(ctx, ont)
+	if settings.GetGrpc() {
+		subscriberErr = chassis.updateSubscriberGRPC(ctx, ont, oldSerial)
+	} else {
+		subscriberErr = chassis.SendSubscriberTosca(ctx, ont)
+	}
+	if ontErr != nil {
+		return ontErr
+	}
+	if subscriberErr != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "modify subscriber " + oldSerial, Err: subscriberErr}
+	}
+	return nil
+}
+
+/*
+checkVlans - makes sure no ont on the chassis other than ont and those in skip uses the sVlan/cVlan pair
+*/
+func (chassis *Chassis) checkVlans(ont *Ont, sVlan uint32, cVlan uint32, skip ...*Ont) error {
+	for i := range chassis.Linecards {
+		olt := &chassis.Linecards[i]
+		for j := range olt.Ports {
+			port := &olt.Ports[j]
+			for k := range port.Onts {
+				other := &port.Onts[k]
+				if other == ont || other.Number == 0 || isOneOf(other, skip) {
+					continue
+				}
+				if other.Svlan == sVlan && other.Cvlan == cVlan {
+					return &VlanInUseError{CLLI: chassis.CLLI, Svlan: sVlan, Cvlan: cVlan, Hostname: olt.Hostname, PortNumber: port.Number, OntNumber: other.Number}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isOneOf(ont *Ont, onts []*Ont) bool {
+	for _, o := range onts {
+		if o == ont {
+			return true
+		}
+	}
+	return false
+}
+
+func (chassis *Chassis) deleteONT(ctx context.Context, ont Ont) error {
 	log.Printf("chassis.deleteONT(%s,SVlan:%d,CVlan:%d)\n", ont.SerialNumber, ont.Svlan, ont.Cvlan)
+	// a suspended ont was already taken off the whitelist
+	if ont.State == OntSuspended {
+		return nil
+	}
+	var err error
 	if settings.GetGrpc() {
-		chassis.deleteOntWhitelistGRPC(ont)
+		err = chassis.deleteOntWhitelistGRPC(ctx, ont)
 	} else {
-		chassis.deleteOntTosca(ont)
+		err = chassis.deleteOntTosca(ctx, ont)
 	}
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "delete ont " + ont.SerialNumber, Err: err}
+	}
+	return nil
 }
 
 /*
 deleteOntGRPC - deletes ONT using XOS GRPC Interface
 */
-func (chassis *Chassis) deleteOntWhitelistGRPC(ont Ont) error {
+func (chassis *Chassis) deleteOntWhitelistGRPC(ctx context.Context, ont Ont) error {
+	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "serial_number", Value: &xos.QueryElement_SValue{ont.SerialNumber}}
+	queryElements := []*xos.QueryElement{queryElement}
+	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
+	// the query selecting what would be deleted is recorded as the XOS id is not known
+	if chassis.recordGRPC("DeleteAttWorkflowDriverWhiteListEntry", query) {
+		return nil
+	}
 	if settings.GetDummy() {
 		log.Println("Running in Dummy mode with GRPC in SendSubscriberGRPC")
 		return nil
 	}
-	conn, err := grpc.Dial(chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
 		username: chassis.XOSUser,
 		password: chassis.XOSPassword,
 	}))
-	defer conn.Close()
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
 		return err
 	}
+	defer conn.Close()
 	xosClient := xos.NewXosClient(conn)
-	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "serial_number", Value: &xos.QueryElement_SValue{ont.SerialNumber}}
-	queryElements := []*xos.QueryElement{queryElement}
-	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
-	onuResponse, err := xosClient.FilterAttWorkflowDriverWhiteListEntry(context.Background(), query)
+	onuResponse, err := xosClient.FilterAttWorkflowDriverWhiteListEntry(ctx, query)
 	onus := onuResponse.GetItems()
 	if len(onus) == 0 {
 		errorMsg := fmt.Sprintf("Unable to find WhiteListEntry in XOS with SerialNumber %s", ont.SerialNumber)
@@ -398,7 +915,7 @@ func (chassis *Chassis) deleteOntWhitelistGRPC(ont Ont) error {
 
 	id := &xos.ID{Id: onu.GetId()}
 	log.Printf("DeleteAttWorkflowDriverWhiteListEntry XOSID:%v\n", id)
-	response, err := xosClient.DeleteAttWorkflowDriverWhiteListEntry(context.Background(), id)
+	response, err := xosClient.DeleteAttWorkflowDriverWhiteListEntry(ctx, id)
 
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
@@ -411,15 +928,24 @@ func (chassis *Chassis) deleteOntWhitelistGRPC(ont Ont) error {
 /*
 deleteOntTosca - deletes ONT using XOS Tosca Interface
 */
-func (chassis *Chassis) deleteOntTosca(ont Ont) {
+func (chassis *Chassis) deleteOntTosca(ctx context.Context, ont Ont) error {
 	ponPort := ont.Parent
 	slot := ponPort.Parent
 	ontStruct := tosca.NewOntProvision(ont.SerialNumber, slot.Address.IP, ponPort.Number)
 	yaml, _ := ontStruct.ToYaml()
 	fmt.Println(yaml)
+	deleteOntStruct := tosca.NewOntDelete(ont.SerialNumber)
+	deleteYaml, _ := deleteOntStruct.ToYaml()
+	if chassis.recordTosca("/delete", yaml) {
+		chassis.recordTosca("/delete", deleteYaml)
+		return nil
+	}
 
 	requestList := fmt.Sprintf("http://%s:%d/delete", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
 	client := &http.Client{}
+	var xosErr error
 	if settings.GetDummy() {
 		log.Printf("yaml:%s\n", yaml)
 		log.Println("YAML IS NOT BEING SET TO XOS")
@@ -428,33 +954,256 @@ func (chassis *Chassis) deleteOntTosca(ont Ont) {
 		log.Println(requestList)
 		log.Println(yaml)
 		if settings.GetDummy() {
-			return
+			return nil
 		}
 		req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+		req = req.WithContext(ctx)
 		req.Header.Add("xos-username", chassis.XOSUser)
 		req.Header.Add("xos-password", chassis.XOSPassword)
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("ERROR :) %v\n", err)
-			// handle error
+			xosErr = err
 		}
 		log.Printf("Response is %v\n", resp)
 	}
-	deleteOntStruct := tosca.NewOntDelete(ont.SerialNumber)
-	yaml, _ = deleteOntStruct.ToYaml()
+	yaml = deleteYaml
 	fmt.Println(yaml)
 	if settings.GetDummy() {
 		log.Printf("yaml:%s\n", yaml)
 		log.Println("YAML IS NOT BEING SET TO XOS")
-		return
+		return nil
 	}
 	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
 	req.Header.Add("xos-username", chassis.XOSUser)
 	req.Header.Add("xos-password", chassis.XOSPassword)
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("ERROR :) %v\n", err)
-		// handle error
+		return err
 	}
 	log.Printf("Response is %v\n", resp)
+	return xosErr
+}
+
+func (chassis *Chassis) deleteSubscriber(ctx context.Context, ont Ont) error {
+	log.Printf("chassis.deleteSubscriber(%s,SVlan:%d,CVlan:%d)\n", ont.SerialNumber, ont.Svlan, ont.Cvlan)
+	var err error
+	if settings.GetGrpc() {
+		err = chassis.deleteSubscriberGRPC(ctx, ont)
+	} else {
+		err = chassis.deleteSubscriberTosca(ctx, ont)
+	}
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "delete subscriber " + ont.SerialNumber, Err: err}
+	}
+	return nil
+}
+
+/*
+deleteSubscriberGRPC - deletes the RCORDSubscriber attached to an ont using XOS GRPC Interface
+*/
+func (chassis *Chassis) deleteSubscriberGRPC(ctx context.Context, ont Ont) error {
+	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "onu_device", Value: &xos.QueryElement_SValue{ont.SerialNumber}}
+	queryElements := []*xos.QueryElement{queryElement}
+	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
+	// the query selecting what would be deleted is recorded as the XOS id is not known
+	if chassis.recordGRPC("DeleteRCORDSubscriber", query) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Println("Running in Dummy mode with GRPC in deleteSubscriberGRPC")
+		return nil
+	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+		username: chassis.XOSUser,
+		password: chassis.XOSPassword,
+	}))
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	defer conn.Close()
+	xosClient := xos.NewXosClient(conn)
+	subscriberResponse, err := xosClient.FilterRCORDSubscriber(ctx, query)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	subscribers := subscriberResponse.GetItems()
+	if len(subscribers) == 0 {
+		errorMsg := fmt.Sprintf("Unable to find RCORDSubscriber in XOS with OnuDevice %s", ont.SerialNumber)
+		return errors.New(errorMsg)
+	}
+	id := &xos.ID{Id: subscribers[0].GetId()}
+	log.Printf("DeleteRCORDSubscriber XOSID:%v\n", id)
+	response, err := xosClient.DeleteRCORDSubscriber(ctx, id)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	log.Printf("Response is %v\n", response)
+	return nil
+}
+
+/*
+deleteSubscriberTosca - deletes the RCORDSubscriber attached to an ont using XOS Tosca Interface
+*/
+func (chassis *Chassis) deleteSubscriberTosca(ctx context.Context, ont Ont) error {
+	ponPort := ont.Parent
+	slot := ponPort.Parent
+	requestList := fmt.Sprintf("http://%s:%d/delete", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
+	rgName := fmt.Sprintf("%s_%d_%d_%d_RG", chassis.CLLI, slot.Number, ponPort.Number, ont.Number)
+	subStruct := tosca.NewSubscriberProvision(rgName, ont.Cvlan, ont.Svlan, ont.SerialNumber, ont.NasPortID, ont.CircuitID, chassis.CLLI)
+	yaml, _ := subStruct.ToYaml()
+	if chassis.recordTosca("/delete", yaml) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Printf("yaml:%s\n", yaml)
+		log.Println("YAML IS NOT BEING SET TO XOS")
+		return nil
+	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
+	req.Header.Add("xos-username", chassis.XOSUser)
+	req.Header.Add("xos-password", chassis.XOSPassword)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	log.Printf("Response is %v\n", resp)
+	return nil
+}
+
+func (chassis *Chassis) deleteOLT(ctx context.Context, olt SimpleOLT) error {
+	log.Printf("chassis.deleteOLT(%s)\n", olt.Hostname)
+	var err error
+	if settings.GetGrpc() {
+		err = chassis.deleteOltGRPC(ctx, olt)
+	} else {
+		err = chassis.deleteOltTosca(ctx, olt)
+	}
+	if err != nil {
+		return &XOSError{CLLI: chassis.CLLI, Operation: "delete olt " + olt.Hostname, Err: err}
+	}
+	return nil
+}
+
+/*
+deleteOltGRPC - deletes OLTDevice using XOS GRPC Interface
+*/
+func (chassis *Chassis) deleteOltGRPC(ctx context.Context, olt SimpleOLT) error {
+	queryElement := &xos.QueryElement{Operator: xos.QueryElement_EQUAL, Name: "name", Value: &xos.QueryElement_SValue{olt.Hostname}}
+	queryElements := []*xos.QueryElement{queryElement}
+	query := &xos.Query{Kind: xos.Query_DEFAULT, Elements: queryElements}
+	// the query selecting what would be deleted is recorded as the XOS id is not known
+	if chassis.recordGRPC("DeleteOLTDevice", query) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Println("Running in Dummy mode with GRPC in deleteOltGRPC")
+		return nil
+	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(basicAuth{
+		username: chassis.XOSUser,
+		password: chassis.XOSPassword,
+	}))
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	defer conn.Close()
+	xosClient := xos.NewXosClient(conn)
+	oltResponse, err := xosClient.FilterOLTDevice(ctx, query)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	olts := oltResponse.GetItems()
+	if len(olts) == 0 {
+		errorMsg := fmt.Sprintf("Unable to find OLTDevice in XOS with Name %s", olt.Hostname)
+		return errors.New(errorMsg)
+	}
+	id := &xos.ID{Id: olts[0].GetId()}
+	log.Printf("DeleteOLTDevice XOSID:%v\n", id)
+	response, err := xosClient.DeleteOLTDevice(ctx, id)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	log.Printf("Response is %v\n", response)
+	return nil
+}
+
+/*
+deleteOltTosca - deletes OLTDevice using XOS Tosca Interface
+*/
+func (chassis *Chassis) deleteOltTosca(ctx context.Context, olt SimpleOLT) error {
+	ipString := olt.GetAddress().IP.String()
+	webServerPort := olt.GetAddress().Port
+	oltStruct := tosca.NewOltProvision(chassis.CLLI, olt.GetHostname(), olt.Driver, ipString, webServerPort)
+	yaml, _ := oltStruct.ToYaml()
+	if chassis.recordTosca("/delete", yaml) {
+		return nil
+	}
+	if settings.GetDummy() {
+		log.Printf("yaml:%s\n", yaml)
+		log.Println("YAML IS NOT BEING SET TO XOS")
+		return nil
+	}
+	ctx, cancel := xosContext(ctx)
+	defer cancel()
+	client := &http.Client{}
+	requestList := fmt.Sprintf("http://%s:%d/delete", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port)
+	req, err := http.NewRequest("POST", requestList, strings.NewReader(yaml))
+	req = req.WithContext(ctx)
+	req.Header.Add("xos-username", chassis.XOSUser)
+	req.Header.Add("xos-password", chassis.XOSPassword)
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("ERROR :) %v\n", err)
+		return err
+	}
+	log.Printf("Response is %v\n", resp)
+	return nil
+}
+
+/*
+PingXOS - checks that the XOS this chassis pushes to answers within timeout, on the gRPC port or the TOSCA /run
+endpoint depending on which interface is in use, nothing is sent to XOS in dummy mode
+*/
+func (chassis *Chassis) PingXOS(timeout time.Duration) error {
+	if settings.GetDummy() {
+		return nil
+	}
+	if settings.GetGrpc() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, chassis.XOSAddress.String(), grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	// /run only takes POSTs so any answer short of a server error means the TOSCA engine is up
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s:%d/run", chassis.XOSAddress.IP.String(), chassis.XOSAddress.Port))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("XOS TOSCA answered %s", resp.Status)
+	}
+	return nil
 }
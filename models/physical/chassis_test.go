@@ -0,0 +1,129 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package physical_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func addEdgecore(chassis *physical.Chassis, hostname string, ip string) {
+	olt := physical.SimpleOLT{CLLI: chassis.CLLI, Hostname: hostname, Address: net.TCPAddr{IP: net.ParseIP(ip), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(context.Background(), olt)
+}
+
+/*
+checkParents - fails unless every linecard points at the chassis and every PON port at the linecard holding it
+*/
+func checkParents(t *testing.T, chassis *physical.Chassis) {
+	for i := range chassis.Linecards {
+		olt := &chassis.Linecards[i]
+		if olt.Parent != chassis {
+			t.Fatalf("Linecard %s does not point at its chassis", olt.Hostname)
+		}
+		for j := range olt.Ports {
+			if olt.Ports[j].Parent != olt {
+				t.Fatalf("PON port %d of %s points at %v", olt.Ports[j].Number, olt.Hostname, olt.Ports[j].Parent)
+			}
+		}
+	}
+}
+
+func TestChassis_RemoveOLTChassis(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "remove_clli"}
+	addEdgecore(chassis, "oltA", "10.0.0.1")
+	addEdgecore(chassis, "oltB", "10.0.0.2")
+	_, _, err := chassis.RemoveOLTChassis(ctx, chassis.FindOLT("oltA"))
+	if err != nil {
+		t.Fatalf("RemoveOLTChassis failed with %v", err)
+	}
+	addEdgecore(chassis, "oltC", "10.0.0.3")
+	checkParents(t, chassis)
+
+	// an ont on oltB is whitelisted against the address of oltB, not of the olt that took its place in Linecards
+	recorder := &physical.Recorder{}
+	chassis.Recorder = recorder
+	settings.SetGrpc(false)
+	port := &chassis.Linecards[chassis.FindOLT("oltB")].Ports[0]
+	err = port.ActivateOnt(ctx, 1, 10, 20, "SERIALB", "nasPortB", "circuitB")
+	chassis.Recorder = nil
+	if err != nil {
+		t.Fatalf("ActivateOnt failed with %v", err)
+	}
+	if len(recorder.Messages) == 0 || !strings.Contains(recorder.Messages[0].Body, "of:000000000a000002") {
+		t.Fatalf("Expected the ont to be whitelisted on the device id of 10.0.0.2 got %v", recorder.Messages)
+	}
+}
+
+func TestChassis_ReplaceOLTChassis(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "replace_olt_clli"}
+	addEdgecore(chassis, "oltA", "10.0.0.1")
+	addEdgecore(chassis, "oltB", "10.0.0.2")
+	chassis.Linecards[1].Ports[0].ActivateOnt(ctx, 1, 10, 20, "SERIALB", "nasPortB", "circuitB")
+
+	// nothing listens on the XOS address so every call to it fails
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port %v", err)
+	}
+	chassis.XOSAddress = *listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	settings.SetDummy(false)
+	settings.SetGrpc(false)
+	replacement := physical.SimpleOLT{CLLI: chassis.CLLI, Hostname: "oltD", Address: net.TCPAddr{IP: net.ParseIP("10.0.0.4"), Port: 9191}}
+	err = chassis.ReplaceOLTChassis(ctx, 1, &replacement)
+	settings.SetDummy(true)
+	xosErr, ok := err.(*physical.XOSError)
+	if !ok || xosErr.RolledBack {
+		t.Fatalf("Expected an XOSError when XOS fails to take the replacement got %v", err)
+	}
+	checkParents(t, chassis)
+	olt := &chassis.Linecards[1]
+	if olt.Hostname != "oltD" || olt.Ports[0].Onts[0].SerialNumber != "SERIALB" || olt.Ports[0].Onts[0].State != physical.OntActive {
+		t.Fatalf("Replacement did not take over the onts of oltB %v", olt.Ports[0].Onts[0])
+	}
+}
+
+func TestChassis_CancelledContext(t *testing.T) {
+	settings.SetDummy(false)
+	settings.SetGrpc(true)
+	defer settings.SetDummy(true)
+	// a cancelled call fails before it dials XOS rather than closing a connection it never made
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chassis := &physical.Chassis{CLLI: "cancelled_clli", XOSAddress: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9}}
+	olt := physical.SimpleOLT{CLLI: "cancelled_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	err := chassis.SendOltGRPC(ctx, olt)
+	if err != context.Canceled {
+		t.Fatalf("Expected SendOltGRPC to fail with %v got %v", context.Canceled, err)
+	}
+	if _, ok := chassis.AddOLTChassis(ctx, olt).(*physical.XOSError); !ok {
+		t.Fatal("Expected AddOLTChassis to fail with an XOSError once its call was cancelled")
+	}
+}
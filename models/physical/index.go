@@ -0,0 +1,213 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package physical
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+/*
+OntLookup - which ont field FindOnt searches on
+*/
+type OntLookup int
+
+const (
+	BySerialNumber OntLookup = iota
+	ByCircuitID
+	ByNasPortID
+)
+
+// clli is kept so the chassis holding the ont can be locked before its port is looked at
+type ontRef struct {
+	clli   string
+	port   *PONPort
+	number int
+}
+
+// secondary index from serial number, circuit id and nas port id to the PONPort slot holding the ont,
+// kept in sync by the PONPort/Chassis methods that change onts. Each value is held by one ont across every chassis
+var ontIndex = struct {
+	sync.RWMutex
+	keys [3]map[string]ontRef
+}{keys: [3]map[string]ontRef{{}, {}, {}}}
+
+var lookupFields = []string{"SerialNumber", "CircuitID", "NasPortID"}
+
+/*
+OntIDInUseError - thrown when an ont is given a circuit id or nas port id another ont already has, the other ont is
+only described when it is on the same chassis
+*/
+type OntIDInUseError struct {
+	Field      string
+	Value      string
+	CLLI       string
+	Hostname   string
+	PortNumber int
+	OntNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *OntIDInUseError) Error() string {
+	if e.Hostname == "" {
+		return fmt.Sprintf("%s %s is already used by an ONT on %s", e.Field, e.Value, e.CLLI)
+	}
+	return fmt.Sprintf("%s %s is already used by ONT %d on PONPort %d of %s on %s", e.Field, e.Value, e.OntNumber, e.PortNumber, e.Hostname, e.CLLI)
+}
+
+// a deleted ont keeps its serial number so it can be activated again but gives it up to any other ont
+func (ont *Ont) indexKeys() [3]string {
+	keys := ont.lookupKeys()
+	if !ont.Provisioned() {
+		keys[BySerialNumber] = ""
+	}
+	return keys
+}
+
+func (ont *Ont) lookupKeys() [3]string {
+	return [3]string{ont.SerialNumber, ont.CircuitID, ont.NasPortID}
+}
+
+/*
+checkKeys - makes sure no other ont has the serial number, circuit id or nas port id ont is to be given, the onts in
+skip are ont itself and may have them. An ont on another chassis is not looked at since that chassis is not locked
+*/
+func (port *PONPort) checkKeys(ont Ont, skip ...*Ont) error {
+	ontIndex.RLock()
+	defer ontIndex.RUnlock()
+	for lookup, key := range ont.lookupKeys() {
+		ref, ok := ontIndex.keys[lookup][key]
+		if key == "" || !ok || isOneOf(&ref.port.Onts[ref.number-1], skip) {
+			continue
+		}
+		var hostname string
+		var portNumber, ontNumber int
+		if ref.clli == port.clli() {
+			hostname, portNumber, ontNumber = ref.port.Parent.Hostname, ref.port.Number, ref.number
+		}
+		if OntLookup(lookup) == BySerialNumber {
+			return &SerialInUseError{SerialNumber: key, CLLI: ref.clli, Hostname: hostname, PortNumber: portNumber, OntNumber: ontNumber}
+		}
+		return &OntIDInUseError{Field: lookupFields[lookup], Value: key, CLLI: ref.clli, Hostname: hostname, PortNumber: portNumber, OntNumber: ontNumber}
+	}
+	return nil
+}
+
+/*
+FindOnt - returns the clli of the chassis holding the ont whose field picked by lookup equals value, its PONPort and the
+ont. Only the clli may be used without holding that chassis locked
+*/
+func FindOnt(lookup OntLookup, value string) (string, *PONPort, *Ont, bool) {
+	if lookup < BySerialNumber || lookup > ByNasPortID || value == "" {
+		return "", nil, nil, false
+	}
+	ontIndex.RLock()
+	defer ontIndex.RUnlock()
+	ref, ok := ontIndex.keys[lookup][value]
+	if !ok {
+		return "", nil, nil, false
+	}
+	return ref.clli, ref.port, &ref.port.Onts[ref.number-1], true
+}
+
+/*
+ResetIndex - empties the ont index
+*/
+func ResetIndex() {
+	ontIndex.Lock()
+	defer ontIndex.Unlock()
+	for i := range ontIndex.keys {
+		ontIndex.keys[i] = map[string]ontRef{}
+	}
+}
+
+/*
+IndexOnts - adds every ont of the chassis to the ont index, used after a chassis is restored from a backup
+*/
+func (chassis *Chassis) IndexOnts() {
+	for i := range chassis.Linecards {
+		indexPorts(chassis.Linecards[i].Ports)
+	}
+}
+
+/*
+UnindexOnts - removes every ont of the chassis from the ont index
+*/
+func (chassis *Chassis) UnindexOnts() {
+	for i := range chassis.Linecards {
+		unindexPorts(chassis.Linecards[i].Ports)
+	}
+}
+
+func indexPorts(ports []PONPort) {
+	for j := range ports {
+		for k := range ports[j].Onts {
+			ports[j].indexOnt(k + 1)
+		}
+	}
+}
+
+func unindexPorts(ports []PONPort) {
+	for j := range ports {
+		for k := range ports[j].Onts {
+			ports[j].unindexOnt(k + 1)
+		}
+	}
+}
+
+func (port *PONPort) indexOnt(number int) {
+	if port.dryRun() {
+		return
+	}
+	ontIndex.Lock()
+	defer ontIndex.Unlock()
+	for lookup, key := range port.Onts[number-1].indexKeys() {
+		if key == "" {
+			continue
+		}
+		// only a restore can get here with a value in use, checkKeys refuses it anywhere else
+		if ref, ok := ontIndex.keys[lookup][key]; ok && (ref.port != port || ref.number != number) {
+			log.Printf("%s %s of ONT %d on PONPort %d of %s is already used on %s, it can not be found by it\n",
+				lookupFields[lookup], key, number, port.Number, port.clli(), ref.clli)
+			continue
+		}
+		ontIndex.keys[lookup][key] = ontRef{clli: port.clli(), port: port, number: number}
+	}
+}
+
+/*
+clli - the clli of the chassis holding the port, the chassis must be locked since Parent moves with its linecard
+*/
+func (port *PONPort) clli() string {
+	if port.Parent == nil || port.Parent.Parent == nil {
+		return ""
+	}
+	return port.Parent.Parent.CLLI
+}
+
+func (port *PONPort) unindexOnt(number int) {
+	ontIndex.Lock()
+	defer ontIndex.Unlock()
+	for lookup, key := range port.Onts[number-1].lookupKeys() {
+		if ref, ok := ontIndex.keys[lookup][key]; ok && ref.port == port && ref.number == number {
+			delete(ontIndex.keys[lookup], key)
+		}
+	}
+}
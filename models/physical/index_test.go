@@ -0,0 +1,105 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package physical_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func TestPhysical_FindOnt(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	clli := "index_clli"
+	chassis := &physical.Chassis{CLLI: clli}
+	olt := &physical.SimpleOLT{CLLI: clli, Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[2]
+
+	port.PreProvisionOnt(5, 10, 20, "PON 1/1/1/3:5.1.1", "index_clli 1/1/1/3:5.1.1", "tech", "speed")
+	foundCLLI, found, ont, ok := physical.FindOnt(physical.ByCircuitID, "index_clli 1/1/1/3:5.1.1")
+	if !ok || foundCLLI != clli || found != port || ont.Number != 5 {
+		t.Fatal("FindOnt failed to find pre provisioned ont by CircuitID")
+	}
+	if _, _, _, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); ok {
+		t.Fatal("FindOnt found an ont by a serial number that was never activated")
+	}
+
+	port.ActivateSerial(ctx, 5, "SERIAL1")
+	if _, _, ont, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); !ok || ont.State != physical.OntActive {
+		t.Fatal("FindOnt failed to find active ont by SerialNumber")
+	}
+	if _, _, _, ok := physical.FindOnt(physical.ByNasPortID, "PON 1/1/1/3:5.1.1"); !ok {
+		t.Fatal("FindOnt failed to find ont by NasPortID")
+	}
+
+	chassis.RemoveOLTChassis(ctx, chassis.FindOLT("slot1"))
+	if _, _, _, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); ok {
+		t.Fatal("FindOnt still finds an ont on a removed olt")
+	}
+}
+
+func TestPhysical_IndexKeys(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	newPort := func(clli string) *physical.PONPort {
+		chassis := &physical.Chassis{CLLI: clli}
+		olt := &physical.SimpleOLT{CLLI: clli, Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+		olt.CreateEdgecore()
+		chassis.AddOLTChassis(ctx, *olt)
+		return &olt.Ports[0]
+	}
+	port := newPort("keys_clli1")
+	port.ActivateOnt(ctx, 1, 10, 20, "SERIAL1", "nasPort1", "circuit1")
+	port.ActivateOnt(ctx, 2, 10, 21, "SERIAL2", "nasPort2", "circuit2")
+
+	// a deleted ont keeps its serial number but another ont may be given it
+	port.DeleteOnt(ctx, 1, 10, 20, "SERIAL1")
+	if _, _, _, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); ok {
+		t.Fatal("FindOnt still finds a deleted ont by its serial number")
+	}
+	if _, err := port.ReplaceOntSerial(ctx, 2, "SERIAL1"); err != nil {
+		t.Fatalf("Expected the serial number of a deleted ont to be free got %v", err)
+	}
+	if _, _, ont, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); !ok || ont.Number != 2 {
+		t.Fatal("FindOnt failed to find the ont given the serial number of a deleted one")
+	}
+	err := port.ActivateSerial(ctx, 1, "SERIAL1")
+	if e, ok := err.(*physical.SerialInUseError); !ok || e.OntNumber != 2 {
+		t.Fatalf("Expected SerialInUseError activating a deleted ont whose serial number was reused got %v", err)
+	}
+
+	// nas port and circuit ids are not shared with an ont on another chassis either
+	other := newPort("keys_clli2")
+	err = other.PreProvisionOnt(1, 10, 20, "nasPort2", "circuit3", "tech", "speed")
+	if e, ok := err.(*physical.OntIDInUseError); !ok || e.Field != "NasPortID" || e.CLLI != "keys_clli1" {
+		t.Fatalf("Expected OntIDInUseError reusing a nas port id on another chassis got %v", err)
+	}
+	err = other.ActivateOnt(ctx, 1, 10, 20, "SERIAL3", "nasPort3", "circuit2")
+	if e, ok := err.(*physical.OntIDInUseError); !ok || e.Field != "CircuitID" {
+		t.Fatalf("Expected OntIDInUseError reusing a circuit id on another chassis got %v", err)
+	}
+	if clli, _, ont, ok := physical.FindOnt(physical.ByCircuitID, "circuit2"); !ok || clli != "keys_clli1" || ont.Number != 2 {
+		t.Fatal("A refused ont replaced the one the circuit id belongs to in the index")
+	}
+}
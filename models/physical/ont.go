@@ -16,6 +16,8 @@
 
 package physical
 
+import "time"
+
 /*
 Ont represents a single ont/onu connect to a splitter on a Port
 */
@@ -25,9 +27,20 @@ type Ont struct {
 	Cvlan        uint32   `,json:",omitempty"`
 	SerialNumber string   `,json:",omitempty"`
 	Parent       *PONPort `json:"-" bson:"-"`
-	Active       bool     `json:",omitempty"`
 	NasPortID    string   `json:",omitempty"`
 	CircuitID    string   `json:",omitempty"`
 	TechProfile  string   `json:",omitempty"`
 	SpeedProfile string   `json:",omitempty"`
+	State        OntState `json:",omitempty"`
+	StateChanged time.Time
+	// serial numbers of the hardware this ont replaced, oldest first
+	PreviousSerials []PreviousSerial `json:",omitempty"`
+}
+
+/*
+PreviousSerial - a serial number an ont had before its hardware was swapped by ReplaceOntSerial
+*/
+type PreviousSerial struct {
+	SerialNumber string
+	Replaced     time.Time
 }
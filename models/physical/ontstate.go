@@ -0,0 +1,191 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package physical
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+OntState - where an ont is in its lifecycle
+*/
+type OntState int
+
+const (
+	OntEmpty OntState = iota
+	OntPreProvisioned
+	OntActivating
+	OntActive
+	OntSuspended
+	OntDeleting
+	OntFailed
+)
+
+var ontStateNames = []string{"empty", "preProvisioned", "activating", "active", "suspended", "deleting", "failed"}
+
+// the states an ont may move to from each state, an activation that XOS rejects leaves the ont failed until it
+// is activated again, reflowed or deleted, a deleted ont keeps what was provisioned on it so it can be activated again.
+// An ont XOS fails to remove is left failed as well
+var ontTransitions = map[OntState][]OntState{
+	OntEmpty:          {OntPreProvisioned, OntActivating},
+	OntPreProvisioned: {OntPreProvisioned, OntActivating},
+	OntActivating:     {OntActive, OntFailed},
+	OntActive:         {OntSuspended, OntDeleting},
+	OntSuspended:      {OntActive, OntDeleting},
+	OntFailed:         {OntActivating, OntActive, OntDeleting},
+	OntDeleting:       {OntPreProvisioned, OntEmpty, OntFailed},
+}
+
+func (state OntState) String() string {
+	if state < OntEmpty || int(state) >= len(ontStateNames) {
+		return fmt.Sprintf("OntState(%d)", int(state))
+	}
+	return ontStateNames[state]
+}
+
+/*
+MarshalText - states are written to backups and inventory by name
+*/
+func (state OntState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+/*
+UnmarshalText - the inverse of MarshalText
+*/
+func (state *OntState) UnmarshalText(text []byte) error {
+	for i, name := range ontStateNames {
+		if name == string(text) {
+			*state = OntState(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown ont state %s", text)
+}
+
+func (state OntState) canMoveTo(next OntState) bool {
+	for _, allowed := range ontTransitions[state] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Provisioned - true once the ont has been activated until it is deleted, whether or not it is in service
+*/
+func (ont *Ont) Provisioned() bool {
+	return ont.State == OntActive || ont.State == OntSuspended || ont.State == OntFailed
+}
+
+// an active or suspended ont has to be deleted before it can be provisioned again
+func (ont *Ont) inService() bool {
+	return ont.State == OntActive || ont.State == OntSuspended
+}
+
+func (ont *Ont) setState(state OntState) {
+	ont.State = state
+	ont.StateChanged = time.Now()
+}
+
+/*
+UnmarshalJSON - loads backups written before onts had a State, which only had an Active flag and told pre-provisioned
+onts apart by their CircuitID
+*/
+func (ont *Ont) UnmarshalJSON(data []byte) error {
+	type plain Ont
+	legacy := struct {
+		*plain
+		Active    bool
+		Suspended bool
+	}{plain: (*plain)(ont)}
+	err := json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+	if ont.State == OntEmpty {
+		switch {
+		case legacy.Suspended:
+			ont.State = OntSuspended
+		case legacy.Active:
+			ont.State = OntActive
+		case ont.CircuitID != "":
+			ont.State = OntPreProvisioned
+		}
+	}
+	return nil
+}
+
+/*
+OntStateError - thrown when an operation would move an ont to a state its lifecycle does not allow from where it is
+*/
+type OntStateError struct {
+	operation  string
+	State      OntState
+	slotNum    int
+	clli       string
+	ponportNum int
+	ontNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *OntStateError) Error() string {
+	return fmt.Sprintf("Attempt to %s ONT %d on PONPort %d Slot %d on %s but it is %s", e.operation, e.ontNumber, e.ponportNum, e.slotNum, e.clli, e.State)
+}
+
+/*
+checkTransition - makes sure ont number may move to state
+*/
+func (port *PONPort) checkTransition(number int, state OntState, operation string) error {
+	ont := &port.Onts[number-1]
+	if ont.State.canMoveTo(state) {
+		return nil
+	}
+	slot := port.Parent
+	return &OntStateError{operation: operation, State: ont.State, ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: slot.Parent.CLLI}
+}
+
+/*
+activated - moves ont number out of activating once XOS has been told about it, err is what XOS answered
+*/
+func (port *PONPort) activated(number int, err error) {
+	if err != nil {
+		if xosErr, ok := err.(*XOSError); ok {
+			xosErr.activationFailed = true
+		}
+		port.Onts[number-1].setState(OntFailed)
+		return
+	}
+	port.Onts[number-1].setState(OntActive)
+}
+
+/*
+MarkActive - records that the failed ont number has now been pushed to XOS
+*/
+func (port *PONPort) MarkActive(number int) error {
+	err := port.checkTransition(number, OntActive, "Activate")
+	if err != nil {
+		return err
+	}
+	port.Onts[number-1].setState(OntActive)
+	return nil
+}
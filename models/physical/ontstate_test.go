@@ -0,0 +1,140 @@
+/*
+Copyright 2017 the original author or authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package physical_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func TestOnt_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "state_clli"}
+	olt := &physical.SimpleOLT{CLLI: "state_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+
+	port.PreProvisionOnt(1, 10, 20, "nasPort1", "circuit1", "", "")
+	ont := &port.Onts[0]
+	if ont.State != physical.OntPreProvisioned || ont.StateChanged.IsZero() {
+		t.Fatalf("Expected a timestamped preProvisioned ont got %v", ont.State)
+	}
+	changed := ont.StateChanged
+	port.ActivateSerial(ctx, 1, "SERIAL1")
+	if ont.State != physical.OntActive || ont.StateChanged.Before(changed) {
+		t.Fatalf("Expected a timestamped active ont got %v", ont.State)
+	}
+	if _, ok := port.PreProvisionOnt(1, 10, 20, "", "", "", "").(*physical.AllReadyActiveError); !ok {
+		t.Fatal("Expected AllReadyActiveError pre-provisioning an active ont")
+	}
+	port.DeleteOnt(ctx, 1, 10, 20, "SERIAL1")
+	if ont.State != physical.OntPreProvisioned || ont.CircuitID != "circuit1" {
+		t.Fatalf("Expected a deleted ont to keep what was pre-provisioned got %v %s", ont.State, ont.CircuitID)
+	}
+	if _, ok := port.ResumeOnt(ctx, 1).(*physical.OntNotSuspendedError); !ok {
+		t.Fatal("Expected OntNotSuspendedError resuming a deleted ont")
+	}
+
+	// a failed activation can be retried but not suspended
+	ont.State = physical.OntFailed
+	err := port.SuspendOnt(ctx, 1)
+	if stateErr, ok := err.(*physical.OntStateError); !ok || stateErr.State != physical.OntFailed {
+		t.Fatalf("Expected OntStateError suspending a failed ont got %v", err)
+	}
+	if err = port.ActivateSerial(ctx, 1, "SERIAL1"); err != nil || ont.State != physical.OntActive {
+		t.Fatalf("Retrying a failed activation returned %v leaving the ont %v", err, ont.State)
+	}
+
+	// a torn down ont goes through deleting and keeps what was provisioned on it like a deleted one
+	port.SuspendOnt(ctx, 1)
+	removed, err := chassis.Teardown(ctx)
+	if err != nil || len(removed) != 1 || removed[0].State != physical.OntSuspended || ont.State != physical.OntPreProvisioned {
+		t.Fatalf("Teardown returned %v %v leaving the ont %v", removed, err, ont.State)
+	}
+	port.ActivateSerial(ctx, 1, "SERIAL1")
+
+	backup, _ := json.Marshal(ont)
+	if !strings.Contains(string(backup), `"State":"active"`) {
+		t.Fatalf("Expected the state by name in the backup %s", backup)
+	}
+	restored := physical.Ont{}
+	json.Unmarshal(backup, &restored)
+	if restored.State != physical.OntActive || !restored.StateChanged.Equal(ont.StateChanged) {
+		t.Fatalf("State did not survive a backup %v %v", restored.State, restored.StateChanged)
+	}
+}
+
+func TestOnt_UnmarshalLegacy(t *testing.T) {
+	legacy := map[string]physical.OntState{
+		`{"Number":1,"SerialNumber":"SERIAL1","Active":true,"CircuitID":"circuit1"}`: physical.OntActive,
+		`{"Number":2,"CircuitID":"circuit2"}`:                                        physical.OntPreProvisioned,
+		`{"Number":3,"Active":true,"Suspended":true,"CircuitID":"circuit3"}`:         physical.OntSuspended,
+		`{"Number":0}`: physical.OntEmpty,
+	}
+	for backup, expected := range legacy {
+		ont := physical.Ont{}
+		err := json.Unmarshal([]byte(backup), &ont)
+		if err != nil || ont.State != expected {
+			t.Errorf("Expected %s to load as %v got %v %v", backup, expected, ont.State, err)
+		}
+	}
+}
+
+func TestXOSError_Retryable(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	// nothing listens on the discard port so every push to XOS fails straight away
+	chassis := &physical.Chassis{CLLI: "retry_clli", XOSAddress: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9}}
+	olt := &physical.SimpleOLT{CLLI: "retry_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+	port.ActivateOnt(ctx, 1, 10, 20, "SERIAL1", "nasPort1", "circuit1")
+
+	settings.SetDummy(false)
+	settings.SetGrpc(false)
+	defer settings.SetGrpc(true)
+	defer settings.SetDummy(true)
+	xosErr, ok := port.SuspendOnt(ctx, 1).(*physical.XOSError)
+	if !ok || !xosErr.Retryable() {
+		t.Fatalf("Expected a rolled back suspend to be retryable got %v", xosErr)
+	}
+	xosErr, ok = port.DeleteOnt(ctx, 1, 10, 20, "SERIAL1").(*physical.XOSError)
+	if !ok || xosErr.Retryable() || port.Onts[0].State != physical.OntFailed {
+		t.Fatalf("Expected a delete XOS failed on not to be retryable got %v leaving the ont %v", xosErr, port.Onts[0].State)
+	}
+	// XOS still whitelists the ont so it stays failed until a delete gets through
+	settings.SetDummy(true)
+	err := port.DeleteOnt(ctx, 1, 10, 20, "SERIAL1")
+	if err != nil || port.Onts[0].State != physical.OntPreProvisioned {
+		t.Fatalf("Expected the delete to be tried again got %v leaving the ont %v", err, port.Onts[0].State)
+	}
+	settings.SetDummy(false)
+	xosErr, ok = port.ActivateSerial(ctx, 1, "SERIAL1").(*physical.XOSError)
+	if !ok || !xosErr.Retryable() || port.Onts[0].State != physical.OntFailed {
+		t.Fatalf("Expected a failed activation to be retryable got %v leaving the ont %v", xosErr, port.Onts[0].State)
+	}
+}
@@ -17,17 +17,22 @@
 package physical
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"time"
 )
 
 /*
 PONPort represents a single PON port on the OLT chassis
 */
 type PONPort struct {
-	Number   int
-	DeviceID string
-	Onts     [64]Ont
-	Parent   *SimpleOLT `json:"-" bson:"-"`
+	Number       int
+	DeviceID     string
+	Onts         [64]Ont
+	Parent       *SimpleOLT `json:"-" bson:"-"`
+	AbstractSlot int        `json:",omitempty"`
+	AbstractPort int        `json:",omitempty"`
 }
 
 /*
@@ -64,6 +69,98 @@ func (e *AllReadyDeactivatedError) Error() string {
 	return fmt.Sprintf("Attempt to De-Activate ONT %d on PONPort %d Slot %d on %s but not active", e.ontNumber, e.ponportNum, e.slotNum, e.clli)
 }
 
+/*
+OntNotActiveError - thrown when an attempt is made to modify or move an ont that is not active
+*/
+type OntNotActiveError struct {
+	operation  string
+	slotNum    int
+	clli       string
+	ponportNum int
+	ontNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *OntNotActiveError) Error() string {
+	return fmt.Sprintf("Attempt to %s ONT %d on PONPort %d Slot %d on %s but not active", e.operation, e.ontNumber, e.ponportNum, e.slotNum, e.clli)
+}
+
+/*
+VlanInUseError - thrown when an s-tag/c-tag pair is already used by another ont on the chassis
+*/
+type VlanInUseError struct {
+	CLLI       string
+	Svlan      uint32
+	Cvlan      uint32
+	Hostname   string
+	PortNumber int
+	OntNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *VlanInUseError) Error() string {
+	return fmt.Sprintf("STag %d CTag %d on %s is already used by ONT %d on PONPort %d of %s", e.Svlan, e.Cvlan, e.CLLI, e.OntNumber, e.PortNumber, e.Hostname)
+}
+
+/*
+AllReadySuspendedError - thrown when an attempt is made to suspend an ont that is already suspended
+*/
+type AllReadySuspendedError struct {
+	slotNum    int
+	clli       string
+	ponportNum int
+	ontNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *AllReadySuspendedError) Error() string {
+	return fmt.Sprintf("Attempt to Suspend ONT %d on PONPort %d Slot %d on %s but already suspended", e.ontNumber, e.ponportNum, e.slotNum, e.clli)
+}
+
+/*
+OntNotSuspendedError - thrown when an attempt is made to resume an ont that is not suspended
+*/
+type OntNotSuspendedError struct {
+	slotNum    int
+	clli       string
+	ponportNum int
+	ontNumber  int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *OntNotSuspendedError) Error() string {
+	return fmt.Sprintf("Attempt to Resume ONT %d on PONPort %d Slot %d on %s but not suspended", e.ontNumber, e.ponportNum, e.slotNum, e.clli)
+}
+
+/*
+SerialInUseError - thrown when an ont is given a serial number another ont already has
+*/
+type SerialInUseError struct {
+	SerialNumber string
+	CLLI         string
+	Hostname     string
+	PortNumber   int
+	OntNumber    int
+}
+
+/*
+Error - the interface method that must be implemented on error
+*/
+func (e *SerialInUseError) Error() string {
+	if e.Hostname == "" {
+		return fmt.Sprintf("Serial number %s is already used by an ONT on %s", e.SerialNumber, e.CLLI)
+	}
+	return fmt.Sprintf("Serial number %s is already used by ONT %d on PONPort %d of %s on %s", e.SerialNumber, e.OntNumber, e.PortNumber, e.Hostname, e.CLLI)
+}
+
 /*
 PreProvisionOnt - passes ont information to chassis to make call to NEM to activate (whitelist) ont
 */
@@ -72,11 +169,22 @@ func (port *PONPort) PreProvisionOnt(number int, sVlan uint32, cVlan uint32, nas
 	slot := port.Parent
 	chassis := slot.Parent
 
-	if port.Onts[number-1].Active {
+	if port.Onts[number-1].inService() {
 		e := AllReadyActiveError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
 		return &e
 	}
+	err := port.checkTransition(number, OntPreProvisioned, "Pre-Provision")
+	if err != nil {
+		return err
+	}
+	err = port.checkKeys(Ont{NasPortID: nasPortID, CircuitID: circuitID}, &port.Onts[number-1])
+	if err != nil {
+		return err
+	}
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
 	ont := &port.Onts[number-1]
+	ont.setState(OntPreProvisioned)
 	ont.Number = number
 	ont.Svlan = sVlan
 	ont.Cvlan = cVlan
@@ -92,57 +200,318 @@ func (port *PONPort) PreProvisionOnt(number int, sVlan uint32, cVlan uint32, nas
 /*
 ActivateSerial - passes ont information to chassis to make call to NEM to activate (whitelist) ont assumes pre provisioned ont
 */
-func (port *PONPort) ActivateSerial(number int, serialNumber string) error {
+func (port *PONPort) ActivateSerial(ctx context.Context, number int, serialNumber string) error {
 	slot := port.Parent
 	chassis := slot.Parent
 
-	if port.Onts[number-1].Active {
+	if port.Onts[number-1].inService() {
 		e := AllReadyActiveError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
 		return &e
 	}
+	err := port.checkTransition(number, OntActivating, "Activate")
+	if err != nil {
+		return err
+	}
 	ont := &port.Onts[number-1]
+	activated := *ont
+	activated.SerialNumber = serialNumber
+	err = port.checkKeys(activated, ont)
+	if err != nil {
+		return err
+	}
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
+	ont.setState(OntActivating)
 	ont.SerialNumber = serialNumber
 	fmt.Println(ont)
-	port.Parent.Parent.provisionONT(*ont)
-	port.Onts[number-1].Active = true
-	return nil
+	err = port.Parent.Parent.provisionONT(ctx, *ont)
+	port.activated(number, err)
+	return err
 
 }
 
 /*
 ActivateOnt - passes ont information to chassis to make call to NEM to activate (whitelist) ont
 */
-func (port *PONPort) ActivateOnt(number int, sVlan uint32, cVlan uint32, serialNumber string, nasPortID string, circuitID string) error {
+func (port *PONPort) ActivateOnt(ctx context.Context, number int, sVlan uint32, cVlan uint32, serialNumber string, nasPortID string, circuitID string) error {
 	slot := port.Parent
 	chassis := slot.Parent
 
-	if port.Onts[number-1].Active {
+	if port.Onts[number-1].inService() {
 		e := AllReadyActiveError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
 		return &e
 	}
+	err := port.checkTransition(number, OntActivating, "Activate")
+	if err != nil {
+		return err
+	}
 	ont := Ont{Number: number, Svlan: sVlan, Cvlan: cVlan, SerialNumber: serialNumber, Parent: port, NasPortID: nasPortID, CircuitID: circuitID}
+	err = port.checkKeys(ont, &port.Onts[number-1])
+	if err != nil {
+		return err
+	}
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
+	ont.setState(OntActivating)
 	port.Onts[number-1] = ont
-	port.Parent.Parent.provisionONT(ont)
-	port.Onts[number-1].Active = true
-	return nil
+	err = port.Parent.Parent.provisionONT(ctx, ont)
+	port.activated(number, err)
+	return err
 
 }
 
 /*
-DeleteOnt - passes ont information to chassis to make call to NEM to de-activate (de-whitelist) ont
+DeleteOnt - passes ont information to chassis to make call to NEM to de-activate (de-whitelist) ont, the ont keeps
+what was provisioned on it. When XOS fails to remove it the ont is left failed so the delete can be tried again
 */
-func (port *PONPort) DeleteOnt(number int, sVlan uint32, cVlan uint32, serialNumber string) error {
+func (port *PONPort) DeleteOnt(ctx context.Context, number int, sVlan uint32, cVlan uint32, serialNumber string) error {
 
 	fmt.Printf("DeleteOnt(number %d, sVlan %d, cVlan %d, serialNumber %s)\n", number, sVlan, cVlan, serialNumber)
 	slot := port.Parent
 	chassis := slot.Parent
-	if port.Onts[number-1].Active != true {
+	if !port.Onts[number-1].Provisioned() {
 		e := AllReadyDeactivatedError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
 		return &e
 	}
-	ont := Ont{Number: number, Svlan: sVlan, Cvlan: cVlan, SerialNumber: serialNumber, Parent: port}
-	chassis.deleteONT(ont)
-	port.Onts[number-1].Active = false
+	ont := Ont{Number: number, Svlan: sVlan, Cvlan: cVlan, SerialNumber: serialNumber, Parent: port, State: port.Onts[number-1].State}
+	// reindexed once it is deleted since it gives up its serial number
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
+	port.Onts[number-1].setState(OntDeleting)
+	err := chassis.deleteONT(ctx, ont)
+	if err != nil {
+		port.Onts[number-1].setState(OntFailed)
+		return err
+	}
+	port.Onts[number-1].setState(OntPreProvisioned)
+	return nil
+}
+
+/*
+ModifyOnt - changes the vlans, NasPortID, CircuitID or profiles of an active ont pushing the change to XOS,
+zero values are left unchanged, returns the names of the fields that changed. The ont is left as it was when XOS
+rejects the change
+*/
+func (port *PONPort) ModifyOnt(ctx context.Context, number int, sVlan uint32, cVlan uint32, nasPortID string, circuitID string, techProfile string, speedProfile string) ([]string, error) {
+	slot := port.Parent
+	chassis := slot.Parent
+	ont := &port.Onts[number-1]
+	if !ont.Provisioned() {
+		e := OntNotActiveError{operation: "Modify", ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
+		return nil, &e
+	}
+	modified := *ont
+	changed := []string{}
+	if sVlan != 0 && sVlan != ont.Svlan {
+		modified.Svlan = sVlan
+		changed = append(changed, "STag")
+	}
+	if cVlan != 0 && cVlan != ont.Cvlan {
+		modified.Cvlan = cVlan
+		changed = append(changed, "CTag")
+	}
+	if nasPortID != "" && nasPortID != ont.NasPortID {
+		modified.NasPortID = nasPortID
+		changed = append(changed, "NasPortID")
+	}
+	if circuitID != "" && circuitID != ont.CircuitID {
+		modified.CircuitID = circuitID
+		changed = append(changed, "CircuitID")
+	}
+	if techProfile != "" && techProfile != ont.TechProfile {
+		modified.TechProfile = techProfile
+		changed = append(changed, "TechProfile")
+	}
+	if speedProfile != "" && speedProfile != ont.SpeedProfile {
+		modified.SpeedProfile = speedProfile
+		changed = append(changed, "SpeedProfile")
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	if modified.Svlan != ont.Svlan || modified.Cvlan != ont.Cvlan {
+		err := chassis.checkVlans(ont, modified.Svlan, modified.Cvlan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := port.checkKeys(modified, ont)
+	if err != nil {
+		return nil, err
+	}
+	// profiles are not part of the subscriber in XOS so only a change to what is needs pushing, it is pushed before
+	// the ont is changed so nothing XOS rejected is kept
+	for _, field := range changed {
+		if field != "TechProfile" && field != "SpeedProfile" {
+			err := chassis.modifyONT(ctx, modified)
+			if err != nil {
+				err.(*XOSError).RolledBack = true
+				return changed, err
+			}
+			break
+		}
+	}
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
+	*ont = modified
+	return changed, nil
+}
 
+/*
+SuspendOnt - cuts service to the active ont number by taking it off the XOS whitelist, its subscriber and everything
+provisioned on it are kept so ResumeOnt can restore service
+*/
+func (port *PONPort) SuspendOnt(ctx context.Context, number int) error {
+	slot := port.Parent
+	chassis := slot.Parent
+	ont := &port.Onts[number-1]
+	if !ont.Provisioned() {
+		e := OntNotActiveError{operation: "Suspend", ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
+		return &e
+	}
+	if ont.State == OntSuspended {
+		e := AllReadySuspendedError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
+		return &e
+	}
+	err := port.checkTransition(number, OntSuspended, "Suspend")
+	if err != nil {
+		return err
+	}
+	err = chassis.deleteONT(ctx, *ont)
+	if err != nil {
+		err.(*XOSError).RolledBack = true
+		return err
+	}
+	ont.setState(OntSuspended)
 	return nil
 }
+
+/*
+ResumeOnt - restores service to the suspended ont number by putting it back on the XOS whitelist
+*/
+func (port *PONPort) ResumeOnt(ctx context.Context, number int) error {
+	slot := port.Parent
+	chassis := slot.Parent
+	ont := &port.Onts[number-1]
+	if ont.State != OntSuspended {
+		e := OntNotSuspendedError{ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
+		return &e
+	}
+	resumed := *ont
+	resumed.State = OntActive
+	err := chassis.whitelistONT(ctx, resumed)
+	if err != nil {
+		err.(*XOSError).RolledBack = true
+		return err
+	}
+	ont.setState(OntActive)
+	return nil
+}
+
+/*
+ReplaceOntSerial - gives the active ont number the serial number of the hardware it was swapped for keeping its vlans,
+NasPortID and CircuitID, the old serial number is returned and kept in PreviousSerials
+*/
+func (port *PONPort) ReplaceOntSerial(ctx context.Context, number int, serialNumber string) (string, error) {
+	slot := port.Parent
+	chassis := slot.Parent
+	ont := &port.Onts[number-1]
+	if !ont.Provisioned() {
+		e := OntNotActiveError{operation: "Replace serial of", ontNumber: number, slotNum: slot.Number, ponportNum: port.Number, clli: chassis.CLLI}
+		return "", &e
+	}
+	if serialNumber == ont.SerialNumber {
+		return ont.SerialNumber, nil
+	}
+	replaced := *ont
+	replaced.SerialNumber = serialNumber
+	err := port.checkKeys(replaced, ont)
+	if err != nil {
+		return "", err
+	}
+	old := *ont
+	err = chassis.deleteONT(ctx, old)
+	if err != nil {
+		err.(*XOSError).RolledBack = true
+		return "", err
+	}
+	port.unindexOnt(number)
+	defer port.indexOnt(number)
+	ont.SerialNumber = serialNumber
+	ont.PreviousSerials = append(ont.PreviousSerials, PreviousSerial{SerialNumber: old.SerialNumber, Replaced: time.Now()})
+	return old.SerialNumber, chassis.replaceONT(ctx, old.SerialNumber, *ont)
+}
+
+/*
+MoveOnt - moves the active ont number on from to toNumber on to, which may be on another olt or chassis, giving it
+the sVlan, cVlan, nasPortID and circuitID passed in. The ont is removed from XOS on its old port and provisioned on the
+new one, if XOS fails the old port is provisioned again and the ont is left where it was, failed when XOS does not
+take it back either
+*/
+func MoveOnt(ctx context.Context, from *PONPort, number int, to *PONPort, toNumber int, sVlan uint32, cVlan uint32, nasPortID string, circuitID string) (Ont, error) {
+	fromChassis := from.Parent.Parent
+	toChassis := to.Parent.Parent
+	source := &from.Onts[number-1]
+	if !source.Provisioned() {
+		e := OntNotActiveError{operation: "Move", ontNumber: number, slotNum: from.Parent.Number, ponportNum: from.Number, clli: fromChassis.CLLI}
+		return Ont{}, &e
+	}
+	destination := &to.Onts[toNumber-1]
+	if destination.Provisioned() {
+		e := AllReadyActiveError{ontNumber: toNumber, slotNum: to.Parent.Number, ponportNum: to.Number, clli: toChassis.CLLI}
+		return Ont{}, &e
+	}
+	err := toChassis.checkVlans(source, sVlan, cVlan, destination)
+	if err != nil {
+		return Ont{}, err
+	}
+	err = from.checkTransition(number, OntDeleting, "Move")
+	if err != nil {
+		return Ont{}, err
+	}
+	// XOS is sent the ont as it was, it is only put back when XOS takes it back on its old port
+	previous := *source
+	moved := previous
+	moved.Number = toNumber
+	moved.Parent = to
+	moved.Svlan = sVlan
+	moved.Cvlan = cVlan
+	moved.NasPortID = nasPortID
+	moved.CircuitID = circuitID
+	err = to.checkKeys(moved, source, destination)
+	if err != nil {
+		return Ont{}, err
+	}
+
+	source.setState(OntDeleting)
+	err = fromChassis.deleteONT(ctx, previous)
+	if err != nil {
+		*source = previous
+		err.(*XOSError).RolledBack = true
+		return Ont{}, err
+	}
+	err = fromChassis.deleteSubscriber(ctx, previous)
+	if err == nil {
+		err = toChassis.provisionONT(ctx, moved)
+	}
+	if err != nil {
+		log.Printf("Moving ont %s failed putting it back on its old port\n", previous.SerialNumber)
+		rollbackErr := fromChassis.provisionONT(ctx, previous)
+		if rollbackErr != nil {
+			// XOS has the ont on neither port, it stays failed on its old one until it is activated again or reflowed
+			source.setState(OntFailed)
+			return Ont{}, fromChassis.collectXOSErrors("move ont "+previous.SerialNumber, []error{err, rollbackErr})
+		}
+		*source = previous
+		err.(*XOSError).RolledBack = true
+		return Ont{}, err
+	}
+
+	from.unindexOnt(number)
+	to.unindexOnt(toNumber)
+	*destination = moved
+	*source = Ont{}
+	source.setState(OntEmpty)
+	to.indexOnt(toNumber)
+	return moved, nil
+}
@@ -0,0 +1,257 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package physical_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func TestPONPort_ModifyOnt(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "modify_clli"}
+	olt := &physical.SimpleOLT{CLLI: "modify_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+
+	_, err := port.ModifyOnt(ctx, 1, 10, 20, "", "", "", "")
+	if _, ok := err.(*physical.OntNotActiveError); !ok {
+		t.Fatalf("Expected OntNotActiveError modifying an inactive ont got %v", err)
+	}
+	port.ActivateOnt(ctx, 1, 10, 20, "SERIAL1", "nasPort1", "circuit1")
+	port.ActivateOnt(ctx, 2, 11, 21, "SERIAL2", "nasPort2", "circuit2")
+
+	_, err = port.ModifyOnt(ctx, 1, 11, 21, "", "", "", "")
+	if _, ok := err.(*physical.VlanInUseError); !ok {
+		t.Fatalf("Expected VlanInUseError reusing the vlans of ont 2 got %v", err)
+	}
+	if port.Onts[0].Svlan != 10 || port.Onts[0].Cvlan != 20 {
+		t.Fatal("Rejected ModifyOnt changed the vlans")
+	}
+
+	recorder := &physical.Recorder{}
+	chassis.Recorder = recorder
+	settings.SetGrpc(false)
+	changed, err := port.ModifyOnt(ctx, 1, 10, 22, "", "circuit3", "tech", "")
+	chassis.Recorder = nil
+	if err != nil {
+		t.Fatalf("ModifyOnt failed with %v", err)
+	}
+	if strings.Join(changed, ",") != "CTag,CircuitID,TechProfile" {
+		t.Fatalf("Unexpected changed fields %v", changed)
+	}
+	ont := port.Onts[0]
+	if ont.Cvlan != 22 || ont.CircuitID != "circuit3" || ont.TechProfile != "tech" || ont.NasPortID != "nasPort1" {
+		t.Fatalf("ModifyOnt did not update the ont %v", ont)
+	}
+	if len(recorder.Messages) != 1 || !strings.Contains(recorder.Messages[0].Body, "circuit3") {
+		t.Fatalf("Expected the subscriber to be pushed again got %v", recorder.Messages)
+	}
+
+	port.ModifyOnt(ctx, 1, 0, 0, "nasPort3", "", "", "")
+	if _, _, found, ok := physical.FindOnt(physical.ByNasPortID, "nasPort3"); !ok || found.Number != 1 {
+		t.Fatal("FindOnt does not find the ont by its new NasPortID")
+	}
+	if _, _, _, ok := physical.FindOnt(physical.ByNasPortID, "nasPort1"); ok {
+		t.Fatal("FindOnt still finds the ont by its old NasPortID")
+	}
+
+	changed, err = port.ModifyOnt(ctx, 1, 10, 22, "nasPort3", "", "", "")
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("Expected no change got %v %v", changed, err)
+	}
+
+	// nothing listens on the XOS address so the change is rejected and the ont left as it was
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port %v", err)
+	}
+	chassis.XOSAddress = *listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	settings.SetDummy(false)
+	_, err = port.ModifyOnt(ctx, 1, 0, 23, "nasPort4", "", "", "")
+	settings.SetDummy(true)
+	if xosErr, ok := err.(*physical.XOSError); !ok || !xosErr.RolledBack {
+		t.Fatalf("Expected a rolled back XOSError when XOS rejects the change got %v", err)
+	}
+	if port.Onts[0].Cvlan != 22 || port.Onts[0].NasPortID != "nasPort3" {
+		t.Fatalf("ModifyOnt kept a change XOS rejected %v", port.Onts[0])
+	}
+	if _, _, found, ok := physical.FindOnt(physical.ByNasPortID, "nasPort3"); !ok || found.Number != 1 {
+		t.Fatal("FindOnt does not find the ont by the NasPortID it kept")
+	}
+}
+
+func TestPONPort_ReplaceOntSerial(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "replace_clli"}
+	olt := &physical.SimpleOLT{CLLI: "replace_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+
+	_, err := port.ReplaceOntSerial(ctx, 1, "NEW1")
+	if _, ok := err.(*physical.OntNotActiveError); !ok {
+		t.Fatalf("Expected OntNotActiveError replacing the serial of an inactive ont got %v", err)
+	}
+	port.ActivateOnt(ctx, 1, 10, 20, "OLD1", "nasPort1", "circuit1")
+	port.ActivateOnt(ctx, 2, 11, 21, "OLD2", "nasPort2", "circuit2")
+
+	_, err = port.ReplaceOntSerial(ctx, 1, "OLD2")
+	if _, ok := err.(*physical.SerialInUseError); !ok {
+		t.Fatalf("Expected SerialInUseError reusing the serial of ont 2 got %v", err)
+	}
+
+	recorder := &physical.Recorder{}
+	chassis.Recorder = recorder
+	settings.SetGrpc(false)
+	previous, err := port.ReplaceOntSerial(ctx, 1, "NEW1")
+	chassis.Recorder = nil
+	if err != nil || previous != "OLD1" {
+		t.Fatalf("ReplaceOntSerial returned %s %v", previous, err)
+	}
+	ont := port.Onts[0]
+	if ont.SerialNumber != "NEW1" || ont.Svlan != 10 || ont.Cvlan != 20 || ont.CircuitID != "circuit1" {
+		t.Fatalf("ReplaceOntSerial did not keep the identity of the ont %v", ont)
+	}
+	if len(ont.PreviousSerials) != 1 || ont.PreviousSerials[0].SerialNumber != "OLD1" {
+		t.Fatalf("Expected OLD1 in the serial history got %v", ont.PreviousSerials)
+	}
+	// the old whitelist entry is deleted in two posts, then the new one and the subscriber are pushed
+	if len(recorder.Messages) != 4 || !strings.Contains(recorder.Messages[3].Body, "NEW1") {
+		t.Fatalf("Unexpected southbound messages %v", recorder.Messages)
+	}
+}
+
+func TestPONPort_SuspendOnt(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "suspend_clli"}
+	olt := &physical.SimpleOLT{CLLI: "suspend_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+
+	err := port.SuspendOnt(ctx, 1)
+	if _, ok := err.(*physical.OntNotActiveError); !ok {
+		t.Fatalf("Expected OntNotActiveError suspending an inactive ont got %v", err)
+	}
+	port.ActivateOnt(ctx, 1, 10, 20, "SERIAL1", "nasPort1", "circuit1")
+	err = port.ResumeOnt(ctx, 1)
+	if _, ok := err.(*physical.OntNotSuspendedError); !ok {
+		t.Fatalf("Expected OntNotSuspendedError resuming an ont in service got %v", err)
+	}
+
+	recorder := &physical.Recorder{}
+	chassis.Recorder = recorder
+	settings.SetGrpc(false)
+	err = port.SuspendOnt(ctx, 1)
+	if err != nil {
+		t.Fatalf("SuspendOnt failed with %v", err)
+	}
+	ont := port.Onts[0]
+	if ont.State != physical.OntSuspended || ont.Svlan != 10 || ont.Cvlan != 20 || ont.CircuitID != "circuit1" {
+		t.Fatalf("SuspendOnt did not keep the ont provisioned %v", ont)
+	}
+	for _, message := range recorder.Messages {
+		if message.Operation != "POST /delete" || strings.Contains(message.Body, "RCORDSubscriber") {
+			t.Fatalf("Suspending should only remove the whitelist entry %v", message)
+		}
+	}
+	if _, ok := port.SuspendOnt(ctx, 1).(*physical.AllReadySuspendedError); !ok {
+		t.Fatal("Expected AllReadySuspendedError suspending twice")
+	}
+
+	// a suspended ont is already off the whitelist so deleting it sends nothing
+	recorder.Messages = nil
+	port.ModifyOnt(ctx, 1, 0, 0, "", "circuit2", "", "")
+	port.ReplaceOntSerial(ctx, 1, "SERIAL2")
+	for _, message := range recorder.Messages {
+		if strings.Contains(message.Body, "AttWorkflowDriverWhiteListEntry") {
+			t.Fatalf("Changing a suspended ont put it back on the whitelist %v", message)
+		}
+	}
+
+	recorder.Messages = nil
+	err = port.ResumeOnt(ctx, 1)
+	chassis.Recorder = nil
+	if err != nil || port.Onts[0].State != physical.OntActive {
+		t.Fatalf("ResumeOnt failed with %v", err)
+	}
+	if len(recorder.Messages) != 1 || !strings.Contains(recorder.Messages[0].Body, "SERIAL2") {
+		t.Fatalf("Expected the ont to be whitelisted again got %v", recorder.Messages)
+	}
+}
+
+func TestPONPort_MoveOnt(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(true)
+	physical.ResetIndex()
+	chassis := &physical.Chassis{CLLI: "move_clli"}
+	olt := &physical.SimpleOLT{CLLI: "move_clli", Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	chassis.AddOLTChassis(ctx, *olt)
+	port := &olt.Ports[0]
+	port.ActivateOnt(ctx, 1, 10, 20, "SERIAL1", "nasPort1", "circuit1")
+
+	// XOS takes every delete and drops the connection for the next failRuns provisions
+	failRuns := 0
+	xos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/run" && failRuns > 0 {
+			failRuns--
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer xos.Close()
+	chassis.XOSAddress = *xos.Listener.Addr().(*net.TCPAddr)
+	settings.SetGrpc(false)
+	settings.SetDummy(false)
+	defer settings.SetDummy(true)
+
+	// the whitelist entry and subscriber on the new port fail so the ont is put back on its old one
+	failRuns = 2
+	_, err := physical.MoveOnt(ctx, port, 1, port, 3, 11, 21, "nasPort3", "circuit3")
+	if xosErr, ok := err.(*physical.XOSError); !ok || !xosErr.RolledBack {
+		t.Fatalf("Expected a rolled back XOSError when XOS rejects the new port got %v", err)
+	}
+	if port.Onts[0].State != physical.OntActive || port.Onts[2].State != physical.OntEmpty {
+		t.Fatalf("Rolled back move did not leave the ont where it was %v %v", port.Onts[0], port.Onts[2])
+	}
+
+	// putting it back fails too so XOS has it nowhere
+	failRuns = 4
+	_, err = physical.MoveOnt(ctx, port, 1, port, 3, 11, 21, "nasPort3", "circuit3")
+	if xosErr, ok := err.(*physical.XOSError); !ok || xosErr.RolledBack {
+		t.Fatalf("Expected an XOSError that is not rolled back when the ont can not be put back got %v", err)
+	}
+	if port.Onts[0].State != physical.OntFailed || port.Onts[0].SerialNumber != "SERIAL1" || port.Onts[2].State != physical.OntEmpty {
+		t.Fatalf("Expected the ont to be failed on its old port %v %v", port.Onts[0], port.Onts[2])
+	}
+}
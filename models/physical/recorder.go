@@ -0,0 +1,63 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package physical
+
+import (
+	"log"
+
+	"github.com/golang/protobuf/proto"
+)
+
+/*
+SouthboundMessage - a TOSCA document or XOS gRPC message that would have been sent to XOS
+*/
+type SouthboundMessage struct {
+	Transport string
+	Operation string
+	Body      string
+}
+
+/*
+Recorder - set on a Chassis to make it record its southbound messages instead of sending them to XOS,
+used to dry run a request against a copy of the chassis
+*/
+type Recorder struct {
+	Messages []SouthboundMessage
+}
+
+func (chassis *Chassis) recordTosca(path string, yaml string) bool {
+	if chassis.Recorder == nil {
+		return false
+	}
+	log.Printf("Dry run recording POST %s for %s\n", path, chassis.CLLI)
+	chassis.Recorder.Messages = append(chassis.Recorder.Messages, SouthboundMessage{Transport: "tosca", Operation: "POST " + path, Body: yaml})
+	return true
+}
+
+func (chassis *Chassis) recordGRPC(operation string, message proto.Message) bool {
+	if chassis.Recorder == nil {
+		return false
+	}
+	log.Printf("Dry run recording %s for %s\n", operation, chassis.CLLI)
+	chassis.Recorder.Messages = append(chassis.Recorder.Messages, SouthboundMessage{Transport: "grpc", Operation: operation, Body: proto.MarshalTextString(message)})
+	return true
+}
+
+// onts on a chassis that is being dry run must not end up in the ont index
+func (port *PONPort) dryRun() bool {
+	return port.Parent != nil && port.Parent.Parent != nil && port.Parent.Parent.Recorder != nil
+}
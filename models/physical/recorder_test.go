@@ -0,0 +1,62 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+package physical_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
+	"gerrit.opencord.org/abstract-olt/models/physical"
+)
+
+func TestChassis_Recorder(t *testing.T) {
+	ctx := context.Background()
+	settings.SetDummy(false)
+	defer settings.SetDummy(true)
+	physical.ResetIndex()
+	recorder := &physical.Recorder{}
+	chassis := &physical.Chassis{CLLI: "recorder_clli", Recorder: recorder}
+	olt := &physical.SimpleOLT{CLLI: "recorder_clli", Hostname: "slot1", Driver: "openolt", Address: net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 9191}, Parent: chassis}
+	olt.CreateEdgecore()
+	settings.SetGrpc(false)
+	if err := chassis.AddOLTChassis(ctx, *olt); err != nil {
+		t.Fatalf("AddOLTChassis failed while recording %v", err)
+	}
+	if len(recorder.Messages) != 1 || recorder.Messages[0].Transport != "tosca" || !strings.Contains(recorder.Messages[0].Body, "slot1") {
+		t.Fatalf("Expected one tosca document for slot1 got %v", recorder.Messages)
+	}
+
+	settings.SetGrpc(true)
+	defer settings.SetGrpc(false)
+	port := &olt.Ports[0]
+	port.PreProvisionOnt(1, 10, 20, "nasPort", "circuit", "tech", "speed")
+	if err := port.ActivateSerial(ctx, 1, "SERIAL1"); err != nil {
+		t.Fatalf("ActivateSerial failed while recording %v", err)
+	}
+	operations := []string{}
+	for _, message := range recorder.Messages[1:] {
+		operations = append(operations, message.Operation)
+	}
+	if strings.Join(operations, ",") != "CreateAttWorkflowDriverWhiteListEntry,CreateRCORDSubscriber" {
+		t.Fatalf("Unexpected xos grpc operations recorded %v", operations)
+	}
+	if _, _, _, ok := physical.FindOnt(physical.BySerialNumber, "SERIAL1"); ok {
+		t.Fatal("Ont activated while recording was added to the ont index")
+	}
+}
@@ -18,6 +18,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 
 	"gerrit.opencord.org/abstract-olt/internal/pkg/settings"
@@ -25,25 +26,149 @@ import (
 	"gerrit.opencord.org/abstract-olt/models/physical"
 )
 
-func (chassisHolder ChassisHolder) Serialize() ([]byte, error) {
-	return json.Marshal(chassisHolder.PhysicalChassis)
+/*
+BackupSchemaVersion - the version of the format Serialize writes, whenever the format changes it is raised and a
+migration from the version before is added to migrations
+*/
+const BackupSchemaVersion = 2
+
+/*
+chassisBackup - both sides of a chassis, the abstract onts are not written since they are generated from the rack,
+shelf, slot and port
+*/
+type chassisBackup struct {
+	SchemaVersion int
+	Physical      physical.Chassis
+	Abstract      abstractBackup
+}
+
+type abstractBackup struct {
+	Rack      int
+	Shelf     int
+	AllocInfo abstract.PortAllocationInfo
+	Ports     []portMapping
+}
+
+/*
+portMapping - the PON port PONPort of the linecard at index Linecard of the physical chassis is mapped to the abstract
+Slot and Port. Hostnames need not be unique in older chassis so Hostname is only kept to check the linecard against
+*/
+type portMapping struct {
+	Slot     int
+	Port     int
+	Linecard int
+	Hostname string
+	PONPort  int
+}
+
+// migrations[i] upgrades a backup from schema version i+1 to i+2
+var migrations = []func([]byte) ([]byte, error){
+	migrateFromV1,
+}
+
+/*
+SchemaVersionError - returned when a backup was written by a newer server than this one
+*/
+type SchemaVersionError struct {
+	Version int
+}
 
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("Backup schema version %d is newer than version %d supported by this server", e.Version, BackupSchemaVersion)
 }
 
+/*
+Serialize - writes both sides of the chassis in the BackupSchemaVersion format
+*/
+func (chassisHolder *ChassisHolder) Serialize() ([]byte, error) {
+	abstractChassis := &chassisHolder.AbstractChassis
+	phyChassis := &chassisHolder.PhysicalChassis
+	backup := chassisBackup{
+		SchemaVersion: BackupSchemaVersion,
+		Physical:      *phyChassis,
+		Abstract:      abstractBackup{Rack: abstractChassis.Rack, Shelf: abstractChassis.Shelf, AllocInfo: abstractChassis.AllocInfo, Ports: []portMapping{}},
+	}
+	ponPorts := make(map[*physical.PONPort]portMapping)
+	for i := range phyChassis.Linecards {
+		olt := &phyChassis.Linecards[i]
+		for j := range olt.Ports {
+			ponPorts[&olt.Ports[j]] = portMapping{Linecard: i, Hostname: olt.Hostname, PONPort: olt.Ports[j].Number}
+		}
+	}
+	for i := range abstractChassis.Slots {
+		for j := range abstractChassis.Slots[i].Ports {
+			physPort := abstractChassis.Slots[i].Ports[j].PhysPort
+			if physPort == nil {
+				continue
+			}
+			mapping, ok := ponPorts[physPort]
+			if !ok {
+				return nil, fmt.Errorf("Abstract slot %d port %d of %s is mapped to a PON port that is not on the chassis", i+1, j+1, phyChassis.CLLI)
+			}
+			mapping.Slot = i + 1
+			mapping.Port = j + 1
+			backup.Abstract.Ports = append(backup.Abstract.Ports, mapping)
+		}
+	}
+	return json.Marshal(backup)
+}
+
+/*
+Deserialize - restores a chassis written by Serialize, a backup written in an older format is migrated first
+*/
 func (chassisHolder *ChassisHolder) Deserialize(jsonData []byte) error {
-	physicalChassis := physical.Chassis{}
-	err := json.Unmarshal(jsonData, &physicalChassis)
+	jsonData, _, err := MigrateBackup(jsonData)
 	if err != nil {
 		return err
 	}
-	abstractChassis := abstract.GenerateChassis(physicalChassis.CLLI, 1, 1)
-	chassisHolder.AbstractChassis = abstractChassis
-	chassisHolder.PhysicalChassis = physicalChassis
+	backup := chassisBackup{}
+	err = json.Unmarshal(jsonData, &backup)
+	if err != nil {
+		return err
+	}
+	chassisHolder.PhysicalChassis = backup.Physical
+	chassisHolder.AbstractChassis = abstract.GenerateChassis(backup.Physical.CLLI, backup.Abstract.Rack, backup.Abstract.Shelf)
+	chassisHolder.linkParents()
+	abstractChassis := &chassisHolder.AbstractChassis
+	phyChassis := &chassisHolder.PhysicalChassis
+	for _, mapping := range backup.Abstract.Ports {
+		index := mapping.Linecard
+		if index < 0 || index >= len(phyChassis.Linecards) || phyChassis.Linecards[index].Hostname != mapping.Hostname {
+			return &physical.OLTNotFoundError{CLLI: phyChassis.CLLI, Hostname: mapping.Hostname}
+		}
+		var ponPort *physical.PONPort
+		for j := range phyChassis.Linecards[index].Ports {
+			if phyChassis.Linecards[index].Ports[j].Number == mapping.PONPort {
+				ponPort = &phyChassis.Linecards[index].Ports[j]
+				break
+			}
+		}
+		if ponPort == nil {
+			return fmt.Errorf("OLT %s of %s has no PON port %d", mapping.Hostname, phyChassis.CLLI, mapping.PONPort)
+		}
+		ponPort.AbstractSlot = mapping.Slot
+		ponPort.AbstractPort = mapping.Port
+		_, err = abstractChassis.RestorePort(ponPort)
+		if err != nil {
+			return err
+		}
+	}
+	abstractChassis.AllocInfo = backup.Abstract.AllocInfo
+	if settings.GetDebug() {
+		log.Printf("created chassis %v\n", abstractChassis)
+	}
+	return nil
+}
 
-	//first handle abstract parent pointers
+/*
+linkParents - sets the parent pointers json leaves out
+*/
+func (chassisHolder *ChassisHolder) linkParents() {
+	abstractChassis := &chassisHolder.AbstractChassis
+	phyChassis := &chassisHolder.PhysicalChassis
 	for i := 0; i < len(abstractChassis.Slots); i++ {
 		slot := &abstractChassis.Slots[i]
-		slot.Parent = &abstractChassis
+		slot.Parent = abstractChassis
 		for j := 0; j < len(slot.Ports); j++ {
 			port := &slot.Ports[j]
 			port.Parent = slot
@@ -52,29 +177,81 @@ func (chassisHolder *ChassisHolder) Deserialize(jsonData []byte) error {
 			}
 		}
 	}
-	//second handle physical parent pointers
-	for i := 0; i < len(physicalChassis.Linecards); i++ {
-		slot := physicalChassis.Linecards[i]
-		slot.Parent = &physicalChassis
-		for j := 0; j < len(slot.Ports); j++ {
-			port := &slot.Ports[j]
-			port.Parent = &slot
+	for i := 0; i < len(phyChassis.Linecards); i++ {
+		olt := &phyChassis.Linecards[i]
+		olt.Parent = phyChassis
+		for j := 0; j < len(olt.Ports); j++ {
+			port := &olt.Ports[j]
+			port.Parent = olt
 			for k := 0; k < len(port.Onts); k++ {
 				port.Onts[k].Parent = port
 			}
 		}
 	}
-	//finally handle abstract.Port -> physical.PonPort pointers
+}
 
-	for i := 0; i < len(physicalChassis.Linecards); i++ {
-		slot := physicalChassis.Linecards[i]
-		for j := 0; j < len(slot.Ports); j++ {
-			absPort, _ := chassisHolder.AbstractChassis.NextPort()
-			absPort.PhysPort = &slot.Ports[j]
+/*
+MigrateBackup - upgrades a backup written by an older server to BackupSchemaVersion, upgraded is false when it
+already was in that format
+*/
+func MigrateBackup(jsonData []byte) ([]byte, bool, error) {
+	header := struct{ SchemaVersion int }{}
+	err := json.Unmarshal(jsonData, &header)
+	if err != nil {
+		return nil, false, err
+	}
+	version := header.SchemaVersion
+	// the first format was the physical chassis on its own and had no version
+	if version == 0 {
+		version = 1
+	}
+	if version > BackupSchemaVersion {
+		return nil, false, &SchemaVersionError{Version: version}
+	}
+	upgraded := version < BackupSchemaVersion
+	for ; version < BackupSchemaVersion; version++ {
+		jsonData, err = migrations[version-1](jsonData)
+		if err != nil {
+			return nil, false, fmt.Errorf("Unable to migrate backup from schema version %d %v", version, err)
 		}
 	}
-	if settings.GetDebug() {
-		log.Printf("created chassis %v\n", abstractChassis)
+	return jsonData, upgraded, nil
+}
+
+/*
+migrateFromV1 - version 1 was the physical chassis on its own, the abstract ports were mapped back from those recorded
+on the PON ports or, in backups written before they were recorded, in linecard order. Rack and shelf were only kept
+on the physical chassis, backups older than that get 1 as they always did
+*/
+func migrateFromV1(jsonData []byte) ([]byte, error) {
+	chassisHolder := ChassisHolder{}
+	err := json.Unmarshal(jsonData, &chassisHolder.PhysicalChassis)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	phyChassis := &chassisHolder.PhysicalChassis
+	rack, shelf := phyChassis.Rack, phyChassis.Shelf
+	if rack == 0 {
+		rack = 1
+	}
+	if shelf == 0 {
+		shelf = 1
+	}
+	chassisHolder.AbstractChassis = abstract.GenerateChassis(phyChassis.CLLI, rack, shelf)
+	chassisHolder.linkParents()
+	abstractChassis := &chassisHolder.AbstractChassis
+	for i := 0; i < len(phyChassis.Linecards); i++ {
+		olt := &phyChassis.Linecards[i]
+		for j := 0; j < len(olt.Ports); j++ {
+			if olt.Ports[j].AbstractSlot > 0 {
+				_, err = abstractChassis.RestorePort(&olt.Ports[j])
+			} else {
+				_, err = abstractChassis.AssignPort(&olt.Ports[j])
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return chassisHolder.Serialize()
 }
@@ -17,6 +17,8 @@
 package models_test
 
 import (
+	"context"
+	encjson "encoding/json"
 	"net"
 	"testing"
 
@@ -40,7 +42,7 @@ func TestChassisSerialize_Serialize(t *testing.T) {
 	chassisHolder := &models.ChassisHolder{AbstractChassis: abstractChassis, PhysicalChassis: phyChassis}
 	(*chassisMap)[clli] = chassisHolder
 	sOlt := physical.SimpleOLT{CLLI: clli, Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, Parent: &phyChassis}
-	phyChassis.AddOLTChassis(sOlt)
+	phyChassis.AddOLTChassis(context.Background(), sOlt)
 	ports := sOlt.GetPorts()
 	for i := 0; i < len(ports); i++ {
 		absPort, _ := chassisHolder.AbstractChassis.NextPort()
@@ -67,3 +69,113 @@ func TestChassisSerialize_Deserialize(t *testing.T) {
 		t.Fatalf("Failed to de-serialize and serialize accurately")
 	}
 }
+
+func TestChassisSerialize_FullFidelity(t *testing.T) {
+	settings.SetDummy(true)
+	clli := "FIDELITY_CLLI"
+	chassisHolder := &models.ChassisHolder{AbstractChassis: abstract.GenerateChassis(clli, 2, 3),
+		PhysicalChassis: physical.Chassis{CLLI: clli, XOSAddress: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, Rack: 2, Shelf: 3}}
+	sOlt := physical.SimpleOLT{CLLI: clli, Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, Parent: &chassisHolder.PhysicalChassis}
+	sOlt.CreateEdgecore()
+	ports := sOlt.GetPorts()
+	for i := range ports {
+		chassisHolder.AbstractChassis.AssignPort(&ports[i])
+	}
+	chassisHolder.PhysicalChassis.AddOLTChassis(context.Background(), sOlt)
+	// free the first port so the allocation cursor and the mapping no longer follow linecard order
+	chassisHolder.AbstractChassis.Slots[0].Ports[0].PhysPort = nil
+	ports[0].AbstractSlot, ports[0].AbstractPort = 0, 0
+	data, err := chassisHolder.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed with %v\n", err)
+	}
+
+	restored := models.ChassisHolder{}
+	err = restored.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed with %v\n", err)
+	}
+	if restored.AbstractChassis.Rack != 2 || restored.AbstractChassis.Shelf != 3 {
+		t.Fatalf("Rack and shelf should be 2 and 3 not %d and %d\n", restored.AbstractChassis.Rack, restored.AbstractChassis.Shelf)
+	}
+	if restored.AbstractChassis.Slots[0].Ports[0].PhysPort != nil {
+		t.Fatalf("Slot 1 port 1 should still be free after Deserialize")
+	}
+	if restored.AbstractChassis.Slots[0].Ports[1].PhysPort != &restored.PhysicalChassis.Linecards[0].Ports[1] {
+		t.Fatalf("Slot 1 port 2 should be mapped to the second PON port after Deserialize")
+	}
+	spare := make([]physical.PONPort, 2)
+	port, _ := restored.AbstractChassis.AssignPort(&spare[0])
+	if port != &restored.AbstractChassis.Slots[0].Ports[0] {
+		t.Fatalf("AssignPort should hand out the freed port first after Deserialize")
+	}
+	port, _ = restored.AbstractChassis.AssignPort(&spare[1])
+	if port != &restored.AbstractChassis.Slots[1].Ports[0] {
+		t.Fatalf("AssignPort should carry on from the allocation cursor after Deserialize")
+	}
+}
+
+func TestChassisSerialize_MigrateBackup(t *testing.T) {
+	clli := "MIGRATE_CLLI"
+	phyChassis := physical.Chassis{CLLI: clli, XOSAddress: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, Rack: 4, Shelf: 5}
+	sOlt := physical.SimpleOLT{CLLI: clli, Hostname: "slot1", Address: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}}
+	sOlt.CreateEdgecore()
+	phyChassis.Linecards = append(phyChassis.Linecards, sOlt)
+	// version 1 backups were the physical chassis on its own
+	v1, _ := encjson.Marshal(phyChassis)
+
+	migrated, upgraded, err := models.MigrateBackup(v1)
+	if err != nil || !upgraded {
+		t.Fatalf("MigrateBackup of a version 1 backup should upgrade it but returned %v %v\n", upgraded, err)
+	}
+	_, upgraded, err = models.MigrateBackup(migrated)
+	if err != nil || upgraded {
+		t.Fatalf("MigrateBackup of a current backup should leave it as it is but returned %v %v\n", upgraded, err)
+	}
+	chassisHolder := models.ChassisHolder{}
+	err = chassisHolder.Deserialize(v1)
+	if err != nil {
+		t.Fatalf("Deserialize of a version 1 backup failed with %v\n", err)
+	}
+	if chassisHolder.AbstractChassis.Rack != 4 || chassisHolder.AbstractChassis.Shelf != 5 {
+		t.Fatalf("Rack and shelf of a version 1 backup should come from the physical chassis")
+	}
+	if chassisHolder.AbstractChassis.Slots[0].Ports[15].PhysPort != &chassisHolder.PhysicalChassis.Linecards[0].Ports[15] {
+		t.Fatalf("PON ports of a version 1 backup should be mapped in linecard order")
+	}
+
+	_, _, err = models.MigrateBackup([]byte(`{"SchemaVersion":99}`))
+	if _, ok := err.(*models.SchemaVersionError); !ok {
+		t.Fatalf("MigrateBackup of a newer backup should fail with SchemaVersionError not %v\n", err)
+	}
+}
+
+func TestChassisSerialize_DuplicateHostnames(t *testing.T) {
+	settings.SetDummy(true)
+	clli := "DUPLICATE_CLLI"
+	phyChassis := physical.Chassis{CLLI: clli, XOSAddress: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, Rack: 1, Shelf: 1}
+	// chassis created before hostnames were checked can hold two olts without a name
+	for _, ip := range []string{"192.168.0.1", "192.168.0.2"} {
+		sOlt := physical.SimpleOLT{CLLI: clli, Address: net.TCPAddr{IP: net.ParseIP(ip), Port: 9191}}
+		sOlt.CreateEdgecore()
+		phyChassis.Linecards = append(phyChassis.Linecards, sOlt)
+	}
+	v1, _ := encjson.Marshal(phyChassis)
+	migrated, _, err := models.MigrateBackup(v1)
+	if err != nil {
+		t.Fatalf("MigrateBackup failed with %v\n", err)
+	}
+
+	chassisHolder := models.ChassisHolder{}
+	err = chassisHolder.Deserialize(migrated)
+	if err != nil {
+		t.Fatalf("Deserialize failed with %v\n", err)
+	}
+	if chassisHolder.AbstractChassis.Slots[1].Ports[0].PhysPort != &chassisHolder.PhysicalChassis.Linecards[1].Ports[0] {
+		t.Fatalf("Slot 2 should be mapped to the second olt and not the first with the same hostname")
+	}
+	json, err := chassisHolder.Serialize()
+	if err != nil || string(json) != string(migrated) {
+		t.Fatalf("Failed to de-serialize and serialize a chassis with duplicate hostnames accurately %v\n", err)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+   Copyright 2017 the original author or authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Storage - where the chassis backups are kept, each under the CLLI of its chassis. Names starting with a . are not
+chassis and are used for the other state that is backed up with them
+*/
+type Storage interface {
+	Save(clli string, data []byte) error
+	Load(clli string) ([]byte, error)
+	List() ([]string, error)
+	Delete(clli string) error
+	Close() error
+}
+
+/*
+StoragePinger - implemented by storage in another process so readiness can check that it is reachable
+*/
+type StoragePinger interface {
+	Ping(timeout time.Duration) error
+}
+
+/*
+BackupNotFoundError - returned by Load when nothing has been saved under CLLI
+*/
+type BackupNotFoundError struct {
+	CLLI string
+}
+
+func (e *BackupNotFoundError) Error() string {
+	return fmt.Sprintf("There is no backup for %s", e.CLLI)
+}
@@ -0,0 +1,104 @@
+/*
+ Copyright 2017 the original author or authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package models_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gerrit.opencord.org/abstract-olt/models"
+)
+
+func testStorage(t *testing.T, storage models.Storage) {
+	_, err := storage.Load("MISSING_CLLI")
+	if _, ok := err.(*models.BackupNotFoundError); !ok {
+		t.Fatalf("Load of a missing backup should return BackupNotFoundError but returned %v\n", err)
+	}
+	err = storage.Save("CLLI_1", []byte("first"))
+	if err != nil {
+		t.Fatalf("Save failed with %v\n", err)
+	}
+	err = storage.Save("CLLI_1", []byte("second"))
+	if err != nil {
+		t.Fatalf("Save over an existing backup failed with %v\n", err)
+	}
+	err = storage.Save(".idempotency", []byte("keys"))
+	if err != nil {
+		t.Fatalf("Save failed with %v\n", err)
+	}
+	data, err := storage.Load("CLLI_1")
+	if err != nil || string(data) != "second" {
+		t.Fatalf("Load should return the last backup saved but returned %s %v\n", data, err)
+	}
+	names, err := storage.List()
+	sort.Strings(names)
+	if err != nil || len(names) != 2 || names[0] != ".idempotency" || names[1] != "CLLI_1" {
+		t.Fatalf("List should return both backups but returned %v %v\n", names, err)
+	}
+	err = storage.Delete("CLLI_1")
+	if err != nil {
+		t.Fatalf("Delete failed with %v\n", err)
+	}
+	err = storage.Delete("CLLI_1")
+	if err != nil {
+		t.Fatalf("Delete of a missing backup should not fail but returned %v\n", err)
+	}
+	_, err = storage.Load("CLLI_1")
+	if _, ok := err.(*models.BackupNotFoundError); !ok {
+		t.Fatalf("Load of a deleted backup should return BackupNotFoundError but returned %v\n", err)
+	}
+}
+
+func TestStorage_FileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "BackupPlaceHolder"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "CLLI_2.tmp"), []byte("partial"), 0644)
+	testStorage(t, models.NewFileStorage(dir))
+}
+
+func TestStorage_BoltStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatalf("Unable to create a backup directory %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "AbstractOLT.db")
+	storage, err := models.NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage failed with %v\n", err)
+	}
+	testStorage(t, storage)
+	storage.Save("CLLI_3", []byte("kept"))
+	storage.Close()
+
+	storage, err = models.NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage failed to reopen with %v\n", err)
+	}
+	defer storage.Close()
+	data, err := storage.Load("CLLI_3")
+	if err != nil || string(data) != "kept" {
+		t.Fatalf("Backup should be kept after the file is reopened but Load returned %s %v\n", data, err)
+	}
+}